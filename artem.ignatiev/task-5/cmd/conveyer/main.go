@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/kryjkaqq/task-5/pkg/adapters"
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/pipeline"
+)
+
+const (
+	DefaultLinger     = 100 * time.Millisecond
+	ReadHeaderTimeout = 5 * time.Second
+	StatePollInterval = time.Millisecond
+)
+
+func main() {
+	var (
+		pipelinePath string
+		inputName    string
+		timeout      time.Duration
+		linger       time.Duration
+		metricsAddr  string
+		exportFormat string
+		checkpoint   string
+	)
+
+	flag.StringVar(&pipelinePath, "pipeline", "", "path to YAML pipeline definition")
+	flag.StringVar(&inputName, "input", "", "channel fed with stdin lines (default: first declared input)")
+	flag.DurationVar(&timeout, "timeout", 0, "stop the pipeline after this duration (0 - no limit)")
+	flag.DurationVar(&linger, "linger", DefaultLinger, "time to wait before draining other inputs after stdin is exhausted")
+	flag.StringVar(&metricsAddr, "metrics", "", "address to serve Prometheus metrics on, e.g. :9090")
+	flag.StringVar(&exportFormat, "export", "", "print the topology as dot or mermaid and exit")
+	flag.StringVar(&checkpoint, "checkpoint", "", "file to save undelivered messages to on shutdown and restore them from")
+	flag.Parse()
+
+	if pipelinePath == "" {
+		usageError("missing required flag: -pipeline")
+	}
+
+	def, err := pipeline.LoadFile(pipelinePath)
+	if err != nil {
+		log.Fatalf("Load pipeline: %v", err)
+	}
+
+	if inputName == "" && len(def.Inputs) > 0 {
+		inputName = def.Inputs[0]
+	}
+
+	if inputName == "" {
+		usageError("pipeline declares no inputs, use -input")
+	}
+
+	conv, err := pipeline.Build(def, pipeline.NewRegistry())
+	if err != nil {
+		log.Fatalf("Build pipeline: %v", err)
+	}
+
+	if exportFormat != "" {
+		graph, err := conv.Export(conveyer.ExportFormat(exportFormat))
+		if err != nil {
+			log.Fatalf("Export pipeline: %v", err)
+		}
+
+		fmt.Print(graph)
+
+		return
+	}
+
+	if checkpoint != "" {
+		conv.SetCheckpoint(checkpoint, conveyer.StringCodec{})
+	}
+
+	if metricsAddr != "" {
+		go serveMetrics(metricsAddr, conv)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var printers sync.WaitGroup
+
+	for _, name := range def.Outputs {
+		printers.Add(1)
+
+		go func(name string) {
+			defer printers.Done()
+
+			printOutput(conv, name)
+		}(name)
+	}
+
+	go func() {
+		if err := adapters.ReadStdin(ctx, conv, inputName, conveyer.StringCodec{}); err != nil {
+			log.Printf("Error reading stdin: %v", err)
+		}
+
+		// The end of stdin closes its channel and completes the pipeline; other
+		// inputs are drained after linger.
+		select {
+		case <-time.After(linger):
+		case <-ctx.Done():
+			return
+		}
+
+		if !waitStarted(ctx, conv) {
+			return
+		}
+
+		// A conveyer which already completed has nothing left to drain.
+		err := conv.Drain(ctx)
+		if err != nil && !errors.Is(err, conveyer.ErrInvalidTransition) {
+			log.Printf("Error draining: %v", err)
+			cancel()
+		}
+	}()
+
+	runErr := conv.Run(ctx)
+
+	printers.Wait()
+
+	if runErr != nil {
+		log.Printf("Conveyer stopped with error: %v", runErr)
+		os.Exit(1)
+	}
+}
+
+// waitStarted waits until Run has started the conveyer. It reports false if
+// ctx ends first.
+func waitStarted(ctx context.Context, conv *conveyer.Conveyer[string]) bool {
+	ticker := time.NewTicker(StatePollInterval)
+	defer ticker.Stop()
+
+	for conv.State() == conveyer.StateCreated {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+// usageError reports a wrong command line the way the flag package does.
+func usageError(message string) {
+	fmt.Fprintln(flag.CommandLine.Output(), message)
+	flag.Usage()
+	os.Exit(2)
+}
+
+func printOutput(conv *conveyer.Conveyer[string], name string) {
+	for {
+		res, err := conv.Recv(name)
+		if errors.Is(err, conveyer.ErrChanClosed) {
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error receiving from %s: %v", name, err)
+
+			return
+		}
+
+		fmt.Printf("%s: %s\n", name, res)
+	}
+}
+
+func serveMetrics(addr string, conv *conveyer.Conveyer[string]) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", conveyer.MetricsHandler(conv))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+	}
+
+	if err := server.ListenAndServe(); err != nil {
+		log.Printf("Metrics server stopped: %v", err)
+	}
+}
@@ -19,6 +19,9 @@ const (
 func main() {
 	conv := conveyer.New(ChanSize)
 
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("final_output")
+
 	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated_stream")
 	conv.RegisterSeparator(handlers.SeparatorFunc, "decorated_stream", []string{"part1", "part2"})
 	conv.RegisterMultiplexer(handlers.MultiplexerFunc, []string{"part1", "part2"}, "final_output")
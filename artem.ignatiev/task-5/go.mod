@@ -2,4 +2,13 @@ module github.com/kryjkaqq/task-5
 
 go 1.22.7
 
-require golang.org/x/sync v0.7.0
+require (
+	github.com/stretchr/testify v1.11.1
+	golang.org/x/sync v0.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
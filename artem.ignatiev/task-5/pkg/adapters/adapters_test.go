@@ -0,0 +1,185 @@
+package adapters_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/adapters"
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func demoConveyer() *conveyer.Conveyer[string] {
+	conv := conveyer.New(2)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated")
+	conv.RegisterSeparator(handlers.SeparatorFunc, "decorated", []string{"left", "right"})
+	conv.RegisterMultiplexer(handlers.MultiplexerFunc, []string{"left", "right"}, "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	return conv
+}
+
+func runConveyer(t *testing.T, conv *conveyer.Conveyer[string]) <-chan error {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	return done
+}
+
+func sortedLines(text string) []string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	sort.Strings(lines)
+
+	return lines
+}
+
+func TestFileToFileCompletes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "in.txt")
+	sink := filepath.Join(dir, "out.txt")
+	require.NoError(t, os.WriteFile(source, []byte("a\nb\nc\nd\ne\n"), 0o600))
+
+	conv := demoConveyer()
+	done := runConveyer(t, conv)
+	written := make(chan error, 1)
+
+	go func() {
+		written <- adapters.WriteFile(context.Background(), conv, "output", sink, conveyer.StringCodec{})
+	}()
+
+	require.NoError(t, adapters.ReadFile(context.Background(), conv, "input", source, conveyer.StringCodec{}))
+
+	require.NoError(t, <-done, "end of input completes the run")
+	require.NoError(t, <-written)
+
+	data, err := os.ReadFile(sink)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"decorated: a", "decorated: b", "decorated: c", "decorated: d", "decorated: e",
+	}, sortedLines(string(data)))
+}
+
+func TestReadLinesDecodeError(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[int](4)
+	conv.DeclareInputs("numbers")
+
+	err := adapters.ReadLines(context.Background(), conv, "numbers",
+		strings.NewReader("1\nnope\n"), conveyer.JSONCodec[int]{})
+	require.ErrorContains(t, err, "line 2")
+
+	item, err := conv.Recv("numbers")
+	require.NoError(t, err)
+	assert.Equal(t, 1, item)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestWriteLinesPutsBackUnwritten(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(2)
+	require.NoError(t, conv.SetAckTimeout("output", time.Minute))
+	require.NoError(t, conv.Send("output", "a"))
+
+	err := adapters.WriteLines(context.Background(), conv, "output", failingWriter{}, conveyer.StringCodec{})
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+
+	item, err := conv.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "a", item, "the message the writer failed on is back in its channel")
+}
+
+func TestHTTPSource(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(4)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	done := runConveyer(t, conv)
+	source := adapters.NewHTTPSource(conv, "input", conveyer.StringCodec{})
+	server := httptest.NewServer(source)
+	t.Cleanup(server.Close)
+
+	resp, err := http.Post(server.URL, "text/plain", strings.NewReader("a\nb\n"))
+	require.NoError(t, err)
+
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "2\n", string(body))
+
+	resp, err = http.Get(server.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	require.NoError(t, source.Close())
+	require.NoError(t, <-done)
+
+	var out bytes.Buffer
+	require.NoError(t, adapters.WriteLines(context.Background(), conv, "output", &out, conveyer.StringCodec{}))
+	assert.Equal(t, "decorated: a\ndecorated: b\n", out.String())
+
+	resp, err = http.Post(server.URL, "text/plain", strings.NewReader("late\n"))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestSSESink(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(4)
+	conv.DeclareInputs("events")
+
+	server := httptest.NewServer(adapters.NewSSESink(conv, "events", conveyer.StringCodec{}))
+	t.Cleanup(server.Close)
+
+	require.NoError(t, conv.Send("events", "one"))
+	require.NoError(t, conv.Send("events", "two\nlines"))
+	require.NoError(t, conv.CloseInput("events"))
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	stream, err := io.ReadAll(bufio.NewReader(resp.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "data: one\n\ndata: two\ndata: lines\n\nevent: end\ndata:\n\n", string(stream))
+}
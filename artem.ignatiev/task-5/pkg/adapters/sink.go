@@ -0,0 +1,190 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// WriteLines writes every message of the named channel to writer as a line
+// and returns once the channel is closed and drained. On a channel with an ack
+// timeout a message is acknowledged once written and goes back to the channel
+// when writing it fails; elsewhere that message is lost.
+func WriteLines[T any](
+	ctx context.Context,
+	conv *conveyer.Conveyer[T],
+	name string,
+	writer io.Writer,
+	codec conveyer.Codec[T],
+) error {
+	receive := receiver(conv, name)
+
+	for {
+		item, done, err := receive(ctx)
+		if errors.Is(err, conveyer.ErrChanClosed) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("sink %q: %w", name, err)
+		}
+
+		err = writeLine(writer, item, codec)
+		done(err == nil)
+
+		if err != nil {
+			return fmt.Errorf("sink %q: %w", name, err)
+		}
+	}
+}
+
+func writeLine[T any](writer io.Writer, item T, codec conveyer.Codec[T]) error {
+	data, err := codec.Encode(item)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(append(data, '\n'))
+
+	return err
+}
+
+// receiver reads the named channel for a sink. done acknowledges a message
+// written or puts it back when the channel has an ack timeout; an ack which
+// comes too late leaves the message to be delivered again.
+func receiver[T any](
+	conv *conveyer.Conveyer[T],
+	name string,
+) func(ctx context.Context) (item T, done func(written bool), err error) {
+	acks := true
+
+	return func(ctx context.Context) (T, func(written bool), error) {
+		if acks {
+			delivery, err := conv.RecvDeliveryContext(ctx, name)
+			if err == nil {
+				return delivery.Item, func(written bool) {
+					if written {
+						_ = delivery.Ack()
+					} else {
+						_ = delivery.Nack(true)
+					}
+				}, nil
+			}
+
+			if !errors.Is(err, conveyer.ErrNoAcks) {
+				var zero T
+
+				return zero, nil, err
+			}
+
+			acks = false
+		}
+
+		item, err := conv.RecvContext(ctx, name)
+
+		return item, func(bool) {}, err
+	}
+}
+
+// WriteFile is WriteLines into a file created at path.
+func WriteFile[T any](
+	ctx context.Context,
+	conv *conveyer.Conveyer[T],
+	name string,
+	path string,
+	codec conveyer.Codec[T],
+) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("sink %q: %w", name, err)
+	}
+
+	err = WriteLines(ctx, conv, name, file, codec)
+	if closeErr := file.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("sink %q: %w", name, closeErr)
+	}
+
+	return err
+}
+
+// WriteStdout is WriteLines into the standard output.
+func WriteStdout[T any](ctx context.Context, conv *conveyer.Conveyer[T], name string, codec conveyer.Codec[T]) error {
+	return WriteLines(ctx, conv, name, os.Stdout, codec)
+}
+
+// SSESink streams the named channel as Server-Sent Events. Clients compete
+// for messages like concurrent Recv calls, and a message taken for a client
+// which goes away is lost. An "end" event tells the client the channel is
+// closed.
+type SSESink[T any] struct {
+	conv  *conveyer.Conveyer[T]
+	name  string
+	codec conveyer.Codec[T]
+}
+
+func NewSSESink[T any](conv *conveyer.Conveyer[T], name string, codec conveyer.Codec[T]) *SSESink[T] {
+	return &SSESink[T]{conv: conv, name: name, codec: codec}
+}
+
+func (s *SSESink[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		item, err := s.conv.RecvContext(r.Context(), s.name)
+		if errors.Is(err, conveyer.ErrChanClosed) {
+			_, _ = io.WriteString(w, "event: end\ndata:\n\n")
+			flusher.Flush()
+
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		data, err := s.codec.Encode(item)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+			flusher.Flush()
+
+			return
+		}
+
+		if _, err := w.Write(event(data)); err != nil {
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// event frames data as one event, a data field per line.
+func event(data []byte) []byte {
+	var frame bytes.Buffer
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		frame.WriteString("data: ")
+		frame.Write(line)
+		frame.WriteByte('\n')
+	}
+
+	frame.WriteByte('\n')
+
+	return frame.Bytes()
+}
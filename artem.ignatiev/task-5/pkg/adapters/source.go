@@ -0,0 +1,137 @@
+// Package adapters connects conveyer channels to files, the standard streams
+// and HTTP. Sources feed a channel like Send and close it at the end of their
+// input, sinks drain a channel like Recv until it is closed.
+package adapters
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// MaxLine bounds the length of a line read by the sources.
+const MaxLine = 1024 * 1024
+
+// ReadLines sends every line of reader to the named channel and closes the
+// channel once reader is exhausted.
+func ReadLines[T any](
+	ctx context.Context,
+	conv *conveyer.Conveyer[T],
+	name string,
+	reader io.Reader,
+	codec conveyer.Codec[T],
+) error {
+	if _, err := sendLines(ctx, conv, name, reader, codec); err != nil {
+		return err
+	}
+
+	if err := conv.CloseInput(name); err != nil {
+		return fmt.Errorf("source %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// ReadFile is ReadLines over the file at path.
+func ReadFile[T any](
+	ctx context.Context,
+	conv *conveyer.Conveyer[T],
+	name string,
+	path string,
+	codec conveyer.Codec[T],
+) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("source %q: %w", name, err)
+	}
+	defer file.Close()
+
+	return ReadLines(ctx, conv, name, file, codec)
+}
+
+// ReadStdin is ReadLines over the standard input.
+func ReadStdin[T any](ctx context.Context, conv *conveyer.Conveyer[T], name string, codec conveyer.Codec[T]) error {
+	return ReadLines(ctx, conv, name, os.Stdin, codec)
+}
+
+func sendLines[T any](
+	ctx context.Context,
+	conv *conveyer.Conveyer[T],
+	name string,
+	reader io.Reader,
+	codec conveyer.Codec[T],
+) (int, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), MaxLine)
+
+	sent := 0
+
+	for scanner.Scan() {
+		item, err := codec.Decode(scanner.Bytes())
+		if err != nil {
+			return sent, fmt.Errorf("source %q: line %d: %w", name, sent+1, err)
+		}
+
+		if err := conv.SendContext(ctx, name, item); err != nil {
+			return sent, fmt.Errorf("source %q: %w", name, err)
+		}
+
+		sent++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return sent, fmt.Errorf("source %q: %w", name, err)
+	}
+
+	return sent, nil
+}
+
+// HTTPSource feeds the named channel with the lines of POST request bodies.
+// It answers 202 with the number of accepted messages; Close ends the input.
+type HTTPSource[T any] struct {
+	conv  *conveyer.Conveyer[T]
+	name  string
+	codec conveyer.Codec[T]
+}
+
+func NewHTTPSource[T any](conv *conveyer.Conveyer[T], name string, codec conveyer.Codec[T]) *HTTPSource[T] {
+	return &HTTPSource[T]{conv: conv, name: name, codec: codec}
+}
+
+func (s *HTTPSource[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	sent, err := sendLines(r.Context(), s.conv, s.name, r.Body, s.codec)
+
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "%d\n", sent)
+	case errors.Is(err, conveyer.ErrChanClosed), errors.Is(err, conveyer.ErrChanFull):
+		http.Error(w, fmt.Sprintf("accepted %d: %v", sent, err), http.StatusServiceUnavailable)
+	case errors.Is(err, bufio.ErrTooLong):
+		http.Error(w, fmt.Sprintf("accepted %d: %v", sent, err), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, fmt.Sprintf("accepted %d: %v", sent, err), http.StatusBadRequest)
+	}
+}
+
+// Close closes the channel, as the end of input of the source.
+func (s *HTTPSource[T]) Close() error {
+	if err := s.conv.CloseInput(s.name); err != nil {
+		return fmt.Errorf("source %q: %w", s.name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoAcks            = errors.New("chan does not use acknowledgements")
+	ErrAlreadySettled    = errors.New("delivery already settled")
+	ErrDeliveryExpired   = errors.New("delivery visibility timeout expired")
+	ErrInvalidVisibility = errors.New("visibility timeout must be positive")
+)
+
+type deliveryState int
+
+const (
+	deliveryPending deliveryState = iota
+	deliverySettled
+	deliveryExpired
+)
+
+// Delivery is a message received with RecvDelivery. It goes back to its
+// channel unless it is acknowledged within the visibility timeout.
+type Delivery[T any] struct {
+	Item    T
+	tracker *ackTracker[T]
+	entry   *inflight
+	taken   queued[T]
+}
+
+type inflight struct {
+	state   deliveryState
+	settled chan struct{}
+}
+
+type ackTracker[T any] struct {
+	mu         sync.Mutex
+	visibility time.Duration
+	source     *channelState
+	stats      *channelStats
+	pending    int
+}
+
+// SetAckTimeout switches a channel to acknowledged delivery, creating it if
+// needed. Messages taken with RecvDelivery must be acknowledged within
+// visibility or they are delivered again, so each message is handled at least
+// once. Recv and stages reading the channel acknowledge on receipt. On a
+// durable channel a message is consumed once acknowledged.
+func (c *Conveyer[T]) SetAckTimeout(name string, visibility time.Duration) error {
+	if visibility <= 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidVisibility, visibility)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.getOrMakeChanLocked(name)
+	state := c.chanState[name]
+
+	if tracker, ok := state.acks.(*ackTracker[T]); ok {
+		tracker.mu.Lock()
+		tracker.visibility = visibility
+		tracker.mu.Unlock()
+
+		return nil
+	}
+
+	state.acks = &ackTracker[T]{
+		mu:         sync.Mutex{},
+		visibility: visibility,
+		source:     state,
+		stats:      &state.stats,
+		pending:    0,
+	}
+
+	return nil
+}
+
+func (c *Conveyer[T]) RecvDelivery(name string) (*Delivery[T], error) {
+	return c.RecvDeliveryContext(context.Background(), name)
+}
+
+// RecvDeliveryContext reads a message from a channel in acknowledged mode
+// and starts its visibility timeout.
+func (c *Conveyer[T]) RecvDeliveryContext(ctx context.Context, name string) (*Delivery[T], error) {
+	c.mu.Lock()
+	channel, ok := c.channels[name]
+	state, clock := c.chanState[name], c.clock
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, ErrChanNotFound
+	}
+
+	tracker, ok := state.acks.(*ackTracker[T])
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNoAcks, name)
+	}
+
+	next, _, err := takeUntil(ctx, nil, channel, state)
+	if err != nil {
+		return nil, err
+	}
+
+	handOver(state, next.item)
+
+	return tracker.deliver(next, clock), nil
+}
+
+func (t *ackTracker[T]) deliver(next queued[T], clock Clock) *Delivery[T] {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := &inflight{state: deliveryPending, settled: make(chan struct{})}
+	timer := clock.NewTimer(t.visibility)
+	t.pending++
+
+	go func() {
+		select {
+		case <-timer.C():
+			if t.settle(entry, deliveryExpired) == nil {
+				t.redeliver(next)
+			}
+		case <-entry.settled:
+			timer.Stop()
+		}
+	}()
+
+	return &Delivery[T]{Item: next.item, tracker: t, entry: entry, taken: next}
+}
+
+func (t *ackTracker[T]) settle(entry *inflight, outcome deliveryState) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch entry.state {
+	case deliveryPending:
+	case deliverySettled:
+		return ErrAlreadySettled
+	case deliveryExpired:
+		return ErrDeliveryExpired
+	}
+
+	entry.state = outcome
+	t.pending--
+
+	if outcome == deliverySettled {
+		close(entry.settled)
+	}
+
+	return nil
+}
+
+// redeliver puts a message back in front of its channel, whatever its overflow
+// policy, where the next reader takes it. On a durable channel it stays
+// unconsumed until handled again.
+func (t *ackTracker[T]) redeliver(next queued[T]) {
+	frontOf[T](t.source).push(next)
+	t.stats.redelivered.Add(1)
+}
+
+func (t *ackTracker[T]) unacked() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.pending
+}
+
+// Ack settles the delivery. After the visibility timeout it reports
+// ErrDeliveryExpired, as the message has been delivered again.
+func (d *Delivery[T]) Ack() error {
+	if err := d.tracker.settle(d.entry, deliverySettled); err != nil {
+		return err
+	}
+
+	settle(d.tracker.source, d.taken)
+
+	return nil
+}
+
+// Nack settles the delivery without handling it. With requeue the message
+// goes back to its channel right away, otherwise it is dropped.
+func (d *Delivery[T]) Nack(requeue bool) error {
+	if err := d.tracker.settle(d.entry, deliverySettled); err != nil {
+		return err
+	}
+
+	if requeue {
+		d.tracker.redeliver(d.taken)
+	} else {
+		settle(d.tracker.source, d.taken)
+	}
+
+	return nil
+}
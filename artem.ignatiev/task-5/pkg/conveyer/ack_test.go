@@ -0,0 +1,155 @@
+package conveyer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/conveyertest"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func TestAckRedelivery(t *testing.T) {
+	t.Parallel()
+
+	clock := conveyertest.NewClock(conveyertest.Epoch)
+
+	conv := conveyer.New(4)
+	conv.SetClock(clock)
+	require.NoError(t, conv.SetAckTimeout("queue", time.Minute))
+
+	require.NoError(t, conv.Send("queue", "a"))
+	require.NoError(t, conv.Send("queue", "b"))
+
+	first, err := conv.RecvDelivery("queue")
+	require.NoError(t, err)
+	assert.Equal(t, "a", first.Item)
+	require.NoError(t, first.Ack())
+	require.ErrorIs(t, first.Ack(), conveyer.ErrAlreadySettled)
+
+	second, err := conv.RecvDelivery("queue")
+	require.NoError(t, err)
+	assert.Equal(t, "b", second.Item)
+
+	clock.Advance(time.Minute)
+
+	again, err := conv.RecvDelivery("queue")
+	require.NoError(t, err)
+	assert.Equal(t, "b", again.Item, "unacknowledged message is delivered again")
+	require.ErrorIs(t, second.Ack(), conveyer.ErrDeliveryExpired)
+
+	require.NoError(t, again.Nack(true))
+
+	requeued, err := conv.RecvDelivery("queue")
+	require.NoError(t, err)
+	assert.Equal(t, "b", requeued.Item)
+	require.NoError(t, requeued.Nack(false))
+
+	stats := conv.Stats().Channels[0]
+	assert.Equal(t, uint64(2), stats.Redelivered)
+	assert.Zero(t, stats.Unacked)
+	assert.Zero(t, stats.Depth)
+}
+
+func TestRedeliveryBypassesOverflow(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []conveyer.OverflowPolicy{
+		conveyer.OverflowBlock,
+		conveyer.OverflowFail,
+		conveyer.OverflowDropNewest,
+	} {
+		clock := conveyertest.NewClock(conveyertest.Epoch)
+
+		conv := conveyer.New(1)
+		conv.SetClock(clock)
+		conv.SetOverflow("queue", policy)
+		require.NoError(t, conv.SetAckTimeout("queue", time.Minute))
+
+		require.NoError(t, conv.Send("queue", "a"))
+
+		delivery, err := conv.RecvDelivery("queue")
+		require.NoError(t, err)
+		require.NoError(t, conv.Send("queue", "b"), "the buffer is full again")
+
+		clock.Advance(time.Minute)
+		require.Eventually(t, func() bool {
+			return conv.Stats().Channels[0].Redelivered == 1
+		}, time.Second, time.Millisecond)
+
+		for _, want := range []string{"a", "b"} {
+			again, err := conv.RecvDelivery("queue")
+			require.NoError(t, err)
+			assert.Equal(t, want, again.Item, "policy %d", policy)
+			require.NoError(t, again.Ack())
+		}
+
+		require.ErrorIs(t, delivery.Ack(), conveyer.ErrDeliveryExpired)
+
+		assert.Zero(t, conv.Stats().Channels[0].Dropped)
+	}
+}
+
+func TestAckErrors(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.DeclareInputs("plain")
+
+	_, err := conv.RecvDelivery("plain")
+	require.ErrorIs(t, err, conveyer.ErrNoAcks)
+
+	_, err = conv.RecvDelivery("missing")
+	require.ErrorIs(t, err, conveyer.ErrChanNotFound)
+
+	require.ErrorIs(t, conv.SetAckTimeout("plain", 0), conveyer.ErrInvalidVisibility)
+}
+
+func TestUnackedSurvivesRestart(t *testing.T) {
+	t.Parallel()
+
+	clock := conveyertest.NewClock(conveyertest.Epoch)
+
+	conv := conveyer.New(2)
+	conv.SetClock(clock)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	require.NoError(t, conv.SetAckTimeout("output", time.Minute))
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	_, done := startConveyer(t, conv)
+
+	require.NoError(t, conv.Send("input", "x"))
+
+	delivery, err := conv.RecvDelivery("output")
+	require.NoError(t, err)
+	assert.Equal(t, 1, conv.Stats().Channels[1].Unacked)
+
+	require.Eventually(t, func() bool {
+		return conv.State() == conveyer.StateRunning
+	}, time.Second, time.Millisecond)
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool {
+		return conv.Stats().Channels[1].Redelivered == 1
+	}, time.Second, time.Millisecond)
+
+	_, done = startConveyer(t, conv)
+
+	require.Eventually(t, func() bool {
+		return conv.State() == conveyer.StateRunning
+	}, time.Second, time.Millisecond)
+
+	again, err := conv.RecvDelivery("output")
+	require.NoError(t, err)
+	assert.Equal(t, delivery.Item, again.Item)
+	require.NoError(t, again.Ack())
+
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,582 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kryjkaqq/task-5/pkg/segmentlog"
+)
+
+var (
+	ErrChanFull   = errors.New("chan is full")
+	ErrChanClosed = errors.New("chan is closed")
+
+	errStageStopping = errors.New("stage is stopping")
+)
+
+// OverflowPolicy decides what a write does when the channel buffer is full.
+type OverflowPolicy int32
+
+const (
+	// OverflowBlock waits for room, the default.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowFail makes Send return ErrChanFull. Stage writes drop the message.
+	OverflowFail
+	// OverflowDropOldest evicts the oldest buffered message to make room. An
+	// unbuffered channel has nothing to evict, so there it waits like
+	// OverflowBlock.
+	OverflowDropOldest
+	// OverflowDropNewest discards the message being written.
+	OverflowDropNewest
+)
+
+type channelState struct {
+	stats    channelStats
+	overflow atomic.Int32
+	mu       sync.RWMutex
+	closeMu  sync.Mutex
+	closed   bool
+	closing  chan struct{}
+	durable  any
+	log      *segmentlog.Log
+	ledger   *ledger
+	acks     any
+	front    any
+	observer atomic.Value
+	held     atomic.Int32
+	expiry   atomic.Pointer[expiryQueue]
+}
+
+// depthOf counts the messages waiting for a reader of the channel, including
+// ones put back in front of it or taken but not handed over yet.
+func depthOf[T any](channel chan T, state *channelState) int {
+	return len(channel) + frontOf[T](state).len() + int(state.held.Load())
+}
+
+func newChannelState() *channelState {
+	return &channelState{closing: make(chan struct{})}
+}
+
+// queued is a message taken from a channel. One from a durable channel keeps
+// its log record, settled once the message is handled, and one from a channel
+// tracking deadlines the deadline it was sent with.
+type queued[T any] struct {
+	item     T
+	record   record
+	tracked  bool
+	deadline time.Time
+}
+
+// settle marks a message taken from a durable channel as handled.
+func settle[T any](state *channelState, next queued[T]) {
+	if next.tracked {
+		state.ledger.settle(next.record)
+	}
+}
+
+// frontQueue holds messages put back in front of a channel, such as one a
+// stage took but ended before handling. Readers take them first.
+type frontQueue[T any] struct {
+	mu     sync.Mutex
+	size   atomic.Int32
+	items  []queued[T]
+	signal chan struct{}
+}
+
+func newFrontQueue[T any]() *frontQueue[T] {
+	return &frontQueue[T]{signal: make(chan struct{})}
+}
+
+func frontOf[T any](state *channelState) *frontQueue[T] {
+	front, _ := state.front.(*frontQueue[T])
+
+	return front
+}
+
+func (q *frontQueue[T]) push(items ...queued[T]) {
+	if q == nil || len(items) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items = append(q.items, items...)
+	q.size.Store(int32(len(q.items)))
+	close(q.signal)
+	q.signal = make(chan struct{})
+}
+
+func (q *frontQueue[T]) pop() (queued[T], bool) {
+	var zero queued[T]
+
+	if q == nil || q.size.Load() == 0 {
+		return zero, false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return zero, false
+	}
+
+	item := q.items[0]
+	q.items[0] = zero
+	q.items = q.items[1:]
+	q.size.Store(int32(len(q.items)))
+
+	return item, true
+}
+
+// wait returns a channel closed by the next push.
+func (q *frontQueue[T]) wait() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.signal
+}
+
+func (q *frontQueue[T]) len() int {
+	if q == nil {
+		return 0
+	}
+
+	return int(q.size.Load())
+}
+
+func (q *frontQueue[T]) take() []T {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]T, 0, len(q.items))
+	for _, next := range q.items {
+		items = append(items, next.item)
+	}
+
+	q.items = nil
+	q.size.Store(0)
+
+	return items
+}
+
+func (s *channelState) policy() OverflowPolicy {
+	return OverflowPolicy(s.overflow.Load())
+}
+
+func (s *channelState) isClosed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.closed
+}
+
+func (s *channelState) reopen() {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = false
+	s.closing = make(chan struct{})
+}
+
+// closeChannel closes a channel once. Writers blocked under the read lock are
+// woken through closing before the write lock is taken; closeMu keeps two
+// closes from racing between the check and close(closing).
+func closeChannel[T any](channel chan T, state *channelState) {
+	state.closeMu.Lock()
+	defer state.closeMu.Unlock()
+
+	if state.isClosed() {
+		return
+	}
+
+	close(state.closing)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.closed = true
+	close(channel)
+}
+
+// SetOverflow sets the overflow policy of a channel, creating it if needed.
+func (c *Conveyer[T]) SetOverflow(name string, policy OverflowPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.getOrMakeChanLocked(name)
+	c.chanState[name].overflow.Store(int32(policy))
+}
+
+// send writes a message to a channel. It holds the read lock of the channel
+// throughout, so closeChannel cannot close it under the write.
+func send[T any](ctx context.Context, channel chan T, item T, state *channelState) error {
+	return sendExpiring(ctx, channel, item, time.Time{}, state)
+}
+
+// sendExpiring is send for a message which expires at deadline on a channel
+// tracking deadlines. A zero deadline never expires.
+func sendExpiring[T any](ctx context.Context, channel chan T, item T, deadline time.Time, state *channelState) error {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	if state.closed {
+		return ErrChanClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+
+	if backing, ok := state.durable.(*durable[T]); ok {
+		return backing.append(item, state)
+	}
+
+	expiry := state.expiry.Load()
+	if expiry == nil {
+		_, err := push(ctx, channel, item, state)
+
+		return err
+	}
+
+	// The deadline is queued before the message, so a reader always finds it.
+	if err := expiry.lock(ctx, state.closing); err != nil {
+		return err
+	}
+	defer expiry.unlock()
+
+	expiry.add(deadline)
+
+	pushed, err := push(ctx, channel, item, state)
+	if !pushed {
+		expiry.removeLast()
+	}
+
+	return err
+}
+
+// push writes to the channel following its overflow policy and reports
+// whether the message got in.
+func push[T any](ctx context.Context, channel chan T, item T, state *channelState) (bool, error) {
+	select {
+	case channel <- item:
+		sent(state, item)
+
+		return true, nil
+	default:
+	}
+
+	switch state.policy() {
+	case OverflowFail:
+		state.stats.dropped.Add(1)
+
+		return false, ErrChanFull
+	case OverflowDropNewest:
+		state.stats.dropped.Add(1)
+
+		return false, nil
+	case OverflowDropOldest:
+		if cap(channel) > 0 {
+			pushDroppingOldest(channel, item, state)
+
+			return true, nil
+		}
+	case OverflowBlock:
+	}
+
+	started := time.Now()
+	defer func() {
+		state.stats.sendBlocked.Add(int64(time.Since(started)))
+	}()
+
+	select {
+	case channel <- item:
+		sent(state, item)
+
+		return true, nil
+	case <-state.closing:
+		return false, ErrChanClosed
+	case <-ctx.Done():
+		return false, fmt.Errorf("send: %w", ctx.Err())
+	}
+}
+
+func pushDroppingOldest[T any](channel chan T, item T, state *channelState) {
+	for {
+		select {
+		case channel <- item:
+			sent(state, item)
+
+			return
+		default:
+		}
+
+		select {
+		case <-channel:
+			state.expiry.Load().take()
+			state.stats.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func receive[T any](ctx context.Context, channel chan T, state *channelState) (T, error) {
+	return receiveUntil(ctx, nil, channel, state)
+}
+
+// receiveUntil is receive which also gives up once stop is closed. A message
+// of a durable channel counts as handled once received.
+func receiveUntil[T any](ctx context.Context, stop <-chan struct{}, channel chan T, state *channelState) (T, error) {
+	next, _, err := takeUntil(ctx, stop, channel, state)
+	if err != nil {
+		return next.item, err
+	}
+
+	handOver(state, next.item)
+	settle(state, next)
+
+	return next.item, nil
+}
+
+// takeUntil takes the next message for a reader which settles it once
+// handled. Messages put back in front of the channel come first. The message
+// is held, still counted in the depth, until handOver; waited reports whether
+// the channel was empty.
+func takeUntil[T any](
+	ctx context.Context,
+	stop <-chan struct{},
+	channel chan T,
+	state *channelState,
+) (next queued[T], waited bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return next, false, fmt.Errorf("recv: %w", err)
+	}
+
+	select {
+	case <-stop:
+		return next, false, errStageStopping
+	default:
+	}
+
+	if err := state.ledger.lock(ctx, stop); err != nil {
+		return next, false, err
+	}
+	defer state.ledger.unlock()
+
+	front := frontOf[T](state)
+	wake := front.wait()
+
+	if next, got, err := takeReady(channel, state, front); got || err != nil {
+		return next, false, err
+	}
+
+	started := time.Now()
+	defer func() {
+		state.stats.recvBlocked.Add(int64(time.Since(started)))
+	}()
+
+	for {
+		select {
+		case item, ok := <-channel:
+			next, err := takenFrom(item, ok, state)
+
+			return next, true, err
+		case <-wake:
+			wake = front.wait()
+
+			if next, ok := front.pop(); ok {
+				state.held.Add(1)
+
+				return next, true, nil
+			}
+		case <-ctx.Done():
+			return next, true, fmt.Errorf("recv: %w", ctx.Err())
+		case <-stop:
+			return next, true, errStageStopping
+		}
+	}
+}
+
+// takeReady takes a message if one is ready, failing once the channel is
+// closed.
+func takeReady[T any](channel chan T, state *channelState, front *frontQueue[T]) (queued[T], bool, error) {
+	if next, ok := front.pop(); ok {
+		state.held.Add(1)
+
+		return next, true, nil
+	}
+
+	select {
+	case item, ok := <-channel:
+		next, err := takenFrom(item, ok, state)
+
+		return next, err == nil, err
+	default:
+		return queued[T]{}, false, nil
+	}
+}
+
+// tryTake is takeReady for a reader which does not wait, not even for its turn
+// on a durable channel.
+func tryTake[T any](channel chan T, state *channelState) (queued[T], bool, error) {
+	if !state.ledger.tryLock() {
+		return queued[T]{}, false, nil
+	}
+	defer state.ledger.unlock()
+
+	return takeReady(channel, state, frontOf[T](state))
+}
+
+type anyCase struct {
+	index int
+	kind  int
+}
+
+const (
+	anyStop = iota
+	anyRecv
+	anyWake
+	anyTurn
+)
+
+// takeAny is takeUntil over several channels, skipping nil ones. It waits for
+// its turn on durable channels and keeps the turns it got until it returns.
+// index is -1 once there is nothing to wait for or the reader is stopped.
+func takeAny[T any](
+	ctx context.Context,
+	stop <-chan struct{},
+	channels []chan T,
+	states []*channelState,
+) (index int, next queued[T], err error) {
+	turns := make([]bool, len(channels))
+
+	defer func() {
+		for idx, turn := range turns {
+			if turn {
+				states[idx].ledger.unlock()
+			}
+		}
+	}()
+
+	for {
+		if ctx.Err() != nil || isClosed(stop) {
+			return -1, next, errStageStopping
+		}
+
+		cases := make([]reflect.SelectCase, 0, 2*len(channels)+2)
+		kinds := make([]anyCase, 0, cap(cases))
+
+		for idx, channel := range channels {
+			if channel == nil {
+				continue
+			}
+
+			state := states[idx]
+
+			if state.ledger != nil && !turns[idx] {
+				cases = append(cases, reflect.SelectCase{
+					Dir:  reflect.SelectSend,
+					Chan: reflect.ValueOf(state.ledger.reading),
+					Send: reflect.ValueOf(struct{}{}),
+				})
+				kinds = append(kinds, anyCase{index: idx, kind: anyTurn})
+
+				continue
+			}
+
+			front := frontOf[T](state)
+			wake := front.wait()
+
+			if next, got, err := takeReady(channel, state, front); got || err != nil {
+				return idx, next, err
+			}
+
+			cases = append(cases,
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(channel)},
+				reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(wake)},
+			)
+			kinds = append(kinds, anyCase{index: idx, kind: anyRecv}, anyCase{index: idx, kind: anyWake})
+		}
+
+		if len(cases) == 0 {
+			return -1, next, ErrChanClosed
+		}
+
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)},
+		)
+		kinds = append(kinds, anyCase{index: -1, kind: anyStop}, anyCase{index: -1, kind: anyStop})
+
+		chosen, value, ok := reflect.Select(cases)
+
+		switch picked := kinds[chosen]; picked.kind {
+		case anyRecv:
+			var item T
+			if ok {
+				item, _ = value.Interface().(T)
+			}
+
+			next, err := takenFrom(item, ok, states[picked.index])
+
+			return picked.index, next, err
+		case anyTurn:
+			turns[picked.index] = true
+		case anyWake:
+		default:
+			return -1, next, errStageStopping
+		}
+	}
+}
+
+func isClosed(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func takenFrom[T any](item T, ok bool, state *channelState) (queued[T], error) {
+	if !ok {
+		return queued[T]{item: item}, ErrChanClosed
+	}
+
+	state.held.Add(1)
+
+	if state.ledger == nil {
+		return queued[T]{item: item, deadline: state.expiry.Load().take()}, nil
+	}
+
+	return queued[T]{item: item, record: state.ledger.take(), tracked: true}, nil
+}
+
+// handOver counts a taken message as received.
+func handOver[T any](state *channelState, item T) {
+	state.held.Add(-1)
+	state.stats.received.Add(1)
+	observe(state, OpRecv, item)
+}
+
+// putBack returns a taken message in front of its channel.
+func putBack[T any](state *channelState, next queued[T]) {
+	frontOf[T](state).push(next)
+	state.held.Add(-1)
+}
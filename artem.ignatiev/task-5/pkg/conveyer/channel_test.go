@@ -0,0 +1,180 @@
+package conveyer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func drain(t *testing.T, conv *conveyer.Conveyer[string], name string, count int) []string {
+	t.Helper()
+
+	result := make([]string, 0, count)
+
+	for range count {
+		item, err := conv.Recv(name)
+		require.NoError(t, err)
+
+		result = append(result, item)
+	}
+
+	return result
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fail", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(2)
+		conv.SetOverflow("queue", conveyer.OverflowFail)
+
+		require.NoError(t, conv.Send("queue", "a"))
+		require.NoError(t, conv.Send("queue", "b"))
+		require.ErrorIs(t, conv.Send("queue", "c"), conveyer.ErrChanFull)
+		assert.Equal(t, []string{"a", "b"}, drain(t, conv, "queue", 2))
+		assert.Equal(t, uint64(1), conv.Stats().Channels[0].Dropped)
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(2)
+		conv.SetOverflow("queue", conveyer.OverflowDropNewest)
+
+		for _, item := range []string{"a", "b", "c", "d"} {
+			require.NoError(t, conv.Send("queue", item))
+		}
+
+		assert.Equal(t, []string{"a", "b"}, drain(t, conv, "queue", 2))
+		assert.Equal(t, uint64(2), conv.Stats().Channels[0].Dropped)
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(2)
+		conv.SetOverflow("queue", conveyer.OverflowDropOldest)
+
+		for _, item := range []string{"a", "b", "c", "d"} {
+			require.NoError(t, conv.Send("queue", item))
+		}
+
+		assert.Equal(t, []string{"c", "d"}, drain(t, conv, "queue", 2))
+	})
+
+	t.Run("drop oldest on an unbuffered channel waits", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(0)
+		conv.SetOverflow("queue", conveyer.OverflowDropOldest)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		require.ErrorIs(t, conv.SendContext(ctx, "queue", "a"), context.DeadlineExceeded)
+
+		sent := make(chan error, 1)
+
+		go func() {
+			sent <- conv.Send("queue", "b")
+		}()
+
+		res, err := conv.Recv("queue")
+		require.NoError(t, err)
+		assert.Equal(t, "b", res)
+		require.NoError(t, <-sent)
+		assert.Zero(t, conv.Stats().Channels[0].Dropped)
+	})
+
+	t.Run("stage writes follow the policy", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.SetOverflow("output", conveyer.OverflowDropNewest)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		cancel, done := startConveyer(t, conv)
+
+		for _, item := range []string{"a", "b", "c"} {
+			require.NoError(t, conv.Send("input", item))
+		}
+
+		require.Eventually(t, func() bool {
+			return conv.Stats().Stages[0].Processed == 3
+		}, time.Second, time.Millisecond)
+
+		assert.Equal(t, []string{"decorated: a"}, drain(t, conv, "output", 1))
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+}
+
+func TestContextAwareIO(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	require.NoError(t, conv.Send("input", "a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, conv.SendContext(ctx, "input", "b"), context.DeadlineExceeded)
+
+	_, err := conv.RecvContext(ctx, "output")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = conv.RecvContext(context.Background(), "missing")
+	require.ErrorIs(t, err, conveyer.ErrChanNotFound)
+}
+
+func TestSendUnblocksWhenRunEnds(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	sendErr := make(chan error, 1)
+
+	go func() {
+		for {
+			if err := conv.Send("input", "item"); err != nil {
+				sendErr <- err
+
+				return
+			}
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		return conv.Stats().Channels[1].Depth == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	require.ErrorIs(t, <-sendErr, conveyer.ErrChanClosed)
+
+	_, err := conv.Recv("output")
+	require.NoError(t, err)
+
+	_, err = conv.Recv("output")
+	require.ErrorIs(t, err, conveyer.ErrChanClosed)
+}
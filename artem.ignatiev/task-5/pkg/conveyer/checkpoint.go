@@ -0,0 +1,278 @@
+package conveyer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrBadCheckpoint = errors.New("bad checkpoint")
+
+type checkpoint[T any] struct {
+	path  string
+	codec Codec[T]
+}
+
+// checkpointFile is the saved state: the encoded messages of every channel,
+// oldest first, and the cursors of every stage.
+type checkpointFile struct {
+	Channels map[string][][]byte          `json:"channels"`
+	Cursors  map[string]map[string]uint64 `json:"cursors"`
+}
+
+// SetCheckpoint makes Run save the messages left in the channels, and the
+// stage cursors, to path when it ends, and restore them when it starts and
+// path exists. Durable channels keep their log instead, and deliveries still
+// waiting for an Ack are left to their consumers. The checkpoint is removed
+// once restored, so a crash later in the run does not bring its messages back
+// a second time.
+func (c *Conveyer[T]) SetCheckpoint(path string, codec Codec[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkpoint = &checkpoint[T]{path: path, codec: codec}
+}
+
+type cursorsKey struct{}
+
+type cursors struct {
+	mu     sync.Mutex
+	values map[string]*atomic.Uint64
+}
+
+func newCursors() *cursors {
+	return &cursors{mu: sync.Mutex{}, values: make(map[string]*atomic.Uint64)}
+}
+
+func (c *cursors) get(key string) *atomic.Uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor, ok := c.values[key]
+	if !ok {
+		cursor = new(atomic.Uint64)
+		c.values[key] = cursor
+	}
+
+	return cursor
+}
+
+func (c *cursors) save() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	saved := make(map[string]uint64, len(c.values))
+
+	for key, cursor := range c.values {
+		saved[key] = cursor.Load()
+	}
+
+	return saved
+}
+
+// Cursor returns a named counter of the running stage, such as the next output
+// of a round-robin separator. Workers of the stage share it, and it survives
+// restarts and checkpoints. Outside a stage every call returns a new counter.
+func Cursor(ctx context.Context, key string) *atomic.Uint64 {
+	if stageCursors, ok := ctx.Value(cursorsKey{}).(*cursors); ok {
+		return stageCursors.get(key)
+	}
+
+	return new(atomic.Uint64)
+}
+
+// saveCheckpointLocked takes the messages out of the closed channels of a
+// finished run, including the ones stages put back as they stopped before
+// emitting them, and writes them to the checkpoint. When that fails they go back
+// in front of their channels for the next Run of this process, and the stale
+// checkpoint is removed so it does not bring older messages back.
+func (c *Conveyer[T]) saveCheckpointLocked() error {
+	saved := checkpointFile{
+		Channels: make(map[string][][]byte),
+		Cursors:  make(map[string]map[string]uint64),
+	}
+	taken := make(map[string][]T)
+
+	for _, name := range c.channelsKey {
+		state := c.chanState[name]
+		if state.durable != nil {
+			continue
+		}
+
+		items := frontOf[T](state).take()
+		for item := range c.channels[name] {
+			items = append(items, item)
+		}
+
+		state.expiry.Load().clear()
+
+		if len(items) > 0 {
+			taken[name] = items
+		}
+	}
+
+	err := c.encodeCheckpoint(&saved, taken)
+	if err == nil {
+		err = writeCheckpoint(c.checkpoint.path, &saved)
+	}
+
+	if err != nil {
+		for name, items := range taken {
+			frontOf[T](c.chanState[name]).push(queuedItems(items)...)
+		}
+
+		_ = os.Remove(c.checkpoint.path)
+
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Conveyer[T]) encodeCheckpoint(saved *checkpointFile, taken map[string][]T) error {
+	for name, items := range taken {
+		encoded := make([][]byte, 0, len(items))
+
+		for _, item := range items {
+			data, err := c.checkpoint.codec.Encode(item)
+			if err != nil {
+				return fmt.Errorf("chan %q: %w", name, err)
+			}
+
+			encoded = append(encoded, data)
+		}
+
+		saved.Channels[name] = encoded
+	}
+
+	for _, registered := range c.stages {
+		if values := registered.cursors.save(); len(values) > 0 {
+			saved.Cursors[registered.name] = values
+		}
+	}
+
+	return nil
+}
+
+// writeCheckpoint replaces the file at path in one rename, so a crash leaves
+// either the old checkpoint or the new one.
+func writeCheckpoint(path string, saved *checkpointFile) error {
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	return nil
+}
+
+// restoreCheckpointLocked puts the saved messages in front of the ones
+// already queued and removes the checkpoint. It is checked before anything
+// changes: every channel in it must exist and every message must decode.
+// Cursors of unknown stages are dropped.
+func (c *Conveyer[T]) restoreCheckpointLocked() error {
+	data, err := os.ReadFile(c.checkpoint.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("restore checkpoint: %w", err)
+	}
+
+	var saved checkpointFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("restore checkpoint: %w: %w", ErrBadCheckpoint, err)
+	}
+
+	restored := make(map[string][]T, len(saved.Channels))
+
+	for name, encoded := range saved.Channels {
+		if _, ok := c.channels[name]; !ok {
+			return fmt.Errorf("restore checkpoint: %w: %w: %q", ErrBadCheckpoint, ErrChanNotFound, name)
+		}
+
+		items := make([]T, 0, len(encoded))
+
+		for _, payload := range encoded {
+			item, err := c.checkpoint.codec.Decode(payload)
+			if err != nil {
+				return fmt.Errorf("restore checkpoint: chan %q: %w", name, err)
+			}
+
+			items = append(items, item)
+		}
+
+		restored[name] = items
+	}
+
+	for name, items := range restored {
+		state := c.chanState[name]
+		if backing, ok := state.durable.(*durable[T]); ok {
+			for _, item := range items {
+				if err := backing.append(item, state); err != nil {
+					return fmt.Errorf("restore checkpoint: chan %q: %w", name, err)
+				}
+			}
+
+			delete(restored, name)
+		}
+	}
+
+	if err := os.Remove(c.checkpoint.path); err != nil {
+		return fmt.Errorf("restore checkpoint: %w", err)
+	}
+
+	for name, items := range restored {
+		frontOf[T](c.chanState[name]).push(queuedItems(items)...)
+	}
+
+	for _, registered := range c.stages {
+		for key, value := range saved.Cursors[registered.name] {
+			registered.cursors.get(key).Store(value)
+		}
+	}
+
+	return nil
+}
+
+func queuedItems[T any](items []T) []queued[T] {
+	queue := make([]queued[T], 0, len(items))
+
+	for _, item := range items {
+		queue = append(queue, queued[T]{item: item, record: record{}, tracked: false})
+	}
+
+	return queue
+}
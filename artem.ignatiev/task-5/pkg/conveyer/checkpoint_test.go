@@ -0,0 +1,170 @@
+package conveyer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func checkpointConveyer(path string) *conveyer.Conveyer[string] {
+	conv := conveyer.New(4)
+	conv.RegisterSeparator(handlers.SeparatorFunc, "input", []string{"left", "right"})
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("left", "right")
+	conv.SetCheckpoint(path, conveyer.StringCodec{})
+
+	return conv
+}
+
+func waitRunning(t *testing.T, conv *conveyer.Conveyer[string]) {
+	t.Helper()
+
+	require.Eventually(t, func() bool { return conv.State() == conveyer.StateRunning },
+		time.Second, time.Millisecond)
+}
+
+func TestCheckpointRestoresMessagesAndCursors(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	conv := checkpointConveyer(path)
+	_, done := startConveyer(t, conv)
+
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	require.Eventually(t, func() bool {
+		return conv.Stats().Stages[0].Processed == 3
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+	require.FileExists(t, path)
+
+	restarted := checkpointConveyer(path)
+	_, done = startConveyer(t, restarted)
+	waitRunning(t, restarted)
+	require.NoFileExists(t, path, "a restored checkpoint is not restored again")
+	require.NoError(t, restarted.Send("input", "d"))
+
+	drained := func(name string, count int) []string {
+		items := make([]string, 0, count)
+
+		for range count {
+			item, err := restarted.Recv(name)
+			require.NoError(t, err)
+
+			items = append(items, item)
+		}
+
+		return items
+	}
+
+	assert.Equal(t, []string{"a", "c"}, drained("left", 2))
+	assert.Equal(t, []string{"b", "d"}, drained("right", 2), "the round-robin index goes on")
+
+	require.NoError(t, restarted.Stop())
+	require.NoError(t, <-done)
+}
+
+func TestCheckpointKeepsMessageOfBlockedStage(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	newConveyer := func() *conveyer.Conveyer[string] {
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+		conv.SetCheckpoint(path, conveyer.StringCodec{})
+
+		return conv
+	}
+
+	conv := newConveyer()
+	_, done := startConveyer(t, conv)
+	waitRunning(t, conv)
+
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	// "a" fills the output, the decorator is stuck emitting "b" and "c" waits.
+	require.Eventually(t, func() bool {
+		return conv.Stats().Channels[0].Received == 2
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+
+	restarted := newConveyer()
+	_, done = startConveyer(t, restarted)
+
+	for _, want := range []string{"decorated: a", "decorated: b", "decorated: c"} {
+		res, err := restarted.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	}
+
+	require.NoError(t, restarted.Stop())
+	require.NoError(t, <-done)
+}
+
+func TestCheckpointErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	t.Run("unknown channel", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(dir, "unknown.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"channels":{"gone":["eA=="]}}`), 0o600))
+
+		err := checkpointConveyer(path).Run(context.Background())
+		require.ErrorIs(t, err, conveyer.ErrBadCheckpoint)
+		require.ErrorIs(t, err, conveyer.ErrChanNotFound)
+	})
+
+	t.Run("corrupt file", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(dir, "corrupt.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"channels":`), 0o600))
+
+		require.ErrorIs(t, checkpointConveyer(path).Run(context.Background()), conveyer.ErrBadCheckpoint)
+	})
+
+	t.Run("save fails", func(t *testing.T) {
+		t.Parallel()
+
+		conv := checkpointConveyer(filepath.Join(dir, "missing", "checkpoint.json"))
+		_, done := startConveyer(t, conv)
+		waitRunning(t, conv)
+
+		require.NoError(t, conv.Send("left", "kept"))
+		require.NoError(t, conv.Stop())
+		require.ErrorContains(t, <-done, "save checkpoint")
+
+		_, done = startConveyer(t, conv)
+		waitRunning(t, conv)
+
+		res, err := conv.Recv("left")
+		require.NoError(t, err)
+		assert.Equal(t, "kept", res, "the messages stay for the next run")
+
+		require.NoError(t, conv.Stop())
+		require.Error(t, <-done)
+	})
+}
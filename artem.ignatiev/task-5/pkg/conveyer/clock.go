@@ -0,0 +1,75 @@
+package conveyer
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells time to stages and to the conveyer's own waits, so tests can
+// drive time-based handlers with a virtual clock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type clockKey struct{}
+
+type systemClock struct{}
+
+type systemTimer struct{ *time.Timer }
+
+type systemTicker struct{ *time.Ticker }
+
+// SystemClock is the wall clock used unless SetClock says otherwise.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// SetClock replaces the clock of the following runs.
+func (c *Conveyer[T]) SetClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = clock
+}
+
+// ClockOf returns the clock of the conveyer running the stage in ctx, or the
+// system clock outside of a conveyer.
+func ClockOf(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock
+	}
+
+	return SystemClock()
+}
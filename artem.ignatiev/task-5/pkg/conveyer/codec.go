@@ -0,0 +1,44 @@
+package conveyer
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Codec turns payloads into bytes for durable and remote channels and for
+// the adapters.
+type Codec[T any] interface {
+	Encode(item T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+type StringCodec struct{}
+
+func (StringCodec) Encode(item string) ([]byte, error) {
+	return []byte(item), nil
+}
+
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(item T) ([]byte, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("encode payload: %w", err)
+	}
+
+	return data, nil
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var item T
+
+	if err := json.Unmarshal(data, &item); err != nil {
+		return item, fmt.Errorf("decode payload: %w", err)
+	}
+
+	return item, nil
+}
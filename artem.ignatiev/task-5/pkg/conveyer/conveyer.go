@@ -4,153 +4,433 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
 	"sync"
-
-	"golang.org/x/sync/errgroup"
+	"sync/atomic"
 )
 
 var ErrChanNotFound = errors.New("chan not found")
 
+type StageKind string
+
 const (
-	resUndefined = "undefined"
+	KindDecorator   StageKind = "decorator"
+	KindMultiplexer StageKind = "multiplexer"
+	KindSeparator   StageKind = "separator"
 )
 
-type TaskFunc func(ctx context.Context) error
+type stageRun[T any] func(ctx context.Context, inputs []chan T, outputs []chan T) error
+
+type stage[T any] struct {
+	kind    StageKind
+	name    string
+	inputs  []string
+	outputs []string
+	run     stageRun[T]
+	config  stageConfig
+	stats   stageStats
+	handle  *stageHandle
+	cursors *cursors
+}
+
+func (s *stage[T]) String() string {
+	return fmt.Sprintf("%s %q [%s] -> [%s]",
+		s.kind, s.name, strings.Join(s.inputs, ", "), strings.Join(s.outputs, ", "))
+}
 
-type Conveyer struct {
+// Conveyer wires named channels of T together with decorators, multiplexers and separators.
+type Conveyer[T any] struct {
 	mu          sync.Mutex
-	channels    map[string]chan string
+	channels    map[string]chan T
 	chanSize    int
-	tasks       []TaskFunc
+	stages      []*stage[T]
 	channelsKey []string
+	chanState   map[string]*channelState
+	deadLetters map[string]chan DeadLetter[T]
+	supervisor  *Supervisor
+	lineage     *lineage
+	inputs      map[string]struct{}
+	outputs     map[string]struct{}
+	bridges     []bridge
+	running     *runState
+	snapshot    atomic.Pointer[channelSnapshot[T]]
+	checkpoint  *checkpoint[T]
+	state       State
+	clock       Clock
+	observer    Observer[T]
+}
+
+// New creates the string conveyer the rest of the task works with.
+func New(size int) *Conveyer[string] {
+	return NewOf[string](size)
 }
 
-func New(size int) *Conveyer {
-	return &Conveyer{
+// NewOf creates a conveyer which carries payloads of type T.
+func NewOf[T any](size int) *Conveyer[T] {
+	return &Conveyer[T]{
 		mu:          sync.Mutex{},
-		channels:    make(map[string]chan string),
+		channels:    make(map[string]chan T),
 		chanSize:    size,
-		tasks:       make([]TaskFunc, 0),
+		stages:      make([]*stage[T], 0),
 		channelsKey: make([]string, 0),
+		chanState:   make(map[string]*channelState),
+		deadLetters: make(map[string]chan DeadLetter[T]),
+		inputs:      make(map[string]struct{}),
+		outputs:     make(map[string]struct{}),
+		state:       StateCreated,
+		clock:       SystemClock(),
 	}
 }
 
-func (c *Conveyer) getOrMakeChan(name string) chan string {
+func (c *Conveyer[T]) getOrMakeChan(name string) chan T {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	return c.getOrMakeChanLocked(name)
+}
+
+func (c *Conveyer[T]) getOrMakeChanLocked(name string) chan T {
 	if channel, ok := c.channels[name]; ok {
 		return channel
 	}
 
-	newChannel := make(chan string, c.chanSize)
+	newChannel := make(chan T, c.chanSize)
 	c.channels[name] = newChannel
 	c.channelsKey = append(c.channelsKey, name)
+	state := newChannelState()
+	state.front = newFrontQueue[T]()
+	c.observeLocked(name, state)
+	c.chanState[name] = state
+	c.publishLocked()
 
 	return newChannel
 }
 
-func (c *Conveyer) RegisterDecorator(
-	decoratorFunc func(ctx context.Context, input chan string, output chan string) error,
-	inputName string,
-	outputName string,
-) {
-	inputChannel := c.getOrMakeChan(inputName)
-	outputChannel := c.getOrMakeChan(outputName)
+// DeclareInputs marks channels fed from outside through Send. Validate reports
+// every other channel read by a stage but written by none as dangling.
+func (c *Conveyer[T]) DeclareInputs(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		c.getOrMakeChanLocked(name)
+		c.inputs[name] = struct{}{}
+	}
+}
+
+// DeclareOutputs marks channels drained from outside through Recv. Validate
+// reports every other channel written by a stage but read by none as unconsumed.
+func (c *Conveyer[T]) DeclareOutputs(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	c.tasks = append(c.tasks, func(ctx context.Context) error {
-		return decoratorFunc(ctx, inputChannel, outputChannel)
-	})
+	for _, name := range names {
+		c.getOrMakeChanLocked(name)
+		c.outputs[name] = struct{}{}
+	}
 }
 
-func (c *Conveyer) RegisterMultiplexer(
-	multiplexerFunc func(ctx context.Context, inputs []chan string, output chan string) error,
-	inputsNames []string,
-	outputName string,
+// Outputs lists the declared outputs, or every channel no stage consumes when
+// none are declared.
+func (c *Conveyer[T]) Outputs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	consumed := make(map[string]struct{})
+
+	for _, registered := range c.stages {
+		for _, name := range registered.inputs {
+			consumed[name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(c.channelsKey))
+
+	for _, name := range c.channelsKey {
+		_, isOutput := c.outputs[name]
+		_, isConsumed := consumed[name]
+
+		if isOutput || (len(c.outputs) == 0 && !isConsumed) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func (c *Conveyer[T]) addStage(
+	kind StageKind,
+	handler any,
+	inputs []string,
+	outputs []string,
+	run stageRun[T],
+	opts []StageOption,
 ) {
-	inputChannels := make([]chan string, 0, len(inputsNames))
+	config := newStageConfig(opts)
+
+	for _, name := range inputs {
+		c.getOrMakeChan(name)
+	}
+
+	for _, name := range outputs {
+		c.getOrMakeChan(name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if config.policy.Action == ActionDeadLetter {
+		c.getOrMakeDeadLetterLocked(config.policy.DeadLetter)
+	}
 
-	for _, name := range inputsNames {
-		inputChannels = append(inputChannels, c.getOrMakeChan(name))
+	registered := &stage[T]{
+		kind:    kind,
+		name:    c.uniqueStageName(handlerName(handler)),
+		inputs:  inputs,
+		outputs: outputs,
+		run:     run,
+		config:  config,
+		cursors: newCursors(),
 	}
 
-	outputChannel := c.getOrMakeChan(outputName)
+	c.stages = append(c.stages, registered)
+	c.startStageLocked(registered)
+}
+
+func (c *Conveyer[T]) uniqueStageName(name string) string {
+	candidate := name
+
+	for suffix := 2; ; suffix++ {
+		taken := false
+
+		for _, registered := range c.stages {
+			if registered.name == candidate {
+				taken = true
+
+				break
+			}
+		}
+
+		if !taken {
+			return candidate
+		}
+
+		candidate = fmt.Sprintf("%s#%d", name, suffix)
+	}
+}
+
+func handlerName(handler any) string {
+	value := reflect.ValueOf(handler)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return "unknown"
+	}
+
+	fn := runtime.FuncForPC(value.Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+
+	name := fn.Name()
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
 
-	c.tasks = append(c.tasks, func(ctx context.Context) error {
-		return multiplexerFunc(ctx, inputChannels, outputChannel)
-	})
+	return name
 }
 
-func (c *Conveyer) RegisterSeparator(
-	separatorFunc func(ctx context.Context, input chan string, outputs []chan string) error,
+// RegisterDecorator adds a stage; on a running conveyer it starts right away.
+func (c *Conveyer[T]) RegisterDecorator(
+	decoratorFunc func(ctx context.Context, input chan T, output chan T) error,
+	inputName string,
+	outputName string,
+	opts ...StageOption,
+) {
+	c.addStage(KindDecorator, decoratorFunc, []string{inputName}, []string{outputName},
+		decoratorRun(decoratorFunc), opts)
+}
+
+func (c *Conveyer[T]) RegisterMultiplexer(
+	multiplexerFunc func(ctx context.Context, inputs []chan T, output chan T) error,
+	inputsNames []string,
+	outputName string,
+	opts ...StageOption,
+) {
+	c.addStage(KindMultiplexer, multiplexerFunc, inputsNames, []string{outputName},
+		multiplexerRun(multiplexerFunc), opts)
+}
+
+func (c *Conveyer[T]) RegisterSeparator(
+	separatorFunc func(ctx context.Context, input chan T, outputs []chan T) error,
 	inputName string,
 	outputsNames []string,
+	opts ...StageOption,
 ) {
-	inputChannel := c.getOrMakeChan(inputName)
-	outputChannels := make([]chan string, 0, len(outputsNames))
+	c.addStage(KindSeparator, separatorFunc, []string{inputName}, outputsNames,
+		separatorRun(separatorFunc), opts)
+}
 
-	for _, name := range outputsNames {
-		outputChannels = append(outputChannels, c.getOrMakeChan(name))
+func decoratorRun[T any](decoratorFunc func(ctx context.Context, input chan T, output chan T) error) stageRun[T] {
+	return func(ctx context.Context, inputs []chan T, outputs []chan T) error {
+		return decoratorFunc(ctx, inputs[0], outputs[0])
 	}
+}
 
-	c.tasks = append(c.tasks, func(ctx context.Context) error {
-		return separatorFunc(ctx, inputChannel, outputChannels)
-	})
+func multiplexerRun[T any](
+	multiplexerFunc func(ctx context.Context, inputs []chan T, output chan T) error,
+) stageRun[T] {
+	return func(ctx context.Context, inputs []chan T, outputs []chan T) error {
+		return multiplexerFunc(ctx, inputs, outputs[0])
+	}
 }
 
-func (c *Conveyer) Run(ctx context.Context) error {
-	group, groupCtx := errgroup.WithContext(ctx)
+func separatorRun[T any](separatorFunc func(ctx context.Context, input chan T, outputs []chan T) error) stageRun[T] {
+	return func(ctx context.Context, inputs []chan T, outputs []chan T) error {
+		return separatorFunc(ctx, inputs[0], outputs)
+	}
+}
 
-	for _, task := range c.tasks {
-		currentTask := task
+func (c *Conveyer[T]) resolve(names []string) []chan T {
+	channels := make([]chan T, 0, len(names))
 
-		group.Go(func() error {
-			return currentTask(groupCtx)
-		})
+	for _, name := range names {
+		channels = append(channels, c.channels[name])
 	}
 
-	err := group.Wait()
+	return channels
+}
+
+// Run starts a created or stopped conveyer and blocks until ctx ends, Stop or
+// Drain finish the run, or a stage fails. A stopped conveyer starts over with
+// the messages left in its channels.
+func (c *Conveyer[T]) Run(ctx context.Context) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("conveyer topology error: %w", err)
+	}
 
 	c.mu.Lock()
+
+	switch c.state {
+	case StateCreated:
+	case StateStopped:
+		c.reopenLocked()
+	case StateRunning, StateDraining:
+		err := c.transitionError("run")
+		c.mu.Unlock()
+
+		return err
+	}
+
+	if c.checkpoint != nil {
+		if err := c.restoreCheckpointLocked(); err != nil {
+			c.mu.Unlock()
+
+			return err
+		}
+	}
+
+	group := newRunGroup(context.WithValue(ctx, clockKey{}, c.clock))
+	intake, stopIntake := context.WithCancel(group.ctx)
+	pumpCtx, stopPumps := context.WithCancel(group.ctx)
+	running := &runState{
+		group:      group,
+		intake:     intake,
+		stopIntake: stopIntake,
+		pumpCtx:    pumpCtx,
+		stopPumps:  stopPumps,
+		pumps:      &sync.WaitGroup{},
+		finished:   make(chan struct{}),
+	}
+
+	c.state = StateRunning
+	c.running = running
+	c.publishLocked()
+
 	for _, name := range c.channelsKey {
-		close(c.channels[name])
+		c.startPumpLocked(name)
 	}
-	c.mu.Unlock()
 
-	if err != nil {
-		return fmt.Errorf("conveyer run error: %w", err)
+	for _, registered := range c.stages {
+		c.startStageLocked(registered)
 	}
 
-	return nil
-}
+	for _, link := range c.bridges {
+		c.startBridgeLocked(link)
+	}
+	c.mu.Unlock()
+
+	_ = group.Wait()
 
-func (c *Conveyer) Send(inputName string, data string) error {
 	c.mu.Lock()
-	channel, ok := c.channels[inputName]
-	c.mu.Unlock()
+	c.running = nil
+	c.snapshot.Store(nil)
 
-	if !ok {
-		return ErrChanNotFound
+	for _, registered := range c.stages {
+		registered.handle = nil
 	}
+	c.mu.Unlock()
 
-	channel <- data
+	stopIntake()
+	stopPumps()
+	running.pumps.Wait()
 
-	return nil
-}
+	err := group.Err()
 
-func (c *Conveyer) Recv(outputName string) (string, error) {
 	c.mu.Lock()
-	channel, ok := c.channels[outputName]
+	for _, name := range c.channelsKey {
+		closeChannel(c.channels[name], c.chanState[name])
+	}
+
+	for _, channel := range c.deadLetters {
+		close(channel)
+	}
+
+	var saveErr error
+	if c.checkpoint != nil {
+		saveErr = c.saveCheckpointLocked()
+	}
+
+	c.state = StateStopped
 	c.mu.Unlock()
 
-	if !ok {
-		return "", ErrChanNotFound
+	close(running.finished)
+
+	if err != nil {
+		return errors.Join(fmt.Errorf("conveyer run error: %w", err), saveErr)
+	}
+
+	return saveErr
+}
+
+func (c *Conveyer[T]) Send(inputName string, data T) error {
+	return c.SendContext(context.Background(), inputName, data)
+}
+
+// SendContext writes to a named channel following its overflow policy. A
+// blocked write gives up when ctx is done or the channel gets closed.
+func (c *Conveyer[T]) SendContext(ctx context.Context, inputName string, data T) error {
+	channel, state, err := c.lookup(inputName)
+	if err != nil {
+		return err
 	}
 
-	val, opened := <-channel
-	if !opened {
-		return resUndefined, nil
+	return send(ctx, channel, data, state)
+}
+
+// Recv reads from a named channel. It returns ErrChanClosed once the channel
+// is closed and drained.
+func (c *Conveyer[T]) Recv(outputName string) (T, error) {
+	return c.RecvContext(context.Background(), outputName)
+}
+
+func (c *Conveyer[T]) RecvContext(ctx context.Context, outputName string) (T, error) {
+	channel, state, err := c.lookup(outputName)
+	if err != nil {
+		var zero T
+
+		return zero, err
 	}
 
-	return val, nil
+	return receive(ctx, channel, state)
 }
@@ -0,0 +1,110 @@
+package conveyer_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+type order struct {
+	ID    int
+	Total int
+}
+
+func TestTypedConveyer(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[order](4)
+
+	conv.RegisterDecorator(handlers.NewDecorator(func(item order) (order, error) {
+		item.Total *= 2
+
+		return item, nil
+	}), "orders", "doubled")
+	conv.RegisterSeparator(handlers.Separator[order], "doubled", []string{"left", "right"})
+	conv.RegisterMultiplexer(handlers.NewMultiplexer[order](nil), []string{"left", "right"}, "result")
+	conv.DeclareInputs("orders")
+	conv.DeclareOutputs("result")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	require.NoError(t, conv.Send("orders", order{ID: 1, Total: 10}))
+	require.NoError(t, conv.Send("orders", order{ID: 2, Total: 21}))
+
+	totals := make(map[int]int)
+
+	for range 2 {
+		item, err := conv.Recv("result")
+		require.NoError(t, err)
+
+		totals[item.ID] = item.Total
+	}
+
+	assert.Equal(t, map[int]int{1: 20, 2: 42}, totals)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	_, err := conv.Recv("result")
+	require.ErrorIs(t, err, conveyer.ErrChanClosed)
+
+	require.ErrorIs(t, conv.Send("orders", order{ID: 3}), conveyer.ErrChanClosed)
+}
+
+func TestStringConveyer(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(4)
+
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	require.NoError(t, conv.Send("input", "hello"))
+
+	res, err := conv.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: hello", res)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	_, err = conv.Recv("output")
+	require.ErrorIs(t, err, conveyer.ErrChanClosed)
+
+	_, err = conv.Recv("missing")
+	require.ErrorIs(t, err, conveyer.ErrChanNotFound)
+}
+
+func TestOutputs(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.RegisterSeparator(handlers.SeparatorFunc, "input", []string{"left", "right"})
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "left", "decorated")
+
+	assert.Equal(t, []string{"right", "decorated"}, conv.Outputs())
+
+	conv.DeclareOutputs("left")
+	assert.Equal(t, []string{"left"}, conv.Outputs())
+}
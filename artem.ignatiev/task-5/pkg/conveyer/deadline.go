@@ -0,0 +1,255 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoDeadlines      = errors.New("chan does not track deadlines")
+	ErrDurableDeadlines = errors.New("durable chan cannot track deadlines")
+)
+
+// expiring is a message carrying its own deadline, such as an envelope.
+type expiring interface {
+	deadline() time.Time
+}
+
+// messageDeadlineKey holds the deadline of the message a stage is handling.
+type messageDeadlineKey struct{}
+
+// TrackDeadlines makes a channel keep the deadline each message is sent with
+// by SendWithDeadline or SendTTL, creating the channel if needed, so messages
+// of any type can expire. Stages drop them in Next once the deadline passes and
+// handle them under a context ending at it; what a stage emits while handling
+// one keeps its deadline on outputs which track deadlines too. Call it before
+// the channel is used; stages must take from it with Next, TryNext or NextAny.
+// Durable channels cannot track deadlines, and checkpoints do not keep them.
+func (c *Conveyer[T]) TrackDeadlines(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateRunning || c.state == StateDraining {
+		return c.transitionError("track deadlines of")
+	}
+
+	channel := c.getOrMakeChanLocked(name)
+	state := c.chanState[name]
+
+	if state.durable != nil {
+		return fmt.Errorf("%w: %q", ErrDurableDeadlines, name)
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.expiry.Load() == nil {
+		expiry := &expiryQueue{turn: make(chan struct{}, 1), mu: sync.Mutex{}, deadlines: nil}
+
+		// Messages already queued never expire.
+		for range len(channel) {
+			expiry.add(time.Time{})
+		}
+
+		state.expiry.Store(expiry)
+	}
+
+	return nil
+}
+
+// SendWithDeadline writes to a channel tracking deadlines a message which
+// expires at deadline.
+func (c *Conveyer[T]) SendWithDeadline(ctx context.Context, name string, data T, deadline time.Time) error {
+	channel, state, err := c.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	if state.expiry.Load() == nil {
+		return fmt.Errorf("%w: %q", ErrNoDeadlines, name)
+	}
+
+	return sendExpiring(ctx, channel, data, deadline, state)
+}
+
+// SendTTL writes to a channel tracking deadlines a message which expires ttl
+// from now on the conveyer clock.
+func (c *Conveyer[T]) SendTTL(ctx context.Context, name string, data T, ttl time.Duration) error {
+	c.mu.Lock()
+	clock := c.clock
+	c.mu.Unlock()
+
+	return c.SendWithDeadline(ctx, name, data, clock.Now().Add(ttl))
+}
+
+// expiryQueue holds the deadlines of the messages in a channel, in their
+// order. Writers take turns, so a deadline and its message go in together.
+type expiryQueue struct {
+	turn      chan struct{}
+	mu        sync.Mutex
+	deadlines []time.Time
+}
+
+func (q *expiryQueue) lock(ctx context.Context, closing <-chan struct{}) error {
+	select {
+	case q.turn <- struct{}{}:
+		return nil
+	case <-closing:
+		return ErrChanClosed
+	case <-ctx.Done():
+		return fmt.Errorf("send: %w", ctx.Err())
+	}
+}
+
+func (q *expiryQueue) unlock() {
+	<-q.turn
+}
+
+func (q *expiryQueue) add(deadline time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deadlines = append(q.deadlines, deadline)
+}
+
+func (q *expiryQueue) removeLast() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deadlines = q.deadlines[:len(q.deadlines)-1]
+}
+
+// take returns the deadline of the message taken from the channel.
+func (q *expiryQueue) take() time.Time {
+	if q == nil {
+		return time.Time{}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.deadlines) == 0 {
+		return time.Time{}
+	}
+
+	deadline := q.deadlines[0]
+	q.deadlines = q.deadlines[1:]
+
+	return deadline
+}
+
+func (q *expiryQueue) clear() {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deadlines = nil
+}
+
+func deadlineOf[T any](item T) (time.Time, bool) {
+	message, ok := any(item).(expiring)
+	if !ok || isNilPointer(item) || message.deadline().IsZero() {
+		return time.Time{}, false
+	}
+
+	return message.deadline(), true
+}
+
+// deadlineOf is the deadline of a message the stage handles: the one it
+// carries, or else the one the message the stage took last was sent with.
+func (r *stageRuntime[T]) deadlineOf(item T) (time.Time, bool) {
+	if deadline, ok := deadlineOf(item); ok {
+		return deadline, true
+	}
+
+	if r == nil || r.holding == nil {
+		return time.Time{}, false
+	}
+
+	r.holding.mu.Lock()
+	defer r.holding.mu.Unlock()
+
+	// A stage holding several messages has no single one the item stems from.
+	if r.holding.kept {
+		return time.Time{}, false
+	}
+
+	return r.holding.deadline, !r.holding.deadline.IsZero()
+}
+
+// expired reports whether the deadline of a message has passed and counts the
+// drop against the stage.
+func (r *stageRuntime[T]) expired(ctx context.Context, deadline time.Time, ok bool) bool {
+	if !ok || ClockOf(ctx).Now().Before(deadline) {
+		return false
+	}
+
+	if r != nil {
+		r.stage.stats.expired.Add(1)
+	}
+
+	return true
+}
+
+// dropped is expired for a message the stage takes: an ordered worker is done
+// with it as if it was handled.
+func (r *stageRuntime[T]) dropped(ctx context.Context, next queued[T]) bool {
+	deadline, ok := deadlineOf(next.item)
+	if !ok && !next.deadline.IsZero() {
+		deadline, ok = next.deadline, true
+	}
+
+	if !r.expired(ctx, deadline, ok) {
+		return false
+	}
+
+	if r != nil && r.slot != nil {
+		r.slot.finish(ctx)
+	}
+
+	return true
+}
+
+// inheritedDeadline is the deadline of the message handled under ctx, which
+// what the stage emits for it keeps.
+func inheritedDeadline(ctx context.Context) time.Time {
+	deadline, _ := ctx.Value(messageDeadlineKey{}).(time.Time)
+
+	return deadline
+}
+
+// messageContext bounds the handling of one message by its deadline.
+func messageContext(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, messageDeadlineKey{}, deadline)
+
+	clock := ClockOf(ctx)
+	if _, ok := clock.(systemClock); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+
+	messageCtx, cancel := context.WithCancelCause(ctx)
+	timer := clock.NewTimer(deadline.Sub(clock.Now()))
+
+	go func() {
+		select {
+		case <-timer.C():
+			cancel(context.DeadlineExceeded)
+		case <-messageCtx.Done():
+			timer.Stop()
+		}
+	}()
+
+	return messageCtx, func() { cancel(context.Canceled) }
+}
+
+// deadlineExceeded tells a message that ran out of time from a stage which
+// is being stopped.
+func deadlineExceeded(ctx context.Context, messageCtx context.Context) bool {
+	return ctx.Err() == nil && errors.Is(context.Cause(messageCtx), context.DeadlineExceeded)
+}
@@ -0,0 +1,157 @@
+package conveyer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/conveyertest"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func TestExpiredMessagesAreDropped(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[conveyer.Envelope[string]](4)
+	conv.RegisterDecorator(handlers.EnvelopePrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	harness := conveyertest.New(t, conv)
+
+	harness.Send("input",
+		conveyer.Wrap("stale", conveyer.WithDeadline(conveyertest.Epoch.Add(-time.Second))),
+		conveyer.Wrap("fresh", conveyer.WithDeadline(conveyertest.Epoch.Add(time.Minute))),
+		conveyer.Wrap("forever"),
+	)
+	harness.WaitFor("output", 2)
+
+	payloads := make([]string, 0, 2)
+	for _, envelope := range harness.Outputs()["output"] {
+		payloads = append(payloads, envelope.Payload)
+	}
+
+	assert.Equal(t, []string{"decorated: fresh", "decorated: forever"}, payloads)
+	assert.Equal(t, uint64(1), conv.Stats().Stages[0].Expired)
+	assert.Equal(t, uint64(2), conv.Stats().Stages[0].Processed)
+}
+
+func TestHandlerContextEndsAtDeadline(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[conveyer.Envelope[string]](1)
+	conv.RegisterDecorator(func(
+		ctx context.Context,
+		input chan conveyer.Envelope[string],
+		output chan conveyer.Envelope[string],
+	) error {
+		for {
+			item, ok := conveyer.Next(ctx, input)
+			if !ok {
+				return nil
+			}
+
+			err := conveyer.Process(ctx, item, func(ctx context.Context, item conveyer.Envelope[string]) error {
+				<-ctx.Done()
+
+				return ctx.Err()
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	harness := conveyertest.New(t, conv)
+
+	harness.Send("input", conveyer.Wrap("slow").WithDeadline(conveyertest.Epoch.Add(time.Minute)))
+	harness.Advance(time.Minute, 1)
+
+	require.Eventually(t, func() bool {
+		return conv.Stats().Stages[0].Expired == 1
+	}, time.Second, time.Millisecond)
+
+	assert.Zero(t, conv.Stats().Stages[0].Errors)
+	require.NoError(t, harness.Stop(), "an expired message does not fail the stage")
+}
+
+func TestWrapWithTTL(t *testing.T) {
+	t.Parallel()
+
+	envelope := conveyer.Wrap("payload", conveyer.WithTTL(time.Second))
+	assert.Equal(t, envelope.CreatedAt.Add(time.Second), envelope.Deadline)
+	assert.True(t, conveyer.Wrap("payload").Deadline.IsZero())
+
+	clock := conveyertest.NewClock(conveyertest.Epoch)
+	envelope = conveyer.Wrap("payload", conveyer.WithTTL(time.Second), conveyer.WithClock(clock))
+	assert.Equal(t, conveyertest.Epoch, envelope.CreatedAt)
+	assert.Equal(t, conveyertest.Epoch.Add(time.Second), envelope.Deadline)
+}
+
+func TestTTLExpiresOnConveyerClock(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[conveyer.Envelope[string]](4)
+	conv.TrackLineage(4)
+	conv.RegisterDecorator(handlers.EnvelopePrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	harness := conveyertest.New(t, conv)
+	clock := harness.Clock()
+
+	stale := conveyer.Wrap("stale", conveyer.WithClock(clock), conveyer.WithTTL(time.Second))
+	harness.Advance(time.Minute, 0)
+
+	fresh := conveyer.Wrap("fresh", conveyer.WithClock(clock), conveyer.WithTTL(time.Second))
+	harness.Send("input", stale, fresh)
+	harness.WaitFor("output", 1)
+
+	assert.Equal(t, "decorated: fresh", harness.Outputs()["output"][0].Payload)
+	assert.Equal(t, uint64(1), conv.Stats().Stages[0].Expired)
+
+	hops, ok := conv.Lineage(fresh.ID)
+	require.True(t, ok)
+	assert.Equal(t, conveyertest.Epoch.Add(time.Minute), hops[0].Time, "hops are stamped on the conveyer clock")
+}
+
+func TestTrackedDeadlinesExpireAnyPayload(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := conveyertest.NewClock(conveyertest.Epoch)
+
+	conv := conveyer.New(4)
+	conv.SetClock(clock)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+	require.NoError(t, conv.TrackDeadlines("input"))
+
+	require.ErrorIs(t, conv.SendTTL(ctx, "output", "a", time.Second), conveyer.ErrNoDeadlines)
+
+	require.NoError(t, conv.SendTTL(ctx, "input", "stale", time.Second))
+	clock.Advance(time.Minute)
+	require.NoError(t, conv.SendTTL(ctx, "input", "fresh", time.Second))
+	require.NoError(t, conv.Send("input", "plain"))
+
+	_, done := startConveyer(t, conv)
+
+	for _, want := range []string{"decorated: fresh", "decorated: plain"} {
+		res, err := conv.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	}
+
+	assert.Equal(t, uint64(1), conv.Stats().Stages[0].Expired)
+
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+	require.ErrorIs(t, conv.MakeDurable("input", t.TempDir(), conveyer.StringCodec{}), conveyer.ErrDurableDeadlines)
+}
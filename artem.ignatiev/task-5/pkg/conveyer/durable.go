@@ -0,0 +1,300 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/kryjkaqq/task-5/pkg/segmentlog"
+)
+
+var ErrAlreadyDurable = errors.New("chan is already durable")
+
+type durable[T any] struct {
+	log   *segmentlog.Log
+	codec Codec[T]
+}
+
+type durableConfig struct {
+	sync segmentlog.SyncPolicy
+}
+
+type DurableOption func(config *durableConfig)
+
+// WithSync sets when the log of a durable channel is flushed to stable storage,
+// segmentlog.SyncOnCommit by default.
+func WithSync(policy segmentlog.SyncPolicy) DurableOption {
+	return func(config *durableConfig) {
+		config.sync = policy
+	}
+}
+
+// MakeDurable backs a channel with a segment log in dir. Writes are appended
+// to the log and never block. A message counts as consumed once it is
+// handled: when Recv returns it, when the stage worker which got it asks for
+// the next one or returns without error, or when its Delivery is acknowledged.
+// Stages must take from a durable channel with Next, TryNext or NextAny;
+// messages read from it directly are never consumed. Messages not consumed
+// when the process stops are replayed by the next Run, also after a crash, so
+// a stage may see a message again. A failed commit of
+// consumed messages is counted in CommitErrors and fails the run.
+func (c *Conveyer[T]) MakeDurable(name string, dir string, codec Codec[T], opts ...DurableOption) error {
+	config := durableConfig{sync: segmentlog.SyncOnCommit}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.getOrMakeChanLocked(name)
+	state := c.chanState[name]
+
+	if state.durable != nil {
+		return fmt.Errorf("%w: %q", ErrAlreadyDurable, name)
+	}
+
+	if state.expiry.Load() != nil {
+		return fmt.Errorf("%w: %q", ErrDurableDeadlines, name)
+	}
+
+	log, err := segmentlog.Open(dir, segmentlog.DefaultSegmentSize)
+	if err != nil {
+		return fmt.Errorf("open durable chan %q: %w", name, err)
+	}
+
+	log.SetSync(config.sync)
+
+	state.durable = &durable[T]{log: log, codec: codec}
+	state.log = log
+	state.ledger = &ledger{
+		reading: make(chan struct{}, 1),
+		log:     log,
+		handled: make(map[uint64]struct{}),
+		stats:   &state.stats,
+	}
+	c.startPumpLocked(name)
+
+	return nil
+}
+
+// Close releases the logs of durable channels.
+func (c *Conveyer[T]) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+
+	for _, name := range c.channelsKey {
+		if log := c.chanState[name].log; log != nil {
+			errs = append(errs, log.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d *durable[T]) append(item T, state *channelState) error {
+	data, err := d.codec.Encode(item)
+	if err != nil {
+		return fmt.Errorf("encode durable message: %w", err)
+	}
+
+	if _, err := d.log.Append(data); err != nil {
+		return fmt.Errorf("append durable message: %w", err)
+	}
+
+	sent(state, item)
+
+	return nil
+}
+
+// pump feeds the channel from the log, starting at the first unconsumed record.
+func (d *durable[T]) pump(ctx context.Context, channel chan T) error {
+	reader := d.log.NewReader(d.log.Committed())
+	defer reader.Close()
+
+	for {
+		wait := d.log.Wait()
+
+		data, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("replay durable chan: %w", err)
+		}
+
+		item, err := d.codec.Decode(data)
+		if err != nil {
+			return fmt.Errorf("decode durable message: %w", err)
+		}
+
+		select {
+		case channel <- item:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// startPumpLocked replays a durable channel during the current run.
+func (c *Conveyer[T]) startPumpLocked(name string) {
+	backing, ok := c.chanState[name].durable.(*durable[T])
+	if !ok || c.running == nil {
+		return
+	}
+
+	channel, running := c.channels[name], c.running
+	c.chanState[name].ledger.reset(func(err error) {
+		running.group.fail(fmt.Errorf("durable chan %q: %w", name, err))
+	})
+
+	running.pumps.Add(1)
+
+	go func() {
+		defer running.pumps.Done()
+
+		if err := backing.pump(running.pumpCtx, channel); err != nil {
+			running.group.fail(err)
+		}
+	}()
+}
+
+// record is the log offset of a message taken from a durable channel. epoch
+// tells apart the records of an earlier run, which are replayed.
+type record struct {
+	offset uint64
+	epoch  uint64
+}
+
+// ledger numbers the messages taken from a durable channel and commits the
+// log up to the first one not handled yet. Readers take turns, so messages
+// leave the channel in log order.
+type ledger struct {
+	reading chan struct{}
+	mu      sync.Mutex
+	log     *segmentlog.Log
+	epoch   uint64
+	next    uint64
+	first   uint64
+	handled map[uint64]struct{}
+	stats   *channelStats
+	report  func(err error)
+}
+
+// reset starts numbering at the first uncommitted record, where the pump
+// starts replaying. Commit errors of the run go to report.
+func (l *ledger) reset(report func(err error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.report = report
+	l.epoch++
+	l.first = l.log.Committed()
+	l.next = l.first
+	clear(l.handled)
+}
+
+func (l *ledger) lock(ctx context.Context, stop <-chan struct{}) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.reading <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("recv: %w", ctx.Err())
+	case <-stop:
+		return errStageStopping
+	}
+}
+
+// tryLock takes the turn if no other reader has it.
+func (l *ledger) tryLock() bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.reading <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *ledger) unlock() {
+	if l != nil {
+		<-l.reading
+	}
+}
+
+func (l *ledger) take() record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	taken := record{offset: l.next, epoch: l.epoch}
+	l.next++
+
+	return taken
+}
+
+// settle marks a record handled and commits the log up to the first one which
+// is not. A failed commit is counted and reported to the run; its records are
+// replayed by the next Run.
+func (l *ledger) settle(handled record) {
+	report, err := l.commitHandled(handled)
+	if err == nil {
+		return
+	}
+
+	l.stats.commitErrors.Add(1)
+
+	if report != nil {
+		report(err)
+	}
+}
+
+func (l *ledger) commitHandled(handled record) (func(err error), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if handled.epoch != l.epoch || handled.offset < l.first {
+		return nil, nil
+	}
+
+	l.handled[handled.offset] = struct{}{}
+
+	var count uint64
+
+	for {
+		if _, ok := l.handled[l.first]; !ok {
+			break
+		}
+
+		delete(l.handled, l.first)
+		l.first++
+		count++
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+
+	if err := l.log.Commit(count); err != nil {
+		return l.report, fmt.Errorf("commit consumed messages: %w", err)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,230 @@
+package conveyer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+	"github.com/kryjkaqq/task-5/pkg/segmentlog"
+)
+
+func durableConveyer(t *testing.T, inputDir, outputDir string) *conveyer.Conveyer[string] {
+	t.Helper()
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+	require.NoError(t, conv.MakeDurable("input", inputDir, conveyer.StringCodec{}))
+	require.NoError(t, conv.MakeDurable("output", outputDir, conveyer.StringCodec{}))
+
+	return conv
+}
+
+func TestDurableChannelReplaysMessagesInFlightAtCrash(t *testing.T) {
+	t.Parallel()
+
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	stuck := make(chan struct{})
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(func(ctx context.Context, input chan string, output chan string) error {
+		for {
+			item, ok := conveyer.Next(ctx, input)
+			if !ok {
+				return nil
+			}
+
+			if item == "c" {
+				close(stuck)
+				<-ctx.Done()
+
+				return ctx.Err()
+			}
+
+			conveyer.Emit(ctx, output, "decorated: "+item)
+		}
+	}, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+	require.NoError(t, conv.MakeDurable("input", inputDir, conveyer.StringCodec{}))
+	require.NoError(t, conv.MakeDurable("output", outputDir, conveyer.StringCodec{}))
+
+	for _, item := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	cancel, done := startConveyer(t, conv)
+
+	for _, want := range []string{"decorated: a", "decorated: b"} {
+		res, err := conv.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	}
+
+	// The process dies while the handler is in the middle of "c".
+	<-stuck
+	cancel()
+	<-done
+	require.NoError(t, conv.Close())
+
+	restarted := durableConveyer(t, inputDir, outputDir)
+
+	_, done = startConveyer(t, restarted)
+
+	for _, want := range []string{"decorated: c", "decorated: d", "decorated: e"} {
+		res, err := restarted.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	}
+
+	ctx, stop := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer stop()
+
+	_, err := restarted.RecvContext(ctx, "output")
+	require.ErrorIs(t, err, context.DeadlineExceeded, "handled inputs must not be replayed")
+
+	select {
+	case err := <-done:
+		t.Fatalf("conveyer stopped early: %v", err)
+	default:
+	}
+
+	require.NoError(t, restarted.Close())
+}
+
+func TestDurableInputReplaysMessagesNotEmittedAtStop(t *testing.T) {
+	t.Parallel()
+
+	inputDir := t.TempDir()
+
+	newConveyer := func() *conveyer.Conveyer[string] {
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+		require.NoError(t, conv.MakeDurable("input", inputDir, conveyer.StringCodec{}))
+
+		return conv
+	}
+
+	conv := newConveyer()
+
+	for _, item := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	_, done := startConveyer(t, conv)
+
+	// "a" fills the output and the decorator is stuck emitting "b".
+	require.Eventually(t, func() bool {
+		return conv.Stats().Channels[0].Received == 2
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+	require.NoError(t, conv.Close())
+
+	restarted := newConveyer()
+	_, _ = startConveyer(t, restarted)
+
+	for _, want := range []string{"decorated: b", "decorated: c", "decorated: d"} {
+		res, err := restarted.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	}
+
+	require.NoError(t, restarted.Close())
+}
+
+func TestDurableAckChannelReplaysUnacknowledged(t *testing.T) {
+	t.Parallel()
+
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+
+	conv := durableConveyer(t, inputDir, outputDir)
+	require.NoError(t, conv.SetAckTimeout("output", time.Hour))
+
+	for _, item := range []string{"a", "b"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	cancel, done := startConveyer(t, conv)
+
+	acked, err := conv.RecvDelivery("output")
+	require.NoError(t, err)
+	require.NoError(t, acked.Ack())
+
+	unacked, err := conv.RecvDelivery("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: b", unacked.Item)
+
+	cancel()
+	<-done
+	require.NoError(t, conv.Close())
+
+	restarted := durableConveyer(t, inputDir, outputDir)
+
+	_, _ = startConveyer(t, restarted)
+
+	res, err := restarted.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: b", res)
+	require.NoError(t, restarted.Close())
+}
+
+func TestDurableInputKeepsUnprocessedMessages(t *testing.T) {
+	t.Parallel()
+
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+
+	conv := durableConveyer(t, inputDir, outputDir)
+	require.NoError(t, conv.Send("input", "queued"))
+	require.NoError(t, conv.Close())
+
+	restarted := durableConveyer(t, inputDir, outputDir)
+
+	_, _ = startConveyer(t, restarted)
+
+	res, err := restarted.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: queued", res)
+
+	err = restarted.MakeDurable("input", inputDir, conveyer.StringCodec{})
+	require.ErrorIs(t, err, conveyer.ErrAlreadyDurable)
+}
+
+func TestDurableCommitErrorFailsRun(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+	require.NoError(t, conv.MakeDurable("output", t.TempDir(), conveyer.StringCodec{},
+		conveyer.WithSync(segmentlog.SyncNever)))
+
+	_, done := startConveyer(t, conv)
+
+	require.NoError(t, conv.Send("input", "a"))
+	require.Eventually(t, func() bool {
+		return conv.Stats().Channels[1].Depth == 1
+	}, time.Second, time.Millisecond)
+
+	// Closing the log under the running conveyer makes the commit fail.
+	require.NoError(t, conv.Close())
+
+	res, err := conv.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: a", res)
+
+	err = <-done
+	require.ErrorIs(t, err, segmentlog.ErrClosed)
+	assert.Contains(t, err.Error(), `durable chan "output"`)
+	assert.Equal(t, uint64(1), conv.Stats().Channels[1].CommitErrors)
+}
@@ -0,0 +1,247 @@
+package conveyer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+const envelopeIDSize = 16
+
+// Envelope carries a payload together with the metadata needed to follow it
+// through the pipeline. Run a Conveyer[Envelope[P]] to get stages stamped and
+// expired envelopes dropped. A zero Deadline never expires. Messages of other
+// types get a deadline on channels which track them, see TrackDeadlines.
+type Envelope[P any] struct {
+	ID        string
+	Headers   map[string]string
+	CreatedAt time.Time
+	Deadline  time.Time
+	Stages    []string
+	Payload   P
+}
+
+type envelopeMeta struct {
+	headers  map[string]string
+	deadline time.Time
+	ttl      time.Duration
+	clock    Clock
+}
+
+type EnvelopeOption func(meta *envelopeMeta)
+
+func WithHeader(key string, value string) EnvelopeOption {
+	return func(meta *envelopeMeta) {
+		meta.headers[key] = value
+	}
+}
+
+// WithDeadline makes the envelope expire at deadline.
+func WithDeadline(deadline time.Time) EnvelopeOption {
+	return func(meta *envelopeMeta) {
+		meta.deadline, meta.ttl = deadline, 0
+	}
+}
+
+// WithTTL makes the envelope expire ttl after it is wrapped.
+func WithTTL(ttl time.Duration) EnvelopeOption {
+	return func(meta *envelopeMeta) {
+		meta.ttl = ttl
+	}
+}
+
+// WithClock takes the creation time, and the start of the TTL, from clock
+// instead of the wall clock. Pass the clock set with SetClock to have stages
+// expire the envelope in the same time.
+func WithClock(clock Clock) EnvelopeOption {
+	return func(meta *envelopeMeta) {
+		meta.clock = clock
+	}
+}
+
+// Wrap puts a payload into a new envelope with a random ID.
+func Wrap[P any](payload P, opts ...EnvelopeOption) Envelope[P] {
+	meta := envelopeMeta{headers: make(map[string]string), deadline: time.Time{}, ttl: 0, clock: SystemClock()}
+
+	for _, opt := range opts {
+		opt(&meta)
+	}
+
+	now := meta.clock.Now()
+	if meta.ttl != 0 {
+		meta.deadline = now.Add(meta.ttl)
+	}
+
+	return Envelope[P]{
+		ID:        newEnvelopeID(),
+		Headers:   meta.headers,
+		CreatedAt: now,
+		Deadline:  meta.deadline,
+		Stages:    nil,
+		Payload:   payload,
+	}
+}
+
+// WithPayload returns a copy of the envelope carrying another payload.
+func (e Envelope[P]) WithPayload(payload P) Envelope[P] {
+	e.Payload = payload
+
+	return e
+}
+
+// WithHeader returns a copy of the envelope with the header set.
+func (e Envelope[P]) WithHeader(key string, value string) Envelope[P] {
+	e.Headers = maps.Clone(e.Headers)
+	if e.Headers == nil {
+		e.Headers = make(map[string]string)
+	}
+
+	e.Headers[key] = value
+
+	return e
+}
+
+// WithDeadline returns a copy of the envelope expiring at deadline.
+func (e Envelope[P]) WithDeadline(deadline time.Time) Envelope[P] {
+	e.Deadline = deadline
+
+	return e
+}
+
+func (e Envelope[P]) deadline() time.Time {
+	return e.Deadline
+}
+
+func (e Envelope[P]) envelopeID() string {
+	return e.ID
+}
+
+func (e Envelope[P]) visit(stage string) traced {
+	e.Stages = append(slices.Clip(e.Stages), stage)
+
+	return e
+}
+
+func (e Envelope[P]) pointer() any {
+	return &e
+}
+
+// isNilPointer reports a nil *Envelope, whose methods cannot be called.
+func isNilPointer(item any) bool {
+	value := reflect.ValueOf(item)
+
+	return value.Kind() == reflect.Pointer && value.IsNil()
+}
+
+type traced interface {
+	envelopeID() string
+	visit(stage string) traced
+	pointer() any
+}
+
+func newEnvelopeID() string {
+	buf := make([]byte, envelopeIDSize)
+	_, _ = rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
+
+// Hop is one stage an envelope went through.
+type Hop struct {
+	Stage string
+	Kind  StageKind
+	Time  time.Time
+}
+
+type lineage struct {
+	mu    sync.Mutex
+	limit int
+	order []string
+	hops  map[string][]Hop
+}
+
+func (l *lineage) record(id string, hop Hop) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.hops[id]; !ok {
+		if len(l.order) >= l.limit {
+			delete(l.hops, l.order[0])
+			l.order = l.order[1:]
+		}
+
+		l.order = append(l.order, id)
+	}
+
+	l.hops[id] = append(l.hops[id], hop)
+}
+
+// TrackLineage remembers the hops of the last limit envelopes for Lineage.
+func (c *Conveyer[T]) TrackLineage(limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lineage = &lineage{
+		mu:    sync.Mutex{},
+		limit: max(limit, 1),
+		order: make([]string, 0, limit),
+		hops:  make(map[string][]Hop),
+	}
+}
+
+// Lineage returns the stages an envelope passed, oldest first.
+func (c *Conveyer[T]) Lineage(id string) ([]Hop, bool) {
+	c.mu.Lock()
+	tracker := c.lineage
+	c.mu.Unlock()
+
+	if tracker == nil {
+		return nil, false
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	hops, ok := tracker.hops[id]
+
+	return slices.Clone(hops), ok
+}
+
+// stamp records the current stage in an envelope, passed as Envelope or as
+// *Envelope, at the time of the conveyer clock. The stamped copy keeps the form
+// of item; a pointer is never written through.
+func (r *stageRuntime[T]) stamp(ctx context.Context, item T) T {
+	envelope, ok := any(item).(traced)
+	if !ok {
+		return item
+	}
+
+	if isNilPointer(item) {
+		return item
+	}
+
+	if r.lineage != nil {
+		r.lineage.record(envelope.envelopeID(), Hop{
+			Stage: r.stage.name,
+			Kind:  r.stage.kind,
+			Time:  ClockOf(ctx).Now(),
+		})
+	}
+
+	visited := envelope.visit(r.stage.name)
+
+	if stamped, ok := visited.(T); ok {
+		return stamped
+	}
+
+	if stamped, ok := visited.pointer().(T); ok {
+		return stamped
+	}
+
+	return item
+}
@@ -0,0 +1,154 @@
+package conveyer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func TestEnvelopeLineage(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[conveyer.Envelope[string]](4)
+	conv.TrackLineage(16)
+	conv.RegisterDecorator(handlers.EnvelopePrefixDecoratorFunc, "input", "decorated")
+	conv.RegisterSeparator(handlers.EnvelopeSeparatorFunc, "decorated", []string{"part1", "part2"})
+	conv.RegisterMultiplexer(handlers.EnvelopeMultiplexerFunc, []string{"part1", "part2"}, "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	first := conveyer.Wrap("hello", conveyer.WithHeader("tenant", "acme"))
+	second := conveyer.Wrap("world")
+
+	require.NotEqual(t, first.ID, second.ID)
+	require.NoError(t, conv.Send("input", first))
+	require.NoError(t, conv.Send("input", second))
+
+	received := make(map[string]conveyer.Envelope[string])
+
+	for range 2 {
+		envelope, err := conv.Recv("output")
+		require.NoError(t, err)
+
+		received[envelope.ID] = envelope
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+
+	out, ok := received[first.ID]
+	require.True(t, ok)
+	assert.Equal(t, "decorated: hello", out.Payload)
+	assert.Equal(t, "acme", out.Headers["tenant"])
+	assert.Equal(t, first.CreatedAt, out.CreatedAt)
+	assert.Equal(t, []string{
+		"handlers.EnvelopePrefixDecoratorFunc",
+		"handlers.EnvelopeSeparatorFunc",
+		"handlers.EnvelopeMultiplexerFunc",
+	}, out.Stages)
+	assert.Equal(t, "decorated: world", received[second.ID].Payload)
+
+	hops, ok := conv.Lineage(first.ID)
+	require.True(t, ok)
+	require.Len(t, hops, 3)
+	assert.Equal(t, conveyer.KindDecorator, hops[0].Kind)
+	assert.Equal(t, conveyer.KindSeparator, hops[1].Kind)
+	assert.Equal(t, conveyer.KindMultiplexer, hops[2].Kind)
+	assert.False(t, hops[2].Time.Before(hops[0].Time))
+
+	_, ok = conv.Lineage("unknown")
+	assert.False(t, ok)
+}
+
+func TestEnvelopeCopies(t *testing.T) {
+	t.Parallel()
+
+	original := conveyer.Wrap(1, conveyer.WithHeader("a", "1"))
+	changed := original.WithHeader("a", "2").WithPayload(2)
+
+	assert.Equal(t, "1", original.Headers["a"])
+	assert.Equal(t, "2", changed.Headers["a"])
+	assert.Equal(t, 1, original.Payload)
+	assert.Equal(t, original.ID, changed.ID)
+}
+
+func TestLineageLimit(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[conveyer.Envelope[int]](4)
+	conv.TrackLineage(1)
+	conv.RegisterDecorator(handlers.NewDecorator(handlers.OnPayload(func(item int) (int, error) {
+		return item + 1, nil
+	})), "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	first, second := conveyer.Wrap(1), conveyer.Wrap(2)
+
+	for _, envelope := range []conveyer.Envelope[int]{first, second} {
+		require.NoError(t, conv.Send("input", envelope))
+
+		out, err := conv.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, envelope.Payload+1, out.Payload)
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+
+	_, ok := conv.Lineage(first.ID)
+	assert.False(t, ok)
+
+	_, ok = conv.Lineage(second.ID)
+	assert.True(t, ok)
+}
+
+func TestEnvelopePointerPayload(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[*conveyer.Envelope[string]](2)
+	conv.TrackLineage(4)
+	conv.RegisterDecorator(handlers.NewDecorator(func(envelope *conveyer.Envelope[string]) (*conveyer.Envelope[string], error) {
+		if envelope == nil {
+			return nil, nil
+		}
+
+		decorated := envelope.WithPayload("decorated: " + envelope.Payload)
+
+		return &decorated, nil
+	}), "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	sent := conveyer.Wrap("hello")
+	require.NoError(t, conv.Send("input", &sent))
+	require.NoError(t, conv.Send("input", nil))
+
+	out, err := conv.Recv("output")
+	require.NoError(t, err)
+	require.NotNil(t, out)
+	assert.Equal(t, "decorated: hello", out.Payload)
+	assert.Len(t, out.Stages, 1)
+	assert.Empty(t, sent.Stages, "the sent envelope is not written through")
+
+	out, err = conv.Recv("output")
+	require.NoError(t, err)
+	assert.Nil(t, out)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	hops, ok := conv.Lineage(sent.ID)
+	require.True(t, ok)
+	assert.Len(t, hops, 1)
+}
@@ -0,0 +1,181 @@
+package conveyer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+type ExportFormat string
+
+const (
+	FormatDOT     ExportFormat = "dot"
+	FormatMermaid ExportFormat = "mermaid"
+)
+
+type graphNode struct {
+	id       string
+	label    string
+	external bool
+}
+
+type graphEdge struct {
+	from   string
+	to     string
+	label  string
+	dashed bool
+}
+
+// Export renders the registered stages and their channels as a Graphviz DOT or
+// Mermaid flowchart. Edges carry the channel name, buffer size and current depth.
+func (c *Conveyer[T]) Export(format ExportFormat) (string, error) {
+	nodes, edges := c.graph()
+
+	switch format {
+	case FormatDOT:
+		return renderDOT(nodes, edges), nil
+	case FormatMermaid:
+		return renderMermaid(nodes, edges), nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+func (c *Conveyer[T]) graph() ([]graphNode, []graphEdge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	nodes := make([]graphNode, 0, len(c.stages)+len(c.channelsKey))
+	edges := make([]graphEdge, 0, len(c.channelsKey))
+	producers := make(map[string][]string)
+	consumers := make(map[string][]string)
+	sinks := make(map[string]string)
+
+	for idx, registered := range c.stages {
+		id := fmt.Sprintf("s%d", idx)
+		nodes = append(nodes, graphNode{
+			id:       id,
+			label:    fmt.Sprintf("%s\n%s", registered.kind, registered.name),
+			external: false,
+		})
+
+		for _, name := range registered.inputs {
+			consumers[name] = append(consumers[name], id)
+		}
+
+		for _, name := range registered.outputs {
+			producers[name] = append(producers[name], id)
+		}
+
+		if registered.config.policy.Action == ActionDeadLetter {
+			letters := registered.config.policy.DeadLetter
+
+			sink, ok := sinks[letters]
+			if !ok {
+				sink = fmt.Sprintf("dl%d", len(sinks))
+				sinks[letters] = sink
+				nodes = append(nodes, graphNode{id: sink, label: letters, external: true})
+			}
+
+			edges = append(edges, graphEdge{from: id, to: sink, label: "dead letters", dashed: true})
+		}
+	}
+
+	for idx, name := range c.channelsKey {
+		channel := c.channels[name]
+		label := fmt.Sprintf("%s [%d] depth %d", name, cap(channel), depthOf(channel, c.chanState[name]))
+
+		from, to := producers[name], consumers[name]
+
+		if len(from) == 0 {
+			id := fmt.Sprintf("in%d", idx)
+			nodes = append(nodes, graphNode{id: id, label: name, external: true})
+			from = []string{id}
+		}
+
+		if len(to) == 0 {
+			id := fmt.Sprintf("out%d", idx)
+			nodes = append(nodes, graphNode{id: id, label: name, external: true})
+			to = []string{id}
+		}
+
+		for _, producer := range from {
+			for _, consumer := range to {
+				edges = append(edges, graphEdge{from: producer, to: consumer, label: label, dashed: false})
+			}
+		}
+	}
+
+	return nodes, edges
+}
+
+func renderDOT(nodes []graphNode, edges []graphEdge) string {
+	var builder strings.Builder
+
+	builder.WriteString("digraph conveyer {\n\trankdir=LR;\n")
+
+	for _, node := range nodes {
+		shape := "box"
+		if node.external {
+			shape = "ellipse"
+		}
+
+		fmt.Fprintf(&builder, "\t%s [shape=%s, label=%s];\n", node.id, shape, quoteDOT(node.label))
+	}
+
+	for _, edge := range edges {
+		style := ""
+		if edge.dashed {
+			style = ", style=dashed"
+		}
+
+		fmt.Fprintf(&builder, "\t%s -> %s [label=%s%s];\n", edge.from, edge.to, quoteDOT(edge.label), style)
+	}
+
+	builder.WriteString("}\n")
+
+	return builder.String()
+}
+
+func renderMermaid(nodes []graphNode, edges []graphEdge) string {
+	var builder strings.Builder
+
+	builder.WriteString("flowchart LR\n")
+
+	for _, node := range nodes {
+		open, closing := "[", "]"
+		if node.external {
+			open, closing = "([", "])"
+		}
+
+		fmt.Fprintf(&builder, "    %s%s%s%s\n", node.id, open, quoteMermaid(node.label), closing)
+	}
+
+	for _, edge := range edges {
+		arrow := "-->"
+		if edge.dashed {
+			arrow = "-.->"
+		}
+
+		fmt.Fprintf(&builder, "    %s %s|%s| %s\n", edge.from, arrow, quoteMermaid(edge.label), edge.to)
+	}
+
+	return builder.String()
+}
+
+func quoteDOT(label string) string {
+	label = strings.ReplaceAll(label, `\`, `\\`)
+	label = strings.ReplaceAll(label, `"`, `\"`)
+	label = strings.ReplaceAll(label, "\n", `\n`)
+
+	return `"` + label + `"`
+}
+
+func quoteMermaid(label string) string {
+	label = strings.ReplaceAll(label, `"`, "#quot;")
+	label = strings.ReplaceAll(label, "\n", "<br/>")
+
+	return `"` + label + `"`
+}
@@ -0,0 +1,83 @@
+package conveyer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func demoConveyer() *conveyer.Conveyer[string] {
+	conv := conveyer.New(5)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated",
+		conveyer.WithErrorPolicy(conveyer.DeadLetterPolicy("failed")))
+	conv.RegisterSeparator(handlers.SeparatorFunc, "decorated", []string{"part1", "part2"})
+	conv.RegisterMultiplexer(handlers.MultiplexerFunc, []string{"part1", "part2"}, "final_output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("final_output")
+
+	return conv
+}
+
+func TestExportDOT(t *testing.T) {
+	t.Parallel()
+
+	conv := demoConveyer()
+	require.NoError(t, conv.Send("input", "queued"))
+
+	dot, err := conv.Export(conveyer.FormatDOT)
+	require.NoError(t, err)
+
+	assert.Contains(t, dot, "digraph conveyer {")
+	assert.Contains(t, dot, `s0 [shape=box, label="decorator\nhandlers.PrefixDecoratorFunc"];`)
+	assert.Contains(t, dot, `in0 [shape=ellipse, label="input"];`)
+	assert.Contains(t, dot, `in0 -> s0 [label="input [5] depth 1"];`)
+	assert.Contains(t, dot, `s0 -> s1 [label="decorated [5] depth 0"];`)
+	assert.Contains(t, dot, `s1 -> s2 [label="part1 [5] depth 0"];`)
+	assert.Contains(t, dot, `s1 -> s2 [label="part2 [5] depth 0"];`)
+	assert.Contains(t, dot, `s2 -> out4 [label="final_output [5] depth 0"];`)
+	assert.Contains(t, dot, `dl0 [shape=ellipse, label="failed"];`)
+	assert.Contains(t, dot, `s0 -> dl0 [label="dead letters", style=dashed];`)
+}
+
+func TestExportMermaid(t *testing.T) {
+	t.Parallel()
+
+	mermaid, err := demoConveyer().Export(conveyer.FormatMermaid)
+	require.NoError(t, err)
+
+	assert.Contains(t, mermaid, "flowchart LR\n")
+	assert.Contains(t, mermaid, `    s1["separator<br/>handlers.SeparatorFunc"]`)
+	assert.Contains(t, mermaid, `    out4(["final_output"])`)
+	assert.Contains(t, mermaid, `    s0 -->|"decorated [5] depth 0"| s1`)
+	assert.Contains(t, mermaid, `    s0 -.->|"dead letters"| dl0`)
+
+	_, err = demoConveyer().Export("svg")
+	require.ErrorIs(t, err, conveyer.ErrUnknownFormat)
+}
+
+func TestExportDeadLetterNodes(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "a",
+		conveyer.WithErrorPolicy(conveyer.DeadLetterPolicy("failed-a")))
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "a", "b",
+		conveyer.WithErrorPolicy(conveyer.DeadLetterPolicy("failed_a")))
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "b", "output",
+		conveyer.WithErrorPolicy(conveyer.DeadLetterPolicy("failed-a")))
+
+	dot, err := conv.Export(conveyer.FormatDOT)
+	require.NoError(t, err)
+
+	assert.Contains(t, dot, `dl0 [shape=ellipse, label="failed-a"];`)
+	assert.Contains(t, dot, `dl1 [shape=ellipse, label="failed_a"];`)
+	assert.Equal(t, 1, strings.Count(dot, `label="failed-a"`), "a shared dead-letter channel is one node")
+	assert.Contains(t, dot, `s0 -> dl0 [label="dead letters", style=dashed];`)
+	assert.Contains(t, dot, `s1 -> dl1 [label="dead letters", style=dashed];`)
+	assert.Contains(t, dot, `s2 -> dl0 [label="dead letters", style=dashed];`)
+}
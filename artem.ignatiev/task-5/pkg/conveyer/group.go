@@ -0,0 +1,114 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// runGroup is an errgroup which accepts new goroutines while it runs, so
+// stages can be added to a running conveyer. It finishes once nothing is left.
+type runGroup struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	mu      sync.Mutex
+	pending int
+	done    bool
+	idle    chan struct{}
+	errs    []error
+}
+
+func newRunGroup(ctx context.Context) *runGroup {
+	groupCtx, cancel := context.WithCancelCause(ctx)
+
+	return &runGroup{
+		ctx:     groupCtx,
+		cancel:  cancel,
+		mu:      sync.Mutex{},
+		pending: 0,
+		done:    false,
+		idle:    make(chan struct{}),
+		errs:    nil,
+	}
+}
+
+// Go starts fn unless the group has already finished. The first error cancels
+// the group; the cancellations which follow from it are not errors.
+func (g *runGroup) Go(fn func() error) bool {
+	if !g.hold() {
+		return false
+	}
+
+	go func() {
+		defer g.release()
+
+		if err := fn(); err != nil {
+			g.fail(err)
+		}
+	}()
+
+	return true
+}
+
+// hold keeps the group running until release, like a goroutine would.
+func (g *runGroup) hold() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.done {
+		return false
+	}
+
+	g.pending++
+
+	return true
+}
+
+func (g *runGroup) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.pending--
+	g.finishLocked()
+}
+
+func (g *runGroup) finishLocked() {
+	if g.pending == 0 && !g.done {
+		g.done = true
+		close(g.idle)
+	}
+}
+
+func (g *runGroup) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if len(g.errs) == 0 {
+		g.cancel(err)
+	}
+
+	g.errs = append(g.errs, err)
+}
+
+func (g *runGroup) Wait() error {
+	g.mu.Lock()
+	g.finishLocked()
+	g.mu.Unlock()
+
+	<-g.idle
+	g.cancel(context.Canceled)
+
+	return g.Err()
+}
+
+// Err joins every error, including ones recorded after Wait returned.
+func (g *runGroup) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return errors.Join(g.errs...)
+}
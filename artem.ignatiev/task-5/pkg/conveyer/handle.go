@@ -0,0 +1,147 @@
+package conveyer
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+type channelRef[T any] struct {
+	channel chan T
+	state   *channelState
+}
+
+// channelSnapshot is the channel map of a running conveyer. It is never
+// modified; a change of channels publishes a new one. Lookups read it without
+// the conveyer mutex, but a send still takes the read lock of its channel.
+type channelSnapshot[T any] map[string]channelRef[T]
+
+// publishLocked replaces the snapshot read by lookups while running.
+func (c *Conveyer[T]) publishLocked() {
+	if c.running == nil {
+		return
+	}
+
+	snapshot := make(channelSnapshot[T], len(c.channels))
+
+	for name, channel := range c.channels {
+		snapshot[name] = channelRef[T]{channel: channel, state: c.chanState[name]}
+	}
+
+	c.snapshot.Store(&snapshot)
+}
+
+func (c *Conveyer[T]) lookup(name string) (chan T, *channelState, error) {
+	if snapshot := c.snapshot.Load(); snapshot != nil {
+		ref, ok := (*snapshot)[name]
+		if !ok {
+			return nil, nil, ErrChanNotFound
+		}
+
+		return ref.channel, ref.state, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channel, ok := c.channels[name]
+	if !ok {
+		return nil, nil, ErrChanNotFound
+	}
+
+	return channel, c.chanState[name], nil
+}
+
+type resolved[T any] struct {
+	snapshot *channelSnapshot[T]
+	ref      channelRef[T]
+}
+
+// handle caches the channel of a name for the current snapshot.
+type handle[T any] struct {
+	conv   *Conveyer[T]
+	name   string
+	cached atomic.Pointer[resolved[T]]
+}
+
+func (h *handle[T]) resolve() (channelRef[T], error) {
+	snapshot := h.conv.snapshot.Load()
+	if snapshot == nil {
+		channel, state, err := h.conv.lookup(h.name)
+
+		return channelRef[T]{channel: channel, state: state}, err
+	}
+
+	if cached := h.cached.Load(); cached != nil && cached.snapshot == snapshot {
+		return cached.ref, nil
+	}
+
+	ref, ok := (*snapshot)[h.name]
+	if !ok {
+		return ref, ErrChanNotFound
+	}
+
+	h.cached.Store(&resolved[T]{snapshot: snapshot, ref: ref})
+
+	return ref, nil
+}
+
+// Sender writes to one channel without looking it up by name on every call.
+// Each send takes the read lock of the channel like Conveyer.Send does.
+type Sender[T any] struct {
+	handle handle[T]
+}
+
+// Receiver reads from one channel without looking it up by name on every call.
+type Receiver[T any] struct {
+	handle handle[T]
+}
+
+// Input returns a sender for a channel. It stays valid across restarts and
+// reconfiguration, and fails with ErrChanNotFound once the channel is removed.
+func (c *Conveyer[T]) Input(name string) (*Sender[T], error) {
+	if _, _, err := c.lookup(name); err != nil {
+		return nil, fmt.Errorf("%w: %q", err, name)
+	}
+
+	return &Sender[T]{handle: handle[T]{conv: c, name: name}}, nil
+}
+
+// Output returns a receiver for a channel, like Input.
+func (c *Conveyer[T]) Output(name string) (*Receiver[T], error) {
+	if _, _, err := c.lookup(name); err != nil {
+		return nil, fmt.Errorf("%w: %q", err, name)
+	}
+
+	return &Receiver[T]{handle: handle[T]{conv: c, name: name}}, nil
+}
+
+func (s *Sender[T]) Send(item T) error {
+	return s.SendContext(context.Background(), item)
+}
+
+// SendContext has the semantics of Conveyer.SendContext.
+func (s *Sender[T]) SendContext(ctx context.Context, item T) error {
+	ref, err := s.handle.resolve()
+	if err != nil {
+		return err
+	}
+
+	return send(ctx, ref.channel, item, ref.state)
+}
+
+func (r *Receiver[T]) Recv() (T, error) {
+	return r.RecvContext(context.Background())
+}
+
+// RecvContext has the semantics of Conveyer.RecvContext.
+func (r *Receiver[T]) RecvContext(ctx context.Context) (T, error) {
+	ref, err := r.handle.resolve()
+	if err != nil {
+		var zero T
+
+		return zero, err
+	}
+
+	return receive(ctx, ref.channel, ref.state)
+}
@@ -0,0 +1,161 @@
+package conveyer_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func TestChannelHandles(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unknown channel", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+
+		_, err := conv.Input("missing")
+		require.ErrorIs(t, err, conveyer.ErrChanNotFound)
+
+		_, err = conv.Output("missing")
+		require.ErrorIs(t, err, conveyer.ErrChanNotFound)
+	})
+
+	t.Run("send and receive across restarts", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(4)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		input, err := conv.Input("input")
+		require.NoError(t, err)
+
+		output, err := conv.Output("output")
+		require.NoError(t, err)
+
+		for _, item := range []string{"a", "b"} {
+			cancel, done := startConveyer(t, conv)
+
+			require.Eventually(t, func() bool { return conv.State() == conveyer.StateRunning },
+				time.Second, time.Millisecond)
+			require.NoError(t, input.Send(item))
+
+			got, err := output.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, "decorated: "+item, got)
+
+			cancel()
+			require.NoError(t, <-done)
+		}
+	})
+
+	t.Run("channels added and removed while running", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(4)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		cancel, done := startConveyer(t, conv)
+		require.Eventually(t, func() bool { return conv.State() == conveyer.StateRunning },
+			time.Second, time.Millisecond)
+
+		conv.AddChannel("spare")
+
+		spare, err := conv.Output("spare")
+		require.NoError(t, err)
+		require.NoError(t, conv.Send("spare", "x"))
+
+		got, err := spare.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "x", got)
+
+		require.NoError(t, conv.RemoveChannel("spare"))
+
+		_, err = spare.Recv()
+		require.ErrorIs(t, err, conveyer.ErrChanNotFound)
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+}
+
+// contention is the number of goroutines per CPU hammering the channels.
+const contention = 64
+
+func benchmarkLookup(b *testing.B, running bool, handles bool) {
+	b.Helper()
+
+	conv := conveyer.New(contention * runtime.GOMAXPROCS(0))
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.AddChannel("bench")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	if running {
+		cancel, done := startConveyer(b, conv)
+
+		for conv.State() != conveyer.StateRunning {
+			runtime.Gosched()
+		}
+
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	send := func(item string) error { return conv.Send("bench", item) }
+	recv := func() (string, error) { return conv.Recv("bench") }
+
+	if handles {
+		input, err := conv.Input("bench")
+		require.NoError(b, err)
+
+		output, err := conv.Output("bench")
+		require.NoError(b, err)
+
+		send, recv = input.Send, output.Recv
+	}
+
+	b.SetParallelism(contention)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := send("item"); err != nil {
+				b.Error(err)
+
+				return
+			}
+
+			if _, err := recv(); err != nil {
+				b.Error(err)
+
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkLookupLocked resolves names under the conveyer mutex, as before Run.
+func BenchmarkLookupLocked(b *testing.B) {
+	benchmarkLookup(b, false, false)
+}
+
+func BenchmarkLookupSnapshot(b *testing.B) {
+	benchmarkLookup(b, true, false)
+}
+
+func BenchmarkLookupHandle(b *testing.B) {
+	benchmarkLookup(b, true, true)
+}
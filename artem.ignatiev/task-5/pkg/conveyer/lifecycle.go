@@ -0,0 +1,219 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrInvalidTransition = errors.New("invalid lifecycle transition")
+	ErrDurableInput      = errors.New("durable chan cannot be closed")
+)
+
+// State is where a conveyer is in its lifecycle. A conveyer starts Created,
+// is Running during Run, Draining after Drain and Stopped once Run returns.
+// A stopped conveyer can run again.
+type State int32
+
+const (
+	StateCreated State = iota
+	StateRunning
+	StateDraining
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateCreated:
+		return "created"
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("State(%d)", int32(s))
+	}
+}
+
+func (c *Conveyer[T]) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+func (c *Conveyer[T]) transitionError(action string) error {
+	return fmt.Errorf("%w: cannot %s a %s conveyer", ErrInvalidTransition, action, c.state)
+}
+
+// Drain stops intake and lets the running conveyer flush what it holds: the
+// channels nothing produces are closed, every stage finishes its inputs and
+// closes its outputs behind it, and Run returns once the last stage is done.
+// Drain waits for that; when ctx ends first the run is stopped instead.
+// Messages written to a durable channel while draining stay in its log for
+// the next run.
+func (c *Conveyer[T]) Drain(ctx context.Context) error {
+	c.mu.Lock()
+
+	running := c.running
+
+	switch c.state {
+	case StateRunning:
+		c.state = StateDraining
+		running.stopIntake()
+		running.stopPumps()
+		running.pumps.Wait()
+		c.propagateLocked()
+	case StateDraining:
+	case StateCreated, StateStopped:
+		err := c.transitionError("drain")
+		c.mu.Unlock()
+
+		return err
+	}
+
+	c.mu.Unlock()
+
+	select {
+	case <-running.finished:
+		return nil
+	case <-ctx.Done():
+		running.group.cancel(context.Canceled)
+		<-running.finished
+
+		return fmt.Errorf("drain: %w", ctx.Err())
+	}
+}
+
+// Stop cancels a running or draining conveyer and waits for Run to return.
+// Messages left in the channels are kept for the next run.
+func (c *Conveyer[T]) Stop() error {
+	c.mu.Lock()
+
+	running := c.running
+	if c.state != StateRunning && c.state != StateDraining {
+		err := c.transitionError("stop")
+		c.mu.Unlock()
+
+		return err
+	}
+
+	c.mu.Unlock()
+
+	running.group.cancel(context.Canceled)
+	<-running.finished
+
+	return nil
+}
+
+// CloseInput ends a channel no stage writes to, like the end of a source.
+// A stage whose inputs are all closed finishes what is left in them and its
+// outputs get closed in turn, so completion flows down the pipeline and Run
+// returns once every stage is done. Durable channels close with the run.
+func (c *Conveyer[T]) CloseInput(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channel, ok := c.channels[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrChanNotFound, name)
+	}
+
+	for _, registered := range c.stages {
+		if slices.Contains(registered.outputs, name) {
+			return fmt.Errorf("%w: %q is written by %q", ErrChanInUse, name, registered.name)
+		}
+	}
+
+	state := c.chanState[name]
+	if state.durable != nil {
+		return fmt.Errorf("%w: %q", ErrDurableInput, name)
+	}
+
+	closeChannel(channel, state)
+	c.propagateLocked()
+
+	return nil
+}
+
+// propagateLocked closes every channel whose producers have all completed.
+// A stage completes when it finishes after its inputs were closed, or at all
+// while draining; draining also closes the channels nothing produces.
+func (c *Conveyer[T]) propagateLocked() {
+	for _, name := range c.channelsKey {
+		state := c.chanState[name]
+		if state.isClosed() {
+			continue
+		}
+
+		producers, completed := 0, true
+
+		for _, registered := range c.stages {
+			if slices.Contains(registered.outputs, name) {
+				producers++
+				completed = completed && c.completedLocked(registered)
+			}
+		}
+
+		if completed && (producers > 0 || c.state == StateDraining) {
+			closeChannel(c.channels[name], state)
+		}
+	}
+}
+
+func (c *Conveyer[T]) completedLocked(registered *stage[T]) bool {
+	if registered.handle == nil || !registered.handle.finished {
+		return false
+	}
+
+	if c.state == StateDraining {
+		return true
+	}
+
+	for _, name := range registered.inputs {
+		if !c.chanState[name].isClosed() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reopenLocked gives a stopped conveyer fresh channels. Messages left in the
+// old ones move over, except on durable channels which replay their log.
+func (c *Conveyer[T]) reopenLocked() {
+	for _, name := range c.channelsKey {
+		state := c.chanState[name]
+
+		if state.durable != nil {
+			c.channels[name] = make(chan T, cap(c.channels[name]))
+			frontOf[T](state).take()
+		} else {
+			c.channels[name] = reopen(c.channels[name])
+		}
+
+		state.reopen()
+	}
+
+	for name, channel := range c.deadLetters {
+		c.deadLetters[name] = reopen(channel)
+	}
+
+	for _, registered := range c.stages {
+		registered.handle = nil
+	}
+}
+
+func reopen[T any](closed chan T) chan T {
+	channel := make(chan T, cap(closed))
+
+	for item := range closed {
+		channel <- item
+	}
+
+	return channel
+}
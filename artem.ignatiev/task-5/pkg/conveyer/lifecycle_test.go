@@ -0,0 +1,185 @@
+package conveyer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func lifecycleConveyer(size int) *conveyer.Conveyer[string] {
+	conv := conveyer.New(size)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated")
+	conv.RegisterSeparator(handlers.SeparatorFunc, "decorated", []string{"left", "right"})
+	conv.RegisterMultiplexer(handlers.MultiplexerFunc, []string{"left", "right"}, "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	return conv
+}
+
+func TestDrainFlushesInFlight(t *testing.T) {
+	t.Parallel()
+
+	conv := lifecycleConveyer(8)
+	assert.Equal(t, conveyer.StateCreated, conv.State())
+
+	_, done := startConveyer(t, conv)
+
+	for _, item := range []string{"a", "b", "c", "d", "e", "f"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	require.Eventually(t, func() bool {
+		return conv.State() == conveyer.StateRunning
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, conv.Drain(context.Background()))
+	require.NoError(t, <-done)
+	assert.Equal(t, conveyer.StateStopped, conv.State())
+
+	got := make([]string, 0, 6)
+
+	for {
+		item, err := conv.Recv("output")
+		if err != nil {
+			require.ErrorIs(t, err, conveyer.ErrChanClosed)
+
+			break
+		}
+
+		got = append(got, item)
+	}
+
+	assert.ElementsMatch(t, []string{
+		"decorated: a", "decorated: b", "decorated: c", "decorated: d", "decorated: e", "decorated: f",
+	}, got)
+
+	require.ErrorIs(t, conv.Send("input", "late"), conveyer.ErrChanClosed)
+}
+
+func TestDrainTimesOut(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(func(ctx context.Context, _ chan string, _ chan string) error {
+		<-ctx.Done()
+
+		return nil
+	}, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	_, done := startConveyer(t, conv)
+
+	require.Eventually(t, func() bool {
+		return conv.State() == conveyer.StateRunning
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, conv.Drain(ctx), context.DeadlineExceeded)
+	require.NoError(t, <-done)
+	assert.Equal(t, conveyer.StateStopped, conv.State())
+}
+
+func TestRestartAfterStop(t *testing.T) {
+	t.Parallel()
+
+	conv := lifecycleConveyer(4)
+
+	_, done := startConveyer(t, conv)
+
+	require.NoError(t, conv.Send("input", "first"))
+	require.NoError(t, conv.Send("input", "kept"))
+
+	first, err := conv.Recv("output")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return conv.Stats().Stages[2].Processed == 2
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+	assert.Equal(t, conveyer.StateStopped, conv.State())
+
+	_, done = startConveyer(t, conv)
+
+	require.Eventually(t, func() bool {
+		return conv.State() == conveyer.StateRunning
+	}, time.Second, time.Millisecond)
+
+	kept, err := conv.Recv("output")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"decorated: first", "decorated: kept"}, []string{first, kept},
+		"messages left in the channels survive a restart")
+
+	require.NoError(t, conv.Send("input", "second"))
+
+	res, err := conv.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: second", res)
+
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+}
+
+func TestInvalidTransitions(t *testing.T) {
+	t.Parallel()
+
+	conv := lifecycleConveyer(1)
+
+	err := conv.Drain(context.Background())
+	require.ErrorIs(t, err, conveyer.ErrInvalidTransition)
+	assert.EqualError(t, err, "invalid lifecycle transition: cannot drain a created conveyer")
+	require.ErrorIs(t, conv.Stop(), conveyer.ErrInvalidTransition)
+
+	_, done := startConveyer(t, conv)
+
+	require.Eventually(t, func() bool {
+		return conv.State() == conveyer.StateRunning
+	}, time.Second, time.Millisecond)
+
+	err = conv.Run(context.Background())
+	require.ErrorIs(t, err, conveyer.ErrInvalidTransition)
+	assert.EqualError(t, err, "invalid lifecycle transition: cannot run a running conveyer")
+
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+
+	require.ErrorIs(t, conv.Stop(), conveyer.ErrInvalidTransition)
+	require.ErrorIs(t, conv.Drain(context.Background()), conveyer.ErrInvalidTransition)
+}
+
+func TestCloseInputCompletesRun(t *testing.T) {
+	t.Parallel()
+
+	conv := lifecycleConveyer(4)
+
+	require.ErrorIs(t, conv.CloseInput("decorated"), conveyer.ErrChanInUse)
+	require.ErrorIs(t, conv.CloseInput("missing"), conveyer.ErrChanNotFound)
+
+	_, done := startConveyer(t, conv)
+
+	require.NoError(t, conv.Send("input", "last"))
+	require.NoError(t, conv.CloseInput("input"))
+	require.NoError(t, <-done)
+
+	assert.Equal(t, []string{"decorated: last"}, drain(t, conv, "output", 1))
+
+	_, err := conv.Recv("output")
+	require.ErrorIs(t, err, conveyer.ErrChanClosed)
+
+	durable := conveyer.New(1)
+	require.NoError(t, durable.MakeDurable("input", t.TempDir(), conveyer.StringCodec{}))
+	t.Cleanup(func() { _ = durable.Close() })
+
+	require.ErrorIs(t, durable.CloseInput("input"), conveyer.ErrDurableInput)
+}
@@ -0,0 +1,130 @@
+package conveyer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type channelStats struct {
+	sent         atomic.Uint64
+	received     atomic.Uint64
+	dropped      atomic.Uint64
+	redelivered  atomic.Uint64
+	commitErrors atomic.Uint64
+	sendBlocked  atomic.Int64
+	recvBlocked  atomic.Int64
+}
+
+type stageStats struct {
+	processed    atomic.Uint64
+	errors       atomic.Uint64
+	retries      atomic.Uint64
+	deadLettered atomic.Uint64
+	restarts     atomic.Uint64
+	expired      atomic.Uint64
+	latency      atomic.Int64
+	timed        atomic.Uint64
+	measured     atomic.Bool
+}
+
+type ChannelStats struct {
+	Name         string
+	Depth        int
+	Capacity     int
+	Sent         uint64
+	Received     uint64
+	Dropped      uint64
+	Redelivered  uint64
+	Unacked      int
+	CommitErrors uint64
+	SendBlocked  time.Duration
+	RecvBlocked  time.Duration
+}
+
+type StageStats struct {
+	Name         string
+	Kind         StageKind
+	Processed    uint64
+	Errors       uint64
+	Retries      uint64
+	DeadLettered uint64
+	Restarts     uint64
+	Expired      uint64
+	Latency      time.Duration
+	Timed        uint64
+	Measured     bool
+}
+
+// AvgLatency is the mean handler time per attempt.
+func (s StageStats) AvgLatency() time.Duration {
+	if s.Timed == 0 {
+		return 0
+	}
+
+	return s.Latency / time.Duration(s.Timed)
+}
+
+// Stats is a point-in-time snapshot of a conveyer. Stage counters are only
+// maintained for handlers built on Next, Process and Emit; a stage whose
+// handler has not used them is not Measured, and its zero counters say
+// nothing. Channel counters only count messages moved by such handlers or by
+// Send and Recv. Latency is the handler time of Timed attempts, not counting
+// the time Emit waits for an output.
+type Stats struct {
+	Channels []ChannelStats
+	Stages   []StageStats
+}
+
+func (c *Conveyer[T]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		Channels: make([]ChannelStats, 0, len(c.channelsKey)),
+		Stages:   make([]StageStats, 0, len(c.stages)),
+	}
+
+	for _, name := range c.channelsKey {
+		channel := c.channels[name]
+		counters := &c.chanState[name].stats
+
+		unacked := 0
+		if tracker, ok := c.chanState[name].acks.(*ackTracker[T]); ok {
+			unacked = tracker.unacked()
+		}
+
+		stats.Channels = append(stats.Channels, ChannelStats{
+			Name:         name,
+			Depth:        depthOf(channel, c.chanState[name]),
+			Capacity:     cap(channel),
+			Sent:         counters.sent.Load(),
+			Received:     counters.received.Load(),
+			Dropped:      counters.dropped.Load(),
+			Redelivered:  counters.redelivered.Load(),
+			Unacked:      unacked,
+			CommitErrors: counters.commitErrors.Load(),
+			SendBlocked:  time.Duration(counters.sendBlocked.Load()),
+			RecvBlocked:  time.Duration(counters.recvBlocked.Load()),
+		})
+	}
+
+	for _, registered := range c.stages {
+		counters := &registered.stats
+
+		stats.Stages = append(stats.Stages, StageStats{
+			Name:         registered.name,
+			Kind:         registered.kind,
+			Processed:    counters.processed.Load(),
+			Errors:       counters.errors.Load(),
+			Retries:      counters.retries.Load(),
+			DeadLettered: counters.deadLettered.Load(),
+			Restarts:     counters.restarts.Load(),
+			Expired:      counters.expired.Load(),
+			Latency:      time.Duration(counters.latency.Load()),
+			Timed:        counters.timed.Load(),
+			Measured:     counters.measured.Load(),
+		})
+	}
+
+	return stats
+}
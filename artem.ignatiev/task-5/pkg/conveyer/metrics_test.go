@@ -0,0 +1,193 @@
+package conveyer_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func findChannel(t *testing.T, stats conveyer.Stats, name string) conveyer.ChannelStats {
+	t.Helper()
+
+	for _, channel := range stats.Channels {
+		if channel.Name == name {
+			return channel
+		}
+	}
+
+	require.Failf(t, "channel not found", "%s", name)
+
+	return conveyer.ChannelStats{}
+}
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(3)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated")
+	conv.RegisterSeparator(handlers.SeparatorFunc, "decorated", []string{"part1", "part2"})
+	conv.RegisterMultiplexer(handlers.MultiplexerFunc, []string{"part1", "part2"}, "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	for _, item := range []string{"a", "b", "no multiplexer", "c"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	for range 3 {
+		_, err := conv.Recv("output")
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		return conv.Stats().Stages[2].Processed == 4
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	stats := conv.Stats()
+
+	input := findChannel(t, stats, "input")
+	assert.Equal(t, uint64(4), input.Sent)
+	assert.Equal(t, uint64(4), input.Received)
+	assert.Equal(t, 3, input.Capacity)
+
+	output := findChannel(t, stats, "output")
+	assert.Equal(t, uint64(3), output.Sent)
+	assert.Equal(t, uint64(3), output.Received)
+
+	part1 := findChannel(t, stats, "part1")
+	part2 := findChannel(t, stats, "part2")
+	assert.Equal(t, uint64(2), part1.Sent)
+	assert.Equal(t, uint64(2), part2.Sent)
+
+	require.Len(t, stats.Stages, 3)
+
+	for _, registered := range stats.Stages {
+		assert.True(t, registered.Measured, registered.Name)
+		assert.Equal(t, uint64(4), registered.Processed, registered.Name)
+		assert.Zero(t, registered.Errors, registered.Name)
+	}
+
+	assert.Equal(t, conveyer.KindDecorator, stats.Stages[0].Kind)
+	assert.Equal(t, "handlers.PrefixDecoratorFunc", stats.Stages[0].Name)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(2)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	require.NoError(t, conv.Send("input", "queued"))
+
+	recorder := httptest.NewRecorder()
+	conveyer.MetricsHandler(conv).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, "# TYPE conveyer_channel_depth gauge")
+	assert.Contains(t, body, `conveyer_channel_depth{channel="input"} 1`)
+	assert.Contains(t, body, `conveyer_channel_capacity{channel="output"} 2`)
+	assert.Contains(t, body, `conveyer_channel_sent_total{channel="input"} 1`)
+	assert.Contains(t, body,
+		`conveyer_stage_processed_total{stage="handlers.PrefixDecoratorFunc",kind="decorator"} 0`)
+	assert.Contains(t, body,
+		`conveyer_stage_latency_seconds_count{stage="handlers.PrefixDecoratorFunc",kind="decorator"} 0`)
+}
+
+func TestStatsOfRawHandler(t *testing.T) {
+	t.Parallel()
+
+	capacities := make(chan int, 1)
+
+	conv := conveyer.New(3)
+	conv.RegisterDecorator(func(ctx context.Context, input chan string, output chan string) error {
+		capacities <- cap(input)
+
+		for {
+			select {
+			case item := <-input:
+				output <- item + "!"
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	cancel, done := startConveyer(t, conv)
+
+	for range 3 {
+		_, err := conv.Recv("output")
+		require.NoError(t, err)
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, 3, <-capacities, "the handler gets the conveyer channels")
+
+	stats := conv.Stats()
+
+	input := findChannel(t, stats, "input")
+	assert.Equal(t, uint64(3), input.Sent)
+	assert.Zero(t, input.Received, "direct reads are not counted")
+
+	output := findChannel(t, stats, "output")
+	assert.Zero(t, output.Sent, "direct writes are not counted")
+	assert.Equal(t, uint64(3), output.Received)
+
+	stage := stats.Stages[0]
+	assert.False(t, stage.Measured, "the stage says it is not measured")
+	assert.Zero(t, stage.Processed)
+	assert.Zero(t, stage.Timed)
+}
+
+func TestLatencyExcludesEmit(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(0)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	require.NoError(t, conv.Send("input", "slow reader"))
+	time.Sleep(50 * time.Millisecond)
+
+	_, err := conv.Recv("output")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return conv.Stats().Stages[0].Processed == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	stage := conv.Stats().Stages[0]
+	assert.Equal(t, uint64(1), stage.Timed)
+	assert.Less(t, stage.Latency, 50*time.Millisecond, "waiting for the output is not handler time")
+}
@@ -0,0 +1,62 @@
+package conveyer
+
+// ChannelOp tells what happened to an observed message.
+type ChannelOp int
+
+const (
+	// OpSend is a message written to a channel.
+	OpSend ChannelOp = iota
+	// OpRecv is a message taken from a channel.
+	OpRecv
+)
+
+func (o ChannelOp) String() string {
+	switch o {
+	case OpSend:
+		return "send"
+	case OpRecv:
+		return "recv"
+	default:
+		return "unknown"
+	}
+}
+
+// Observer sees the messages written to and taken from the channels of a
+// conveyer, by Send and Recv as well as by stages built on Next and Emit. It
+// runs on the path of the message, so it must return quickly.
+type Observer[T any] func(op ChannelOp, name string, item T)
+
+// SetObserver installs an observer on every channel, including the ones
+// created later. nil removes it.
+func (c *Conveyer[T]) SetObserver(observer Observer[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.observer = observer
+
+	for name, state := range c.chanState {
+		c.observeLocked(name, state)
+	}
+}
+
+func (c *Conveyer[T]) observeLocked(name string, state *channelState) {
+	var bound func(op ChannelOp, item T)
+
+	if observer := c.observer; observer != nil {
+		bound = func(op ChannelOp, item T) { observer(op, name, item) }
+	}
+
+	state.observer.Store(bound)
+}
+
+func observe[T any](state *channelState, op ChannelOp, item T) {
+	if observer, _ := state.observer.Load().(func(op ChannelOp, item T)); observer != nil {
+		observer(op, item)
+	}
+}
+
+// sent counts a message written to a channel.
+func sent[T any](state *channelState, item T) {
+	state.stats.sent.Add(1)
+	observe(state, OpSend, item)
+}
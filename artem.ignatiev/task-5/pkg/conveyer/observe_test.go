@@ -0,0 +1,53 @@
+package conveyer_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func TestObserverSeesChannelTraffic(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+
+	conv := conveyer.New(2)
+	conv.SetObserver(func(op conveyer.ChannelOp, name string, item string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen = append(seen, op.String()+" "+name+" "+item)
+	})
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	require.NoError(t, conv.Send("input", "a"))
+
+	res, err := conv.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: a", res)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{
+		"send input a",
+		"recv input a",
+		"send output decorated: a",
+		"recv output decorated: a",
+	}, seen)
+}
@@ -0,0 +1,146 @@
+package conveyer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+type ErrorAction int
+
+const (
+	// ActionFail stops the whole pipeline, the behaviour of a plain handler error.
+	ActionFail ErrorAction = iota
+	// ActionSkip drops the failed message and keeps the stage running.
+	ActionSkip
+	// ActionDeadLetter routes the failed message and its error to a dead-letter channel.
+	ActionDeadLetter
+)
+
+// ErrorPolicy decides what happens to a message whose handler failed. The
+// message is first retried Retries times with exponential backoff, then Action applies.
+type ErrorPolicy struct {
+	Action     ErrorAction
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	DeadLetter string
+}
+
+func FailPolicy() ErrorPolicy {
+	return ErrorPolicy{Action: ActionFail}
+}
+
+func SkipPolicy() ErrorPolicy {
+	return ErrorPolicy{Action: ActionSkip}
+}
+
+func RetryPolicy(retries int, backoff time.Duration, maxBackoff time.Duration) ErrorPolicy {
+	return ErrorPolicy{Action: ActionFail, Retries: retries, Backoff: backoff, MaxBackoff: maxBackoff}
+}
+
+func DeadLetterPolicy(channel string) ErrorPolicy {
+	return ErrorPolicy{Action: ActionDeadLetter, DeadLetter: channel}
+}
+
+// Delay is the backoff before retry number attempt, counted from zero. It
+// doubles with every attempt up to MaxBackoff, or up to the longest Duration
+// when MaxBackoff is not set.
+func (p ErrorPolicy) Delay(attempt int) time.Duration {
+	limit := p.MaxBackoff
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+
+	if p.Backoff <= 0 {
+		return 0
+	}
+
+	if attempt >= 63 || p.Backoff > limit>>attempt {
+		return limit
+	}
+
+	return p.Backoff << attempt
+}
+
+// DeadLetter is a message a stage gave up on, together with the reason.
+type DeadLetter[T any] struct {
+	Item  T
+	Err   error
+	Stage string
+}
+
+type stageConfig struct {
+	policy  ErrorPolicy
+	workers int
+	ordered bool
+}
+
+type StageOption func(config *stageConfig)
+
+func newStageConfig(opts []StageOption) stageConfig {
+	config := stageConfig{policy: FailPolicy(), workers: 1}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return config
+}
+
+func WithErrorPolicy(policy ErrorPolicy) StageOption {
+	return func(config *stageConfig) {
+		config.policy = policy
+	}
+}
+
+func (c *Conveyer[T]) getOrMakeDeadLetterLocked(name string) chan DeadLetter[T] {
+	if channel, ok := c.deadLetters[name]; ok {
+		return channel
+	}
+
+	channel := make(chan DeadLetter[T], c.chanSize)
+	c.deadLetters[name] = channel
+
+	return channel
+}
+
+// RecvDeadLetter takes the next message from a dead-letter channel.
+func (c *Conveyer[T]) RecvDeadLetter(name string) (DeadLetter[T], error) {
+	return c.RecvDeadLetterContext(context.Background(), name)
+}
+
+// RecvDeadLetterContext is RecvDeadLetter which gives up when ctx is done.
+func (c *Conveyer[T]) RecvDeadLetterContext(ctx context.Context, name string) (DeadLetter[T], error) {
+	c.mu.Lock()
+	channel, ok := c.deadLetters[name]
+	c.mu.Unlock()
+
+	if !ok {
+		return DeadLetter[T]{}, ErrChanNotFound
+	}
+
+	select {
+	case letter, opened := <-channel:
+		if !opened {
+			return letter, ErrChanClosed
+		}
+
+		return letter, nil
+	case <-ctx.Done():
+		return DeadLetter[T]{}, fmt.Errorf("recv: %w", ctx.Err())
+	}
+}
+
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := ClockOf(ctx).NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
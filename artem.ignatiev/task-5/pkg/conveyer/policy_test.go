@@ -0,0 +1,176 @@
+package conveyer_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+var errTransient = errors.New("transient")
+
+func startConveyer[T any](t testing.TB, conv *conveyer.Conveyer[T]) (context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	t.Cleanup(cancel)
+
+	return cancel, done
+}
+
+func TestErrorPolicies(t *testing.T) {
+	t.Parallel()
+
+	t.Run("skip", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(4)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output",
+			conveyer.WithErrorPolicy(conveyer.SkipPolicy()))
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		cancel, done := startConveyer(t, conv)
+
+		require.NoError(t, conv.Send("input", "no decorator"))
+		require.NoError(t, conv.Send("input", "fine"))
+
+		res, err := conv.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, "decorated: fine", res)
+
+		cancel()
+		require.NoError(t, <-done)
+
+		stats := conv.Stats().Stages[0]
+		assert.Equal(t, uint64(1), stats.Processed)
+		assert.Equal(t, uint64(1), stats.Errors)
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(4)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output",
+			conveyer.WithErrorPolicy(conveyer.DeadLetterPolicy("dlq")))
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		cancel, done := startConveyer(t, conv)
+
+		require.NoError(t, conv.Send("input", "no decorator here"))
+		require.NoError(t, conv.Send("input", "fine"))
+
+		letter, err := conv.RecvDeadLetter("dlq")
+		require.NoError(t, err)
+		assert.Equal(t, "no decorator here", letter.Item)
+		require.ErrorIs(t, letter.Err, handlers.ErrCantDecorate)
+		assert.Equal(t, "handlers.PrefixDecoratorFunc", letter.Stage)
+
+		res, err := conv.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, "decorated: fine", res)
+
+		ctx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer stop()
+
+		_, err = conv.RecvDeadLetterContext(ctx, "dlq")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		cancel()
+		require.NoError(t, <-done)
+		assert.Equal(t, uint64(1), conv.Stats().Stages[0].DeadLettered)
+
+		_, err = conv.RecvDeadLetter("missing")
+		require.ErrorIs(t, err, conveyer.ErrChanNotFound)
+	})
+
+	t.Run("retry with backoff", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int32
+
+		flaky := handlers.NewDecorator(func(item string) (string, error) {
+			if calls.Add(1) < 3 {
+				return "", errTransient
+			}
+
+			return item + "!", nil
+		})
+
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(flaky, "input", "output",
+			conveyer.WithErrorPolicy(conveyer.RetryPolicy(3, time.Millisecond, 2*time.Millisecond)))
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		cancel, done := startConveyer(t, conv)
+
+		require.NoError(t, conv.Send("input", "hi"))
+
+		res, err := conv.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, "hi!", res)
+
+		cancel()
+		require.NoError(t, <-done)
+
+		stats := conv.Stats().Stages[0]
+		assert.Equal(t, uint64(2), stats.Retries)
+		assert.Equal(t, uint64(1), stats.Processed)
+		assert.Zero(t, stats.Errors)
+	})
+
+	t.Run("retries exhausted fail the pipeline", func(t *testing.T) {
+		t.Parallel()
+
+		failing := handlers.NewDecorator(func(string) (string, error) {
+			return "", errTransient
+		})
+
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(failing, "input", "output",
+			conveyer.WithErrorPolicy(conveyer.RetryPolicy(2, time.Millisecond, 0)))
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		_, done := startConveyer(t, conv)
+
+		require.NoError(t, conv.Send("input", "hi"))
+		require.ErrorIs(t, <-done, errTransient)
+		assert.Equal(t, uint64(2), conv.Stats().Stages[0].Retries)
+	})
+}
+
+func TestPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	policy := conveyer.RetryPolicy(100, time.Second, 0)
+	assert.Equal(t, time.Second, policy.Delay(0))
+	assert.Equal(t, 8*time.Second, policy.Delay(3))
+
+	for _, attempt := range []int{40, 62, 63, 64, 100} {
+		assert.Equal(t, time.Duration(math.MaxInt64), policy.Delay(attempt), "attempt %d", attempt)
+	}
+
+	capped := conveyer.RetryPolicy(100, time.Second, time.Minute)
+	assert.Equal(t, 32*time.Second, capped.Delay(5))
+	assert.Equal(t, time.Minute, capped.Delay(6))
+	assert.Equal(t, time.Minute, capped.Delay(100))
+
+	assert.Zero(t, conveyer.RetryPolicy(3, 0, time.Minute).Delay(2))
+}
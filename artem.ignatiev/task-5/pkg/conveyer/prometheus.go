@@ -0,0 +1,111 @@
+package conveyer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type StatsSource interface {
+	Stats() Stats
+}
+
+// WritePrometheus renders a stats snapshot in the Prometheus text exposition format.
+func WritePrometheus(writer io.Writer, stats Stats) error {
+	buffered := bufio.NewWriter(writer)
+
+	channelMetric := func(name, kind, help string, value func(ChannelStats) float64) {
+		fmt.Fprintf(buffered, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+
+		for _, channel := range stats.Channels {
+			fmt.Fprintf(buffered, "%s{channel=\"%s\"} %g\n", name, escapeLabel(channel.Name), value(channel))
+		}
+	}
+
+	stageMetric := func(name, kind, help string, value func(StageStats) float64) {
+		fmt.Fprintf(buffered, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+
+		for _, registered := range stats.Stages {
+			fmt.Fprintf(buffered, "%s{stage=\"%s\",kind=\"%s\"} %g\n",
+				name, escapeLabel(registered.Name), registered.Kind, value(registered))
+		}
+	}
+
+	channelMetric("conveyer_channel_depth", "gauge", "Messages currently buffered in the channel.",
+		func(channel ChannelStats) float64 { return float64(channel.Depth) })
+	channelMetric("conveyer_channel_capacity", "gauge", "Buffer size of the channel.",
+		func(channel ChannelStats) float64 { return float64(channel.Capacity) })
+	channelMetric("conveyer_channel_sent_total", "counter", "Messages sent to the channel.",
+		func(channel ChannelStats) float64 { return float64(channel.Sent) })
+	channelMetric("conveyer_channel_received_total", "counter", "Messages received from the channel.",
+		func(channel ChannelStats) float64 { return float64(channel.Received) })
+	channelMetric("conveyer_channel_dropped_total", "counter", "Messages dropped by the overflow policy.",
+		func(channel ChannelStats) float64 { return float64(channel.Dropped) })
+	channelMetric("conveyer_channel_redelivered_total", "counter", "Unacknowledged messages delivered again.",
+		func(channel ChannelStats) float64 { return float64(channel.Redelivered) })
+	channelMetric("conveyer_channel_unacked", "gauge", "Delivered messages waiting for an acknowledgement.",
+		func(channel ChannelStats) float64 { return float64(channel.Unacked) })
+	channelMetric("conveyer_channel_commit_errors_total", "counter", "Failed commits of a durable channel log.",
+		func(channel ChannelStats) float64 { return float64(channel.CommitErrors) })
+	channelMetric("conveyer_channel_send_blocked_seconds_total", "counter", "Time senders spent waiting for room.",
+		func(channel ChannelStats) float64 { return channel.SendBlocked.Seconds() })
+	channelMetric("conveyer_channel_recv_blocked_seconds_total", "counter", "Time receivers spent waiting for data.",
+		func(channel ChannelStats) float64 { return channel.RecvBlocked.Seconds() })
+
+	stageMetric("conveyer_stage_processed_total", "counter", "Messages handled successfully by the stage.",
+		func(registered StageStats) float64 { return float64(registered.Processed) })
+	stageMetric("conveyer_stage_errors_total", "counter", "Messages the stage failed to handle.",
+		func(registered StageStats) float64 { return float64(registered.Errors) })
+
+	stageMetric("conveyer_stage_retries_total", "counter", "Handler attempts that were retried.",
+		func(registered StageStats) float64 { return float64(registered.Retries) })
+	stageMetric("conveyer_stage_dead_lettered_total", "counter", "Messages routed to the dead-letter channel.",
+		func(registered StageStats) float64 { return float64(registered.DeadLettered) })
+
+	stageMetric("conveyer_stage_restarts_total", "counter", "Times the supervisor restarted the stage.",
+		func(registered StageStats) float64 { return float64(registered.Restarts) })
+	stageMetric("conveyer_stage_expired_total", "counter", "Messages dropped because their deadline passed.",
+		func(registered StageStats) float64 { return float64(registered.Expired) })
+	stageMetric("conveyer_stage_measured", "gauge", "Whether the stage counters are maintained (1) or not (0).",
+		func(registered StageStats) float64 {
+			if registered.Measured {
+				return 1
+			}
+
+			return 0
+		})
+
+	const latency = "conveyer_stage_latency_seconds"
+
+	fmt.Fprintf(buffered, "# HELP %s Handler time per message.\n# TYPE %s summary\n", latency, latency)
+
+	for _, registered := range stats.Stages {
+		labels := fmt.Sprintf("stage=\"%s\",kind=\"%s\"", escapeLabel(registered.Name), registered.Kind)
+
+		fmt.Fprintf(buffered, "%s_sum{%s} %g\n", latency, labels, registered.Latency.Seconds())
+		fmt.Fprintf(buffered, "%s_count{%s} %d\n", latency, labels, registered.Timed)
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+
+	return nil
+}
+
+// MetricsHandler serves the stats of source for Prometheus scrapes.
+func MetricsHandler(source StatsSource) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		if err := WritePrometheus(writer, source.Stats()); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,248 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrStageNotFound = errors.New("stage not found")
+	ErrStageKind     = errors.New("handler does not match stage kind")
+	ErrChanInUse     = errors.New("chan is used by a stage")
+)
+
+type runState struct {
+	group      *runGroup
+	intake     context.Context
+	stopIntake context.CancelFunc
+	pumpCtx    context.Context
+	stopPumps  context.CancelFunc
+	pumps      *sync.WaitGroup
+	finished   chan struct{}
+}
+
+type stageHandle struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+	done     chan struct{}
+	finished bool
+}
+
+// startStageLocked runs a stage in the current run, if there is one.
+func (c *Conveyer[T]) startStageLocked(registered *stage[T]) {
+	if c.running == nil {
+		return
+	}
+
+	inputs, outputs := c.resolve(registered.inputs), c.resolve(registered.outputs)
+	handle := &stageHandle{
+		stop:     make(chan struct{}),
+		stopOnce: sync.Once{},
+		cancel:   nil,
+		done:     make(chan struct{}),
+	}
+
+	current := c.newRuntime(registered, inputs, outputs)
+	current.stopping = handle.stop
+
+	stageCtx, cancel := context.WithCancel(c.running.group.ctx)
+	stageCtx = context.WithValue(stageCtx, stageKey{}, current)
+	stageCtx = context.WithValue(stageCtx, cursorsKey{}, registered.cursors)
+	handle.cancel = cancel
+
+	running := c.running
+	started := running.group.Go(func() error {
+		defer close(handle.done)
+		defer cancel()
+
+		err := c.runStageWorkers(stageCtx, registered, inputs, outputs)
+
+		if err != nil {
+			err = registered.errorOf(err, nil)
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		handle.finished = true
+
+		if c.running == running {
+			c.propagateLocked()
+		}
+
+		return err
+	})
+	if !started {
+		cancel()
+
+		return
+	}
+
+	registered.handle = handle
+}
+
+// drain asks the stage to stop taking messages and waits until the ones it
+// holds are handled. When ctx ends first the stage is cancelled.
+func (h *stageHandle) drain(ctx context.Context, name string) error {
+	h.stopOnce.Do(func() { close(h.stop) })
+
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		h.cancel()
+		<-h.done
+
+		return fmt.Errorf("drain stage %q: %w", name, ctx.Err())
+	}
+}
+
+func (c *Conveyer[T]) findStageLocked(name string) (int, *stage[T]) {
+	for idx, registered := range c.stages {
+		if registered.name == name {
+			return idx, registered
+		}
+	}
+
+	return -1, nil
+}
+
+// AddChannel creates a named channel, for example a new input of stages
+// registered on a running conveyer.
+func (c *Conveyer[T]) AddChannel(name string) {
+	c.getOrMakeChan(name)
+}
+
+// RemoveChannel closes and forgets a channel no stage uses. Messages still
+// in it are discarded.
+func (c *Conveyer[T]) RemoveChannel(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channel, ok := c.channels[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrChanNotFound, name)
+	}
+
+	for _, registered := range c.stages {
+		if slices.Contains(registered.inputs, name) || slices.Contains(registered.outputs, name) {
+			return fmt.Errorf("%w: %q by %q", ErrChanInUse, name, registered.name)
+		}
+	}
+
+	state := c.chanState[name]
+	closeChannel(channel, state)
+
+	var err error
+	if state.log != nil {
+		err = state.log.Close()
+	}
+
+	delete(c.channels, name)
+	delete(c.chanState, name)
+	delete(c.inputs, name)
+	delete(c.outputs, name)
+	c.channelsKey = slices.DeleteFunc(c.channelsKey, func(key string) bool { return key == name })
+	c.publishLocked()
+
+	return err
+}
+
+// RemoveStage unregisters a stage. On a running conveyer the stage stops
+// taking input and finishes the messages it holds; the rest stays in its input
+// channels. Draining waits for the outputs to accept what the stage emits, and
+// handlers which read their inputs without Next are only cancelled once ctx
+// ends. Run returns when the last stage is removed.
+func (c *Conveyer[T]) RemoveStage(ctx context.Context, name string) error {
+	c.mu.Lock()
+
+	idx, registered := c.findStageLocked(name)
+	if registered == nil {
+		c.mu.Unlock()
+
+		return fmt.Errorf("%w: %q", ErrStageNotFound, name)
+	}
+
+	c.stages = slices.Delete(c.stages, idx, idx+1)
+	handle := registered.handle
+	c.mu.Unlock()
+
+	if handle == nil {
+		return nil
+	}
+
+	return handle.drain(ctx, name)
+}
+
+// SwapDecorator replaces the handler of a registered decorator. A running stage
+// is drained first, so no message is lost between the two versions.
+func (c *Conveyer[T]) SwapDecorator(
+	ctx context.Context,
+	name string,
+	decoratorFunc func(ctx context.Context, input chan T, output chan T) error,
+) error {
+	return c.swapStage(ctx, name, KindDecorator, decoratorRun(decoratorFunc))
+}
+
+func (c *Conveyer[T]) SwapMultiplexer(
+	ctx context.Context,
+	name string,
+	multiplexerFunc func(ctx context.Context, inputs []chan T, output chan T) error,
+) error {
+	return c.swapStage(ctx, name, KindMultiplexer, multiplexerRun(multiplexerFunc))
+}
+
+func (c *Conveyer[T]) SwapSeparator(
+	ctx context.Context,
+	name string,
+	separatorFunc func(ctx context.Context, input chan T, outputs []chan T) error,
+) error {
+	return c.swapStage(ctx, name, KindSeparator, separatorRun(separatorFunc))
+}
+
+func (c *Conveyer[T]) swapStage(ctx context.Context, name string, kind StageKind, run stageRun[T]) error {
+	c.mu.Lock()
+
+	_, registered := c.findStageLocked(name)
+	if registered == nil {
+		c.mu.Unlock()
+
+		return fmt.Errorf("%w: %q", ErrStageNotFound, name)
+	}
+
+	if registered.kind != kind {
+		c.mu.Unlock()
+
+		return fmt.Errorf("%w: %q is a %s", ErrStageKind, name, registered.kind)
+	}
+
+	handle, running := registered.handle, c.running
+	if handle == nil || running == nil || !running.group.hold() {
+		registered.run = run
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	c.mu.Unlock()
+
+	defer running.group.release()
+
+	err := handle.drain(ctx, name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	registered.run = run
+	registered.handle = nil
+
+	if _, current := c.findStageLocked(name); current == registered && c.running == running {
+		c.startStageLocked(registered)
+	}
+
+	return err
+}
@@ -0,0 +1,218 @@
+package conveyer_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func upperDecorator(item string) (string, error) {
+	return strings.ToUpper(item), nil
+}
+
+func slowDecorator(item string) (string, error) {
+	time.Sleep(20 * time.Millisecond)
+
+	return "slow: " + item, nil
+}
+
+func TestRegisterWhileRunning(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(4)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+	waitRunning(t, conv)
+
+	var wg sync.WaitGroup
+
+	for idx := range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			conv.RegisterDecorator(handlers.PrefixDecoratorFunc,
+				fmt.Sprintf("in%d", idx), fmt.Sprintf("out%d", idx))
+		}()
+	}
+
+	wg.Wait()
+
+	for idx := range 8 {
+		require.NoError(t, conv.Send(fmt.Sprintf("in%d", idx), "late"))
+
+		res, err := conv.Recv(fmt.Sprintf("out%d", idx))
+		require.NoError(t, err)
+		assert.Equal(t, "decorated: late", res)
+	}
+
+	assert.Len(t, conv.Stats().Stages, 9)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestRemoveStageDrains(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(8)
+	conv.RegisterDecorator(handlers.NewDecorator(slowDecorator), "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	require.Eventually(t, func() bool {
+		return findChannel(t, conv.Stats(), "input").Received == 1
+	}, time.Second, time.Millisecond)
+
+	name := conv.Stats().Stages[0].Name
+	require.NoError(t, conv.RemoveStage(context.Background(), name))
+
+	res, err := conv.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "slow: a", res, "the message held by the removed stage is delivered")
+	assert.Equal(t, 2, findChannel(t, conv.Stats(), "input").Depth, "the rest waits in the input")
+	assert.Empty(t, conv.Stats().Stages)
+
+	require.ErrorIs(t, conv.RemoveStage(context.Background(), name), conveyer.ErrStageNotFound)
+	require.NoError(t, <-done, "removing the last stage ends the run")
+
+	cancel()
+}
+
+func TestSwapDecoratorLosesNothing(t *testing.T) {
+	t.Parallel()
+
+	const total = 200
+
+	conv := conveyer.New(4)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output", conveyer.WithWorkers(2))
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	go func() {
+		for idx := range total {
+			if err := conv.Send("input", fmt.Sprintf("m%d", idx)); err != nil {
+				return
+			}
+		}
+	}()
+
+	received := make(chan string, total)
+
+	go func() {
+		for {
+			res, err := conv.Recv("output")
+			if err != nil {
+				close(received)
+
+				return
+			}
+
+			received <- res
+		}
+	}()
+
+	results := make(map[string]bool, total)
+	upper := 0
+
+	for res := range received {
+		if len(results) == total/2 {
+			name := conv.Stats().Stages[0].Name
+			require.NoError(t, conv.SwapDecorator(context.Background(), name, handlers.NewDecorator(upperDecorator)))
+		}
+
+		if res == strings.ToUpper(res) {
+			upper++
+		}
+
+		results[strings.TrimPrefix(strings.ToLower(res), "decorated: ")] = true
+
+		if len(results) == total {
+			break
+		}
+	}
+
+	assert.Len(t, results, total)
+	assert.Positive(t, upper, "the new handler version is running")
+	assert.Equal(t, "handlers.PrefixDecoratorFunc", conv.Stats().Stages[0].Name)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestSwapOrderedStage(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[int](8)
+	conv.RegisterDecorator(handlers.NewDecorator(jitteryDecorator), "input", "output",
+		conveyer.WithWorkers(3), conveyer.WithOrderedOutput())
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	cancel, done := startConveyer(t, conv)
+
+	for idx := range 6 {
+		require.NoError(t, conv.Send("input", idx))
+	}
+
+	name := conv.Stats().Stages[0].Name
+	require.NoError(t, conv.SwapDecorator(context.Background(), name, handlers.NewDecorator(func(item int) (int, error) {
+		return -item, nil
+	})))
+
+	// The old version multiplies, the new one negates; input order survives the swap.
+	for idx := range 6 {
+		res, err := conv.Recv("output")
+		require.NoError(t, err)
+
+		if res >= 0 {
+			res /= 10
+		}
+
+		assert.Equal(t, idx, max(res, -res))
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestReconfigErrors(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+
+	ctx := context.Background()
+
+	require.ErrorIs(t, conv.SwapDecorator(ctx, "missing", handlers.PrefixDecoratorFunc), conveyer.ErrStageNotFound)
+	require.ErrorIs(t, conv.SwapSeparator(ctx, "handlers.PrefixDecoratorFunc", handlers.SeparatorFunc),
+		conveyer.ErrStageKind)
+
+	require.ErrorIs(t, conv.RemoveChannel("input"), conveyer.ErrChanInUse)
+	require.ErrorIs(t, conv.RemoveChannel("missing"), conveyer.ErrChanNotFound)
+
+	conv.AddChannel("spare")
+	require.NoError(t, conv.RemoveChannel("spare"))
+	require.ErrorIs(t, conv.Send("spare", "x"), conveyer.ErrChanNotFound)
+}
@@ -0,0 +1,461 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kryjkaqq/task-5/pkg/transport"
+)
+
+var (
+	ErrRemoteCanceled = errors.New("remote conveyer canceled")
+	ErrRemoteFailed   = errors.New("remote conveyer failed")
+	ErrLinkBroken     = errors.New("remote link broken")
+	ErrUnexpectedChan = errors.New("unexpected remote chan")
+)
+
+const dialRetry = 50 * time.Millisecond
+
+// bridge links a channel to a peer. Intake bridges stop when the conveyer
+// drains, the others when their channel is closed.
+type bridge struct {
+	link   func(ctx context.Context) error
+	intake bool
+}
+
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// DeclareRemoteInput feeds a channel from the peer conveyers that connect to
+// listener during Run. Each peer may have at most chan size messages in flight
+// on top of the ones already buffered in the channel. Once every connected
+// peer has ended its stream the channel is closed, as with CloseInput.
+func (c *Conveyer[T]) DeclareRemoteInput(name string, listener net.Listener, codec Codec[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channel := c.getOrMakeChanLocked(name)
+	state := c.chanState[name]
+	window := uint32(max(c.chanSize, 1))
+	c.inputs[name] = struct{}{}
+
+	c.addBridgeLocked(bridge{
+		link: func(ctx context.Context) error {
+			end := func() { _ = c.CloseInput(name) }
+
+			return serveRemote(ctx, name, listener, codec, channel, state, window, end)
+		},
+		intake: true,
+	})
+}
+
+// DeclareRemoteOutput forwards a channel to the peer conveyer listening on
+// address, dialing until the peer is up. A message taken from the channel is
+// lost if the link breaks before it is written. Closing the channel ends the
+// stream, which closes the input of the peer.
+func (c *Conveyer[T]) DeclareRemoteOutput(name string, network string, address string, codec Codec[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channel := c.getOrMakeChanLocked(name)
+	state := c.chanState[name]
+	c.outputs[name] = struct{}{}
+
+	c.addBridgeLocked(bridge{
+		link: func(ctx context.Context) error {
+			return dialRemote(ctx, name, network, address, codec, channel, state)
+		},
+		intake: false,
+	})
+}
+
+func (c *Conveyer[T]) addBridgeLocked(link bridge) {
+	c.bridges = append(c.bridges, link)
+	c.startBridgeLocked(link)
+}
+
+func (c *Conveyer[T]) startBridgeLocked(link bridge) {
+	if c.running == nil {
+		return
+	}
+
+	ctx := c.running.group.ctx
+	if link.intake {
+		ctx = c.running.intake
+	}
+
+	c.running.group.Go(func() error {
+		return link.link(ctx)
+	})
+}
+
+// serveRemote serves the peers connecting to listener until the run ends, a
+// link fails or every peer ended its stream.
+func serveRemote[T any](
+	ctx context.Context,
+	name string,
+	listener net.Listener,
+	codec Codec[T],
+	channel chan T,
+	state *channelState,
+	window uint32,
+	end func(),
+) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+	acceptCtx, stopAccept := context.WithCancel(groupCtx)
+
+	defer stopAccept()
+
+	var (
+		mu    sync.Mutex
+		open  int
+		ended bool
+	)
+
+	for {
+		conn, err := accept(acceptCtx, listener)
+		if err != nil {
+			if acceptCtx.Err() == nil {
+				group.Go(func() error { return linkError(ctx, name, err) })
+			}
+
+			break
+		}
+
+		mu.Lock()
+		if ended {
+			mu.Unlock()
+			_ = conn.Close()
+
+			break
+		}
+		open++
+		mu.Unlock()
+
+		group.Go(func() error {
+			err := serveConn(groupCtx, name, conn, codec, channel, state, window)
+			if err != nil || groupCtx.Err() != nil {
+				return err
+			}
+
+			mu.Lock()
+			open--
+			last := open == 0
+			ended = last
+			mu.Unlock()
+
+			if last {
+				stopAccept()
+				end()
+			}
+
+			return nil
+		})
+	}
+
+	err := group.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// serveConn feeds the channel from one peer until it ends its stream.
+func serveConn[T any](
+	ctx context.Context,
+	name string,
+	conn net.Conn,
+	codec Codec[T],
+	channel chan T,
+	state *channelState,
+	window uint32,
+) error {
+	link := transport.NewConn(conn)
+	stop := context.AfterFunc(ctx, func() { hangup(ctx, link, nil) })
+
+	err := serveLink(ctx, name, link, codec, channel, state, window)
+
+	stop()
+	hangup(ctx, link, err)
+	link.Drain()
+	_ = link.Close()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+func serveLink[T any](
+	ctx context.Context,
+	name string,
+	link *transport.Conn,
+	codec Codec[T],
+	channel chan T,
+	state *channelState,
+	window uint32,
+) error {
+	hello, err := link.Read()
+	if err != nil {
+		return linkError(ctx, name, err)
+	}
+
+	if hello.Type != transport.FrameHello || string(hello.Payload) != name {
+		return fmt.Errorf("%w: %q instead of %q", ErrUnexpectedChan, hello.Payload, name)
+	}
+
+	if err := link.Write(transport.CreditFrame(window)); err != nil {
+		return linkError(ctx, name, err)
+	}
+
+	for {
+		frame, err := link.Read()
+		if err != nil {
+			return linkError(ctx, name, err)
+		}
+
+		if frame.Type == transport.FrameEnd {
+			return nil
+		}
+
+		if frame.Type != transport.FrameData {
+			return peerStopped(name, frame)
+		}
+
+		item, err := codec.Decode(frame.Payload)
+		if err != nil {
+			return fmt.Errorf("remote chan %q: %w", name, err)
+		}
+
+		err = send(ctx, channel, item, state)
+		if err != nil && !errors.Is(err, ErrChanFull) {
+			return linkError(ctx, name, err)
+		}
+
+		if err := link.Write(transport.CreditFrame(1)); err != nil {
+			return linkError(ctx, name, err)
+		}
+	}
+}
+
+func dialRemote[T any](
+	ctx context.Context,
+	name string,
+	network string,
+	address string,
+	codec Codec[T],
+	channel chan T,
+	state *channelState,
+) error {
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		return linkError(ctx, name, err)
+	}
+
+	link := transport.NewConn(conn)
+	stop := context.AfterFunc(ctx, func() { hangup(ctx, link, nil) })
+
+	linkCtx, cancelLink := context.WithCancelCause(ctx)
+	readerDone := make(chan struct{})
+
+	var credit atomic.Int64
+
+	granted := make(chan struct{}, 1)
+
+	go func() {
+		defer close(readerDone)
+
+		cancelLink(readGrants(ctx, name, link, &credit, granted))
+		link.Drain()
+	}()
+
+	err = forwardLink(ctx, linkCtx, name, link, codec, channel, state, &credit, granted)
+
+	stop()
+	hangup(ctx, link, err)
+	<-readerDone
+	cancelLink(nil)
+	_ = link.Close()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+func forwardLink[T any](
+	ctx context.Context,
+	linkCtx context.Context,
+	name string,
+	link *transport.Conn,
+	codec Codec[T],
+	channel chan T,
+	state *channelState,
+	credit *atomic.Int64,
+	granted <-chan struct{},
+) error {
+	if err := link.Write(transport.Frame{Type: transport.FrameHello, Payload: []byte(name)}); err != nil {
+		return linkError(ctx, name, err)
+	}
+
+	for {
+		for credit.Load() == 0 {
+			select {
+			case <-granted:
+			case <-linkCtx.Done():
+				return linkStopped(ctx, linkCtx)
+			}
+		}
+
+		item, err := receive(linkCtx, channel, state)
+		if errors.Is(err, ErrChanClosed) {
+			return nil
+		}
+
+		if err != nil {
+			return linkStopped(ctx, linkCtx)
+		}
+
+		data, err := codec.Encode(item)
+		if err != nil {
+			return fmt.Errorf("remote chan %q: %w", name, err)
+		}
+
+		if err := link.Write(transport.Frame{Type: transport.FrameData, Payload: data}); err != nil {
+			return linkError(ctx, name, err)
+		}
+
+		credit.Add(-1)
+	}
+}
+
+// readGrants adds the peer's credits until the link ends.
+func readGrants(
+	ctx context.Context,
+	name string,
+	link *transport.Conn,
+	credit *atomic.Int64,
+	granted chan<- struct{},
+) error {
+	for {
+		frame, err := link.Read()
+		if err != nil {
+			return linkError(ctx, name, err)
+		}
+
+		if frame.Type != transport.FrameCredit {
+			return peerStopped(name, frame)
+		}
+
+		grant, err := frame.Credit()
+		if err != nil {
+			return fmt.Errorf("remote chan %q: %w", name, err)
+		}
+
+		credit.Add(int64(grant))
+
+		select {
+		case granted <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func accept(ctx context.Context, listener net.Listener) (net.Conn, error) {
+	deadlines, ok := listener.(deadliner)
+	if ok {
+		_ = deadlines.SetDeadline(time.Time{})
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		if ok {
+			_ = deadlines.SetDeadline(time.Now())
+		} else {
+			_ = listener.Close()
+		}
+	})
+	defer stop()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("accept: %w", err)
+	}
+
+	return conn, nil
+}
+
+func dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	var dialer net.Dialer
+
+	for {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err == nil {
+			return conn, nil
+		}
+
+		if !sleep(ctx, dialRetry) {
+			return nil, fmt.Errorf("dial: %w", err)
+		}
+	}
+}
+
+// hangup tells the peer why this side stops: the run was cancelled or failed,
+// the link itself failed with err, or without either the stream is over.
+func hangup(ctx context.Context, link *transport.Conn, err error) {
+	cause := err
+	if ctx.Err() != nil {
+		cause = context.Cause(ctx)
+	}
+
+	if cause == nil {
+		link.Hangup(transport.Frame{Type: transport.FrameEnd, Payload: nil})
+
+		return
+	}
+
+	frameType := transport.FrameFail
+	if errors.Is(cause, context.Canceled) || errors.Is(cause, context.DeadlineExceeded) {
+		frameType = transport.FrameCancel
+	}
+
+	link.Hangup(transport.Frame{Type: frameType, Payload: []byte(cause.Error())})
+}
+
+func peerStopped(name string, frame transport.Frame) error {
+	switch frame.Type {
+	case transport.FrameCancel:
+		return fmt.Errorf("remote chan %q: %w: %s", name, ErrRemoteCanceled, frame.Payload)
+	case transport.FrameFail:
+		return fmt.Errorf("remote chan %q: %w: %s", name, ErrRemoteFailed, frame.Payload)
+	default:
+		return fmt.Errorf("remote chan %q: %w: %d", name, transport.ErrUnknownFrame, frame.Type)
+	}
+}
+
+// linkError drops errors caused by this side shutting the link down.
+func linkError(ctx context.Context, name string, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return fmt.Errorf("remote chan %q: %w: %w", name, ErrLinkBroken, err)
+}
+
+func linkStopped(ctx context.Context, linkCtx context.Context) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return context.Cause(linkCtx)
+}
@@ -0,0 +1,249 @@
+package conveyer_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func listenLocal(t *testing.T) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = listener.Close() })
+
+	return listener
+}
+
+// splitConveyers runs a separator whose "left" output is decorated by a second conveyer.
+func splitConveyers(
+	t *testing.T,
+	network string,
+	listener net.Listener,
+) (*conveyer.Conveyer[string], *conveyer.Conveyer[string]) {
+	t.Helper()
+
+	front := conveyer.New(4)
+	front.RegisterSeparator(handlers.SeparatorFunc, "input", []string{"left", "right"})
+	front.DeclareInputs("input")
+	front.DeclareOutputs("right")
+	front.DeclareRemoteOutput("left", network, listener.Addr().String(), conveyer.StringCodec{})
+
+	back := conveyer.New(4)
+	back.RegisterDecorator(handlers.PrefixDecoratorFunc, "left", "output")
+	back.DeclareRemoteInput("left", listener, conveyer.StringCodec{})
+	back.DeclareOutputs("output")
+
+	return front, back
+}
+
+func TestRemoteChannelBridgesConveyers(t *testing.T) {
+	t.Parallel()
+
+	front, back := splitConveyers(t, "tcp", listenLocal(t))
+
+	cancelFront, frontDone := startConveyer(t, front)
+	cancelBack, backDone := startConveyer(t, back)
+
+	for _, item := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, front.Send("input", item))
+	}
+
+	for _, want := range []string{"decorated: a", "decorated: c"} {
+		res, err := back.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	}
+
+	for _, want := range []string{"b", "d"} {
+		res, err := front.Recv("right")
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	}
+
+	cancelBack()
+	require.NoError(t, <-backDone)
+	require.ErrorIs(t, <-frontDone, conveyer.ErrRemoteCanceled)
+
+	cancelFront()
+}
+
+func TestRemoteChannelEndsWithItsStream(t *testing.T) {
+	t.Parallel()
+
+	front, back := splitConveyers(t, "tcp", listenLocal(t))
+
+	_, frontDone := startConveyer(t, front)
+	_, backDone := startConveyer(t, back)
+
+	for _, item := range []string{"a", "b", "c"} {
+		require.NoError(t, front.Send("input", item))
+	}
+
+	require.NoError(t, front.CloseInput("input"))
+
+	for _, want := range []string{"decorated: a", "decorated: c"} {
+		res, err := back.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, want, res)
+	}
+
+	res, err := front.Recv("right")
+	require.NoError(t, err)
+	assert.Equal(t, "b", res)
+
+	require.NoError(t, <-frontDone)
+	require.NoError(t, <-backDone, "a finished upstream is not a cancellation")
+
+	_, err = back.Recv("output")
+	require.ErrorIs(t, err, conveyer.ErrChanClosed)
+}
+
+func TestRemoteInputServesSeveralPeers(t *testing.T) {
+	t.Parallel()
+
+	listener := listenLocal(t)
+
+	receiver := conveyer.New(4)
+	receiver.DeclareRemoteInput("link", listener, conveyer.StringCodec{})
+	receiver.DeclareOutputs("link")
+
+	_, receiverDone := startConveyer(t, receiver)
+
+	senders := make([]*conveyer.Conveyer[string], 0, 2)
+
+	for _, item := range []string{"first", "second"} {
+		sender := conveyer.New(4)
+		sender.DeclareInputs("link")
+		sender.DeclareRemoteOutput("link", "tcp", listener.Addr().String(), conveyer.StringCodec{})
+		require.NoError(t, sender.Send("link", item))
+
+		_, done := startConveyer(t, sender)
+
+		res, err := receiver.Recv("link")
+		require.NoError(t, err)
+		assert.Equal(t, item, res)
+
+		senders = append(senders, sender)
+
+		t.Cleanup(func() { <-done })
+	}
+
+	for _, sender := range senders {
+		require.NoError(t, sender.Drain(context.Background()))
+	}
+
+	require.NoError(t, <-receiverDone)
+
+	_, err := receiver.Recv("link")
+	require.ErrorIs(t, err, conveyer.ErrChanClosed)
+}
+
+func TestRemoteChannelOverUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "conv")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "left.sock"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = listener.Close() })
+
+	front, back := splitConveyers(t, "unix", listener)
+
+	cancelFront, frontDone := startConveyer(t, front)
+	_, backDone := startConveyer(t, back)
+
+	require.NoError(t, front.Send("input", "x"))
+
+	res, err := back.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: x", res)
+
+	cancelFront()
+	require.NoError(t, <-frontDone)
+	require.ErrorIs(t, <-backDone, conveyer.ErrRemoteCanceled)
+}
+
+func TestRemoteFailurePropagates(t *testing.T) {
+	t.Parallel()
+
+	front, back := splitConveyers(t, "tcp", listenLocal(t))
+
+	_, frontDone := startConveyer(t, front)
+	_, backDone := startConveyer(t, back)
+
+	require.NoError(t, front.Send("input", "no decorator"))
+
+	require.ErrorIs(t, <-backDone, handlers.ErrCantDecorate)
+
+	err := <-frontDone
+	require.ErrorIs(t, err, conveyer.ErrRemoteFailed)
+	assert.Contains(t, err.Error(), handlers.ErrCantDecorate.Error())
+}
+
+func TestRemoteFlowControl(t *testing.T) {
+	t.Parallel()
+
+	listener := listenLocal(t)
+
+	sender := conveyer.New(16)
+	sender.DeclareInputs("link")
+	sender.DeclareRemoteOutput("link", "tcp", listener.Addr().String(), conveyer.StringCodec{})
+
+	receiver := conveyer.New(2)
+	receiver.DeclareRemoteInput("link", listener, conveyer.StringCodec{})
+	receiver.DeclareOutputs("link")
+
+	_, _ = startConveyer(t, sender)
+	_, _ = startConveyer(t, receiver)
+
+	for range 10 {
+		require.NoError(t, sender.Send("link", "item"))
+	}
+
+	forwarded := func() uint64 { return sender.Stats().Channels[0].Received }
+
+	// Two messages fill the receiving channel and a window of two more is in flight.
+	require.Eventually(t, func() bool { return forwarded() == 4 }, time.Second, time.Millisecond)
+	require.Never(t, func() bool { return forwarded() > 4 }, 100*time.Millisecond, 5*time.Millisecond)
+
+	_, err := receiver.Recv("link")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return forwarded() == 5 }, time.Second, time.Millisecond)
+}
+
+func TestRemoteRejectsWrongChannel(t *testing.T) {
+	t.Parallel()
+
+	listener := listenLocal(t)
+
+	sender := conveyer.New(1)
+	sender.DeclareInputs("other")
+	sender.DeclareRemoteOutput("other", "tcp", listener.Addr().String(), conveyer.StringCodec{})
+
+	receiver := conveyer.New(1)
+	receiver.DeclareRemoteInput("link", listener, conveyer.StringCodec{})
+	receiver.DeclareOutputs("link")
+
+	_, senderDone := startConveyer(t, sender)
+	_, receiverDone := startConveyer(t, receiver)
+
+	require.ErrorIs(t, <-receiverDone, conveyer.ErrUnexpectedChan)
+	require.ErrorIs(t, <-senderDone, conveyer.ErrRemoteFailed)
+}
@@ -0,0 +1,469 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type stageKey struct{}
+
+var detachedState = newChannelState()
+
+type stageRuntime[T any] struct {
+	stage      *stage[T]
+	channels   map[chan T]*channelState
+	deadLetter chan DeadLetter[T]
+	slot       *orderSlot[T]
+	lineage    *lineage
+	stopping   <-chan struct{}
+	holding    *holding[T]
+}
+
+func (c *Conveyer[T]) newRuntime(registered *stage[T], inputs []chan T, outputs []chan T) *stageRuntime[T] {
+	channels := make(map[chan T]*channelState, len(inputs)+len(outputs))
+
+	for idx, channel := range inputs {
+		channels[channel] = c.chanState[registered.inputs[idx]]
+	}
+
+	for idx, channel := range outputs {
+		channels[channel] = c.chanState[registered.outputs[idx]]
+	}
+
+	return &stageRuntime[T]{
+		stage:      registered,
+		channels:   channels,
+		deadLetter: c.deadLetters[registered.config.policy.DeadLetter],
+		slot:       nil,
+		lineage:    c.lineage,
+		stopping:   nil,
+		holding:    nil,
+	}
+}
+
+func runtimeFrom[T any](ctx context.Context) *stageRuntime[T] {
+	current, _ := ctx.Value(stageKey{}).(*stageRuntime[T])
+
+	return current
+}
+
+func (r *stageRuntime[T]) stateOf(channel chan T) *channelState {
+	if r != nil {
+		if state, ok := r.channels[channel]; ok {
+			return state
+		}
+	}
+
+	return detachedState
+}
+
+// worker returns the runtime of one worker of the stage, which keeps track of
+// the messages it took.
+func (r *stageRuntime[T]) worker() *stageRuntime[T] {
+	worker := *r
+	worker.holding = &holding[T]{mu: sync.Mutex{}, taken: nil, abandoned: false, kept: false, deadline: time.Time{}}
+
+	return &worker
+}
+
+// holding is what a worker took and may still be handling. Asking for the
+// next message means it is done with them, unless it keeps them until
+// Release. A worker whose Emit failed, or which fails the stage, puts them
+// back in front of their channels instead.
+type holding[T any] struct {
+	mu        sync.Mutex
+	taken     []heldMessage[T]
+	abandoned bool
+	kept      bool
+	deadline  time.Time
+}
+
+type heldMessage[T any] struct {
+	state *channelState
+	next  queued[T]
+}
+
+// measure marks the stage as one whose counters are maintained.
+func (r *stageRuntime[T]) measure() {
+	if r != nil && !r.stage.stats.measured.Load() {
+		r.stage.stats.measured.Store(true)
+	}
+}
+
+// took hands a message over to the worker.
+func (r *stageRuntime[T]) took(state *channelState, next queued[T]) {
+	handOver(state, next.item)
+	r.measure()
+
+	if r == nil || r.holding == nil {
+		settle(state, next)
+
+		return
+	}
+
+	r.holding.mu.Lock()
+	r.holding.taken = append(r.holding.taken, heldMessage[T]{state: state, next: next})
+	r.holding.deadline = next.deadline
+	r.holding.mu.Unlock()
+}
+
+// abandon records that the worker could not finish the messages it took.
+func (r *stageRuntime[T]) abandon() {
+	if r == nil || r.holding == nil {
+		return
+	}
+
+	r.holding.mu.Lock()
+	r.holding.abandoned = true
+	r.holding.mu.Unlock()
+}
+
+func (r *stageRuntime[T]) abandoned() bool {
+	if r == nil || r.holding == nil {
+		return false
+	}
+
+	r.holding.mu.Lock()
+	defer r.holding.mu.Unlock()
+
+	return r.holding.abandoned
+}
+
+// release settles the messages the worker took, as it is done with them. Once
+// it abandoned them it puts them back instead and reports false: the worker
+// must not take more.
+func (r *stageRuntime[T]) release() bool {
+	if r == nil || r.holding == nil {
+		return true
+	}
+
+	r.holding.mu.Lock()
+	taken, abandoned := r.holding.taken, r.holding.abandoned
+	r.holding.taken = nil
+	r.holding.mu.Unlock()
+
+	for _, held := range taken {
+		if abandoned {
+			frontOf[T](held.state).push(held.next)
+		} else {
+			settle(held.state, held.next)
+		}
+	}
+
+	return !abandoned
+}
+
+// moveOn is called as the worker asks for another message. It reports false
+// when the worker must not take more.
+func (r *stageRuntime[T]) moveOn() bool {
+	if r == nil || r.holding == nil {
+		return true
+	}
+
+	r.holding.mu.Lock()
+	kept, abandoned := r.holding.kept, r.holding.abandoned
+	r.holding.mu.Unlock()
+
+	if kept && !abandoned {
+		return true
+	}
+
+	return r.release()
+}
+
+// Hold makes the stage keep the messages it takes until it calls Release,
+// rather than count them as handled when it asks for the next one. A stage
+// which emits one result for several messages holds them until the result is
+// emitted, so none is lost when it stops in between. Workers with ordered
+// output are done with each message when its Process returns.
+func Hold[T any](ctx context.Context) {
+	current := runtimeFrom[T](ctx)
+	if current == nil || current.holding == nil {
+		return
+	}
+
+	current.holding.mu.Lock()
+	current.holding.kept = true
+	current.holding.mu.Unlock()
+}
+
+// Release counts the messages the stage holds as handled. It reports false
+// when an Emit of the stage failed; the messages then go back in front of
+// their channels.
+func Release[T any](ctx context.Context) bool {
+	return runtimeFrom[T](ctx).release()
+}
+
+// emitWaitKey holds the time Emit spent blocked during a Process attempt.
+type emitWaitKey struct{}
+
+// Next receives the next message of a stage input, dropping the expired ones.
+// It reports false once the input is closed or the stage is asked to stop.
+func Next[T any](ctx context.Context, input chan T) (T, bool) {
+	current := runtimeFrom[T](ctx)
+	state := current.stateOf(input)
+
+	var stopping <-chan struct{}
+	if current != nil {
+		stopping = current.stopping
+	}
+
+	for {
+		if !current.moveOn() {
+			var zero T
+
+			return zero, false
+		}
+
+		next, _, err := takeUntil(ctx, stopping, input, state)
+		if err != nil {
+			return next.item, false
+		}
+
+		current.took(state, next)
+
+		if !current.dropped(ctx, next) {
+			return next.item, true
+		}
+	}
+}
+
+// TryNext receives a message of a stage input if one is ready. An expired one
+// is dropped and reported as not ok. open is false once the input is closed.
+func TryNext[T any](ctx context.Context, input chan T) (item T, ok bool, open bool) {
+	current := runtimeFrom[T](ctx)
+	if ctx.Err() != nil || current.stopped() {
+		return item, false, true
+	}
+
+	state := current.stateOf(input)
+	if !current.moveOn() {
+		return item, false, true
+	}
+
+	next, got, err := tryTake(input, state)
+	if !got {
+		return item, false, err == nil
+	}
+
+	current.took(state, next)
+
+	return next.item, !current.dropped(ctx, next), true
+}
+
+// NextAny waits for a message on any of the stage inputs, skipping nil ones
+// and dropping expired messages, and returns the index of its input. ok is false when that input got closed;
+// index is -1 once there is nothing left to wait for or the stage is asked to
+// stop.
+func NextAny[T any](ctx context.Context, inputs []chan T) (index int, item T, ok bool) {
+	current := runtimeFrom[T](ctx)
+
+	var stopping <-chan struct{}
+	if current != nil {
+		stopping = current.stopping
+	}
+
+	states := make([]*channelState, len(inputs))
+	for idx, input := range inputs {
+		states[idx] = current.stateOf(input)
+	}
+
+	for {
+		if !current.moveOn() {
+			return -1, item, false
+		}
+
+		index, next, err := takeAny(ctx, stopping, inputs, states)
+		if index < 0 {
+			return -1, item, false
+		}
+
+		if err != nil {
+			return index, next.item, false
+		}
+
+		current.took(states[index], next)
+
+		if !current.dropped(ctx, next) {
+			return index, next.item, true
+		}
+	}
+}
+
+func (r *stageRuntime[T]) stopped() bool {
+	if r == nil || r.stopping == nil {
+		return false
+	}
+
+	select {
+	case <-r.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Emit sends a message to a stage output following the channel overflow
+// policy. It reports false if the stage was stopped or the output closed
+// before the message could be delivered; the messages the stage took since its
+// last Next then go back in front of their channels and Next reports false, so
+// the handler should return. The time Emit waits for the output is not counted
+// in the stage latency.
+func Emit[T any](ctx context.Context, output chan T, item T) bool {
+	if waited, ok := ctx.Value(emitWaitKey{}).(*atomic.Int64); ok {
+		defer func(started time.Time) {
+			waited.Add(int64(time.Since(started)))
+		}(time.Now())
+	}
+
+	current := runtimeFrom[T](ctx)
+	current.measure()
+
+	if current != nil && current.slot != nil {
+		select {
+		case current.slot.events <- workerEvent[T]{item: item}:
+			return true
+		case <-ctx.Done():
+			current.abandon()
+
+			return false
+		}
+	}
+
+	err := sendExpiring(ctx, output, item, inheritedDeadline(ctx), current.stateOf(output))
+	if err != nil && !errors.Is(err, ErrChanFull) {
+		current.abandon()
+
+		return false
+	}
+
+	return true
+}
+
+// Process handles a single message on behalf of the current stage. A failed
+// message is retried and then failed, skipped or dead-lettered according to the
+// stage error policy; Process only returns an error when the stage must stop.
+// A message with a deadline is handled under a context ending at it, and
+// dropped once it expires.
+func Process[T any](ctx context.Context, item T, handle func(ctx context.Context, item T) error) error {
+	current := runtimeFrom[T](ctx)
+	if current == nil {
+		return handle(ctx, item)
+	}
+
+	current.measure()
+
+	if current.slot != nil {
+		defer current.slot.finish(ctx)
+	}
+
+	stats := &current.stage.stats
+	policy := current.stage.config.policy
+
+	deadline, hasDeadline := current.deadlineOf(item)
+	if current.expired(ctx, deadline, hasDeadline) {
+		return nil
+	}
+
+	messageCtx := ctx
+
+	if hasDeadline {
+		var cancel context.CancelFunc
+
+		messageCtx, cancel = messageContext(ctx, deadline)
+		defer cancel()
+	}
+
+	item = current.stamp(ctx, item)
+
+	for attempt := 0; ; attempt++ {
+		waited := new(atomic.Int64)
+		started := time.Now()
+		err := handleSafely(context.WithValue(messageCtx, emitWaitKey{}, waited), current.stage, item, handle)
+
+		stats.latency.Add(int64(time.Since(started)) - waited.Load())
+		stats.timed.Add(1)
+
+		if current.abandoned() {
+			return nil
+		}
+
+		if err != nil && ctx.Err() != nil {
+			// The stage stopped under the handler, which did not finish.
+			current.abandon()
+
+			return nil
+		}
+
+		if err == nil {
+			stats.processed.Add(1)
+
+			return nil
+		}
+
+		if deadlineExceeded(ctx, messageCtx) {
+			stats.expired.Add(1)
+
+			return nil
+		}
+
+		if attempt < policy.Retries && messageCtx.Err() == nil {
+			stats.retries.Add(1)
+
+			if sleep(messageCtx, policy.Delay(attempt)) {
+				continue
+			}
+
+			if deadlineExceeded(ctx, messageCtx) {
+				stats.expired.Add(1)
+
+				return nil
+			}
+		}
+
+		stats.errors.Add(1)
+
+		return current.fail(ctx, item, err)
+	}
+}
+
+func (r *stageRuntime[T]) fail(ctx context.Context, item T, err error) error {
+	switch r.stage.config.policy.Action {
+	case ActionSkip:
+		return nil
+	case ActionDeadLetter:
+		letter := DeadLetter[T]{Item: item, Err: err, Stage: r.stage.name}
+
+		select {
+		case r.deadLetter <- letter:
+			r.stage.stats.deadLettered.Add(1)
+		case <-ctx.Done():
+		}
+
+		return nil
+	case ActionFail:
+		return err
+	default:
+		return err
+	}
+}
+
+func handleSafely[T any](
+	ctx context.Context,
+	registered *stage[T],
+	item T,
+	handle func(ctx context.Context, item T) error,
+) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = registered.errorOf(fmt.Errorf("%w: %v", ErrStagePanic, recovered), debug.Stack())
+		}
+	}()
+
+	return handle(ctx, item)
+}
@@ -0,0 +1,62 @@
+package conveyer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// StageError reports the failure of one stage. Stack holds the handler stack
+// when the failure is a recovered panic.
+type StageError struct {
+	Kind    StageKind
+	Handler string
+	Inputs  []string
+	Outputs []string
+	Err     error
+	Stack   []byte
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s %q [%s] -> [%s]: %v",
+		e.Kind, e.Handler, strings.Join(e.Inputs, ", "), strings.Join(e.Outputs, ", "), e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+func (s *stage[T]) errorOf(err error, stack []byte) error {
+	if failed, ok := err.(*StageError); ok { //nolint:errorlint
+		return failed
+	}
+
+	return &StageError{
+		Kind:    s.kind,
+		Handler: s.name,
+		Inputs:  s.inputs,
+		Outputs: s.outputs,
+		Err:     err,
+		Stack:   stack,
+	}
+}
+
+// StageErrors lists the stage failures joined in err, such as the error
+// returned by Run.
+func StageErrors(err error) []*StageError {
+	var failures []*StageError
+
+	switch wrapped := err.(type) { //nolint:errorlint
+	case nil:
+	case *StageError:
+		failures = append(failures, wrapped)
+	case interface{ Unwrap() []error }:
+		for _, inner := range wrapped.Unwrap() {
+			failures = append(failures, StageErrors(inner)...)
+		}
+	default:
+		failures = StageErrors(errors.Unwrap(err))
+	}
+
+	return failures
+}
@@ -0,0 +1,100 @@
+package conveyer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+var errBroken = errors.New("broken")
+
+func brokenDecorator(context.Context, chan string, chan string) error {
+	return errBroken
+}
+
+func brokenSeparator(context.Context, chan string, []chan string) error {
+	return errBroken
+}
+
+func TestRunJoinsStageErrors(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(brokenDecorator, "a", "b")
+	conv.RegisterSeparator(brokenSeparator, "c", []string{"d", "e"})
+	conv.DeclareInputs("a", "c")
+	conv.DeclareOutputs("b", "d", "e")
+
+	err := conv.Run(context.Background())
+	require.ErrorIs(t, err, errBroken)
+
+	failures := conveyer.StageErrors(err)
+	require.Len(t, failures, 2)
+
+	byKind := make(map[conveyer.StageKind]*conveyer.StageError)
+	for _, failure := range failures {
+		byKind[failure.Kind] = failure
+	}
+
+	separator := byKind[conveyer.KindSeparator]
+	require.NotNil(t, separator)
+	assert.Equal(t, "conveyer_test.brokenSeparator", separator.Handler)
+	assert.Equal(t, []string{"c"}, separator.Inputs)
+	assert.Equal(t, []string{"d", "e"}, separator.Outputs)
+	assert.Nil(t, separator.Stack)
+	assert.EqualError(t, separator, `separator "conveyer_test.brokenSeparator" [c] -> [d, e]: broken`)
+
+	require.NotNil(t, byKind[conveyer.KindDecorator])
+	assert.Equal(t, []string{"a"}, byKind[conveyer.KindDecorator].Inputs)
+}
+
+func TestPanicBecomesStageError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("in the handler", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(func(context.Context, chan string, chan string) error {
+			panic("boom")
+		}, "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		err := conv.Run(context.Background())
+		require.ErrorIs(t, err, conveyer.ErrStagePanic)
+
+		var failure *conveyer.StageError
+		require.ErrorAs(t, err, &failure)
+		assert.Equal(t, conveyer.KindDecorator, failure.Kind)
+		assert.Contains(t, failure.Error(), "boom")
+		assert.Contains(t, string(failure.Stack), "TestPanicBecomesStageError")
+	})
+
+	t.Run("in a processed message", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(handlers.NewDecorator(panickyDecorator), "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		_, done := startConveyer(t, conv)
+
+		require.NoError(t, conv.Send("input", "panic"))
+
+		err := <-done
+		require.ErrorIs(t, err, conveyer.ErrStagePanic)
+
+		failures := conveyer.StageErrors(err)
+		require.Len(t, failures, 1)
+		assert.Equal(t, []string{"output"}, failures[0].Outputs)
+		assert.Contains(t, string(failures[0].Stack), "panickyDecorator")
+	})
+}
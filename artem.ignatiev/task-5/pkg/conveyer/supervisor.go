@@ -0,0 +1,110 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+var (
+	ErrStagePanic       = errors.New("stage panicked")
+	ErrRestartsExceeded = errors.New("restart budget exhausted")
+)
+
+// RestartEvent describes a stage restarted by the supervisor.
+type RestartEvent struct {
+	Stage   string
+	Kind    StageKind
+	Err     error
+	Restart int
+	Time    time.Time
+}
+
+// Supervisor restarts failed stages one-for-one. A stage may be restarted at most
+// MaxRestarts times within Window; one more failure shuts the whole pipeline down.
+type Supervisor struct {
+	MaxRestarts int
+	Window      time.Duration
+	Backoff     time.Duration
+	OnRestart   func(event RestartEvent)
+}
+
+// SetSupervisor enables stage supervision for the following runs.
+func (c *Conveyer[T]) SetSupervisor(supervisor Supervisor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.supervisor = &supervisor
+}
+
+func (c *Conveyer[T]) superviseStage(
+	ctx context.Context,
+	registered *stage[T],
+	inputs []chan T,
+	outputs []chan T,
+) error {
+	c.mu.Lock()
+	supervisor := c.supervisor
+	c.mu.Unlock()
+
+	var restarts []time.Time
+
+	for restart := 1; ; restart++ {
+		err := runStage(ctx, registered, inputs, outputs)
+		if err == nil || supervisor == nil || ctx.Err() != nil {
+			return err
+		}
+
+		now := ClockOf(ctx).Now()
+		restarts = pruneRestarts(restarts, now, supervisor.Window)
+
+		if len(restarts) >= supervisor.MaxRestarts {
+			return fmt.Errorf("%w after %d restarts: %w", ErrRestartsExceeded, len(restarts), err)
+		}
+
+		restarts = append(restarts, now)
+		registered.stats.restarts.Add(1)
+
+		if supervisor.OnRestart != nil {
+			supervisor.OnRestart(RestartEvent{
+				Stage:   registered.name,
+				Kind:    registered.kind,
+				Err:     err,
+				Restart: restart,
+				Time:    now,
+			})
+		}
+
+		if supervisor.Backoff > 0 && !sleep(ctx, supervisor.Backoff) {
+			return nil
+		}
+	}
+}
+
+func runStage[T any](ctx context.Context, registered *stage[T], inputs []chan T, outputs []chan T) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = registered.errorOf(fmt.Errorf("%w: %v", ErrStagePanic, recovered), debug.Stack())
+		}
+	}()
+
+	return registered.run(ctx, inputs, outputs)
+}
+
+func pruneRestarts(restarts []time.Time, now time.Time, window time.Duration) []time.Time {
+	if window <= 0 {
+		return restarts
+	}
+
+	kept := restarts[:0]
+
+	for _, at := range restarts {
+		if now.Sub(at) < window {
+			kept = append(kept, at)
+		}
+	}
+
+	return kept
+}
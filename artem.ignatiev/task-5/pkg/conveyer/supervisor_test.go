@@ -0,0 +1,118 @@
+package conveyer_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func panickyDecorator(item string) (string, error) {
+	if item == "panic" {
+		panic("unexpected payload")
+	}
+
+	return item + "!", nil
+}
+
+func TestSupervisor(t *testing.T) {
+	t.Parallel()
+
+	t.Run("restarts failed and panicking stages", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu     sync.Mutex
+			events []conveyer.RestartEvent
+		)
+
+		conv := conveyer.New(4)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated")
+		conv.RegisterDecorator(handlers.NewDecorator(panickyDecorator), "decorated", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+		conv.SetSupervisor(conveyer.Supervisor{
+			MaxRestarts: 5,
+			Window:      time.Minute,
+			OnRestart: func(event conveyer.RestartEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				events = append(events, event)
+			},
+		})
+
+		cancel, done := startConveyer(t, conv)
+
+		require.NoError(t, conv.Send("input", "no decorator"))
+		require.NoError(t, conv.Send("input", "first"))
+
+		res, err := conv.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, "decorated: first!", res)
+
+		require.NoError(t, conv.Send("decorated", "panic"))
+		require.NoError(t, conv.Send("input", "second"))
+
+		res, err = conv.Recv("output")
+		require.NoError(t, err)
+		assert.Equal(t, "decorated: second!", res)
+
+		cancel()
+		require.NoError(t, <-done)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		require.Len(t, events, 2)
+		require.ErrorIs(t, events[0].Err, handlers.ErrCantDecorate)
+		assert.Equal(t, "handlers.PrefixDecoratorFunc", events[0].Stage)
+		assert.Equal(t, 1, events[0].Restart)
+		require.ErrorIs(t, events[1].Err, conveyer.ErrStagePanic)
+		assert.Equal(t, conveyer.KindDecorator, events[1].Kind)
+
+		stats := conv.Stats()
+		assert.Equal(t, uint64(1), stats.Stages[0].Restarts)
+		assert.Equal(t, uint64(1), stats.Stages[1].Restarts)
+	})
+
+	t.Run("escalates when budget is exhausted", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(4)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+		conv.SetSupervisor(conveyer.Supervisor{MaxRestarts: 2, Window: time.Minute})
+
+		_, done := startConveyer(t, conv)
+
+		for range 3 {
+			require.NoError(t, conv.Send("input", "no decorator"))
+		}
+
+		err := <-done
+		require.ErrorIs(t, err, conveyer.ErrRestartsExceeded)
+		require.ErrorIs(t, err, handlers.ErrCantDecorate)
+		assert.Equal(t, uint64(2), conv.Stats().Stages[0].Restarts)
+	})
+
+	t.Run("panic without supervisor fails the run", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(handlers.NewDecorator(panickyDecorator), "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		_, done := startConveyer(t, conv)
+
+		require.NoError(t, conv.Send("input", "panic"))
+		require.ErrorIs(t, <-done, conveyer.ErrStagePanic)
+	})
+}
@@ -0,0 +1,145 @@
+package conveyer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrDanglingInput    = errors.New("channel has no producer")
+	ErrUnconsumedOutput = errors.New("channel has no consumer")
+	ErrCycle            = errors.New("stages form a cycle")
+	ErrMultipleWriters  = errors.New("channel is written by several stages")
+)
+
+// TopologyError names the channel and the stages responsible for a topology problem.
+type TopologyError struct {
+	Err     error
+	Channel string
+	Stages  []string
+}
+
+func (e *TopologyError) Error() string {
+	if e.Channel == "" {
+		return fmt.Sprintf("%v: %s", e.Err, strings.Join(e.Stages, " -> "))
+	}
+
+	return fmt.Sprintf("channel %q: %v (stages: %s)", e.Channel, e.Err, strings.Join(e.Stages, ", "))
+}
+
+func (e *TopologyError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks the registered stages for dangling inputs, unconsumed outputs,
+// channels with several writers and cycles. A channel read by stages but written
+// by none must be a declared input, one written but never read a declared output;
+// this catches misspelled channel names. All problems are joined into one error.
+func (c *Conveyer[T]) Validate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	producers := make(map[string][]*stage[T])
+	consumers := make(map[string][]*stage[T])
+
+	for _, registered := range c.stages {
+		for _, name := range registered.inputs {
+			consumers[name] = append(consumers[name], registered)
+		}
+
+		for _, name := range registered.outputs {
+			producers[name] = append(producers[name], registered)
+		}
+	}
+
+	var errs []error
+
+	for _, name := range c.channelsKey {
+		_, isInput := c.inputs[name]
+		_, isOutput := c.outputs[name]
+
+		switch {
+		case len(producers[name]) > 1:
+			errs = append(errs, &TopologyError{
+				Err: ErrMultipleWriters, Channel: name, Stages: stageNames(producers[name]),
+			})
+		case len(producers[name]) == 0 && len(consumers[name]) > 0 && !isInput:
+			errs = append(errs, &TopologyError{
+				Err: ErrDanglingInput, Channel: name, Stages: stageNames(consumers[name]),
+			})
+		}
+
+		if len(consumers[name]) == 0 && len(producers[name]) > 0 && !isOutput {
+			errs = append(errs, &TopologyError{
+				Err: ErrUnconsumedOutput, Channel: name, Stages: stageNames(producers[name]),
+			})
+		}
+	}
+
+	if cycle := c.findCycle(consumers); cycle != nil {
+		errs = append(errs, &TopologyError{Err: ErrCycle, Channel: "", Stages: stageNames(cycle)})
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Conveyer[T]) findCycle(consumers map[string][]*stage[T]) []*stage[T] {
+	const (
+		unvisited = iota
+		inProgress
+		finished
+	)
+
+	state := make(map[*stage[T]]int, len(c.stages))
+	path := make([]*stage[T], 0, len(c.stages))
+
+	var visit func(current *stage[T]) []*stage[T]
+
+	visit = func(current *stage[T]) []*stage[T] {
+		state[current] = inProgress
+		path = append(path, current)
+
+		for _, name := range current.outputs {
+			for _, next := range consumers[name] {
+				switch state[next] {
+				case inProgress:
+					for idx, onPath := range path {
+						if onPath == next {
+							return append(append([]*stage[T]{}, path[idx:]...), next)
+						}
+					}
+				case unvisited:
+					if cycle := visit(next); cycle != nil {
+						return cycle
+					}
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[current] = finished
+
+		return nil
+	}
+
+	for _, registered := range c.stages {
+		if state[registered] == unvisited {
+			if cycle := visit(registered); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+func stageNames[T any](stages []*stage[T]) []string {
+	names := make([]string, 0, len(stages))
+
+	for _, registered := range stages {
+		names = append(names, registered.String())
+	}
+
+	return names
+}
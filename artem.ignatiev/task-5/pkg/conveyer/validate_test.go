@@ -0,0 +1,121 @@
+package conveyer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func topologyErrors(t *testing.T, err error) []*conveyer.TopologyError {
+	t.Helper()
+
+	joined, ok := err.(interface{ Unwrap() []error }) //nolint:errorlint
+	require.True(t, ok, "expected joined error, got %v", err)
+
+	result := make([]*conveyer.TopologyError, 0)
+
+	for _, item := range joined.Unwrap() {
+		var topologyErr *conveyer.TopologyError
+
+		require.ErrorAs(t, item, &topologyErr)
+
+		result = append(result, topologyErr)
+	}
+
+	return result
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid topology", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("final_output")
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated")
+		conv.RegisterSeparator(handlers.SeparatorFunc, "decorated", []string{"part1", "part2"})
+		conv.RegisterMultiplexer(handlers.MultiplexerFunc, []string{"part1", "part2"}, "final_output")
+
+		require.NoError(t, conv.Validate())
+	})
+
+	t.Run("undeclared endpoints are reported", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated")
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "decoratd", "output")
+
+		problems := topologyErrors(t, conv.Validate())
+		require.Len(t, problems, 4)
+
+		channels := make([]string, 0, len(problems))
+		for _, problem := range problems {
+			channels = append(channels, problem.Channel)
+		}
+
+		assert.ElementsMatch(t, []string{"input", "decorated", "decoratd", "output"}, channels)
+	})
+
+	t.Run("dangling input and unconsumed output", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "decorated")
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "decoratd", "output")
+
+		err := conv.Validate()
+		require.ErrorIs(t, err, conveyer.ErrDanglingInput)
+		require.ErrorIs(t, err, conveyer.ErrUnconsumedOutput)
+
+		problems := topologyErrors(t, err)
+		require.Len(t, problems, 2)
+		assert.Equal(t, "decorated", problems[0].Channel)
+		assert.Equal(t, "decoratd", problems[1].Channel)
+		assert.Contains(t, problems[1].Stages[0], "PrefixDecoratorFunc#2")
+	})
+
+	t.Run("several writers", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "a", "out")
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "b", "out")
+		conv.DeclareInputs("a", "b")
+		conv.DeclareOutputs("out")
+
+		err := conv.Validate()
+		require.ErrorIs(t, err, conveyer.ErrMultipleWriters)
+
+		problems := topologyErrors(t, err)
+		require.Len(t, problems, 1)
+		assert.Len(t, problems[0].Stages, 2)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(1)
+		conv.RegisterMultiplexer(handlers.MultiplexerFunc, []string{"input", "loop"}, "merged")
+		conv.RegisterSeparator(handlers.SeparatorFunc, "merged", []string{"loop", "output"})
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		err := conv.Validate()
+		require.ErrorIs(t, err, conveyer.ErrCycle)
+
+		err = conv.Run(context.Background())
+		require.ErrorIs(t, err, conveyer.ErrCycle)
+		assert.False(t, errors.Is(err, conveyer.ErrMultipleWriters))
+	})
+}
@@ -0,0 +1,289 @@
+package conveyer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// WithWorkers runs n copies of the stage handler on the same channels.
+func WithWorkers(n int) StageOption {
+	return func(config *stageConfig) {
+		config.workers = max(n, 1)
+	}
+}
+
+// ErrOrderedHandler is returned by a stage with ordered output whose handler
+// takes or writes messages without Next, Process and Emit, which would break
+// the order.
+var ErrOrderedHandler = errors.New("ordered output needs a handler built on Next, Process and Emit")
+
+// WithOrderedOutput makes a decorator with several workers emit results in
+// input order. The handler must be built on Next, Process and Emit; the stage
+// fails with ErrOrderedHandler on the first message handled otherwise.
+func WithOrderedOutput() StageOption {
+	return func(config *stageConfig) {
+		config.ordered = true
+	}
+}
+
+type workerEvent[T any] struct {
+	item T
+	done bool
+}
+
+type orderSlot[T any] struct {
+	events   chan workerEvent[T]
+	handed   int
+	finished atomic.Int64
+}
+
+func (s *orderSlot[T]) finish(ctx context.Context) {
+	s.finished.Add(1)
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	select {
+	case s.events <- workerEvent[T]{done: true}:
+	case <-ctx.Done():
+	}
+}
+
+func (s *stage[T]) orderedWorkers() bool {
+	return s.config.ordered && s.kind == KindDecorator && s.config.workers > 1
+}
+
+func (c *Conveyer[T]) runStageWorkers(ctx context.Context, registered *stage[T], inputs, outputs []chan T) error {
+	current := runtimeFrom[T](ctx)
+
+	workers := registered.config.workers
+	if workers <= 1 {
+		return c.runWorker(ctx, current.worker(), registered, inputs, outputs)
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	if !registered.orderedWorkers() {
+		for range workers {
+			worker := current.worker()
+
+			group.Go(func() error {
+				return c.runWorker(groupCtx, worker, registered, inputs, outputs)
+			})
+		}
+
+		return group.Wait()
+	}
+
+	workerInputs := make([]chan T, workers)
+	slots := make([]*orderSlot[T], workers)
+	order := make(chan ordered[T], workers)
+
+	// Writes to the output outside Emit bypass the order, so the workers get
+	// a channel which only catches them.
+	unordered := make(chan T)
+	workerOutputs := []chan T{unordered}
+	working := sync.WaitGroup{}
+	workCtx, stopWork := context.WithCancel(groupCtx)
+
+	defer stopWork()
+
+	for idx := range workers {
+		workerInputs[idx] = make(chan T)
+		slots[idx] = &orderSlot[T]{events: make(chan workerEvent[T], max(c.chanSize, 1))}
+
+		worker := current.worker()
+		worker.slot = slots[idx]
+		worker.stopping = nil
+		workerInput := []chan T{workerInputs[idx]}
+
+		working.Add(1)
+		group.Go(func() error {
+			defer working.Done()
+
+			return c.runWorker(workCtx, worker, registered, workerInput, workerOutputs)
+		})
+	}
+
+	workersDone := make(chan struct{})
+
+	go func() {
+		working.Wait()
+		close(workersDone)
+	}()
+
+	group.Go(func() error {
+		var err error
+
+		for {
+			select {
+			case <-unordered:
+				if err == nil {
+					err = ErrOrderedHandler
+					stopWork()
+				}
+			case <-workersDone:
+				return err
+			}
+		}
+	})
+
+	source := current.stateOf(inputs[0])
+
+	group.Go(func() error {
+		return dispatchOrdered(workCtx, current.stopping, inputs[0], workerInputs, slots, order, source)
+	})
+
+	group.Go(func() error {
+		collectOrdered(workCtx, slots, order, outputs[0], current.stateOf(outputs[0]), source)
+
+		return nil
+	})
+
+	return group.Wait()
+}
+
+// runWorker runs one worker of a stage under supervision. The messages it took
+// since its last Next count as handled when it returns without error, and go
+// back in front of their channels when it fails or is stopped.
+func (c *Conveyer[T]) runWorker(
+	ctx context.Context,
+	worker *stageRuntime[T],
+	registered *stage[T],
+	inputs, outputs []chan T,
+) error {
+	err := c.superviseStage(context.WithValue(ctx, stageKey{}, worker), registered, inputs, outputs)
+	if err != nil || ctx.Err() != nil {
+		worker.abandon()
+	}
+
+	worker.release()
+
+	return err
+}
+
+// ordered is a message handed to the worker at index, in input order.
+type ordered[T any] struct {
+	index int
+	next  queued[T]
+}
+
+// dispatchOrdered hands the input to the workers in turn. When the stage is
+// drained it closes the worker inputs, so the workers finish what they hold.
+// A worker taking a message before it finished the previous one is not using
+// Process, and fails the stage.
+func dispatchOrdered[T any](
+	ctx context.Context,
+	stop <-chan struct{},
+	input chan T,
+	workerInputs []chan T,
+	slots []*orderSlot[T],
+	order chan<- ordered[T],
+	state *channelState,
+) error {
+	defer close(order)
+
+	defer func() {
+		for _, workerInput := range workerInputs {
+			close(workerInput)
+		}
+	}()
+
+	for index := 0; ; index = (index + 1) % len(workerInputs) {
+		next, _, err := takeUntil(ctx, stop, input, state)
+		if err != nil {
+			return nil
+		}
+
+		select {
+		case workerInputs[index] <- next.item:
+			handOver(state, next.item)
+		case <-ctx.Done():
+			putBack(state, next)
+
+			return nil
+		}
+
+		slot := slots[index]
+		slot.handed++
+
+		if slot.finished.Load() < int64(slot.handed-1) {
+			return ErrOrderedHandler
+		}
+
+		select {
+		case order <- ordered[T]{index: index, next: next}:
+		case <-ctx.Done():
+			frontOf[T](state).push(next)
+
+			return nil
+		}
+	}
+}
+
+// collectOrdered emits the results of the workers in input order and settles
+// each input message once its worker is done with it. When it has to give up,
+// the messages not done yet go back in front of the input.
+func collectOrdered[T any](
+	ctx context.Context,
+	slots []*orderSlot[T],
+	order <-chan ordered[T],
+	output chan T,
+	state *channelState,
+	source *channelState,
+) {
+	for handed := range order {
+		if !collectOne(ctx, slots[handed.index], handed, output, state, source) {
+			frontOf[T](source).push(handed.next)
+
+			for {
+				select {
+				case rest, ok := <-order:
+					if !ok {
+						return
+					}
+
+					frontOf[T](source).push(rest.next)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// collectOne emits the results of one message and settles it. It reports false
+// when the message was not done.
+func collectOne[T any](
+	ctx context.Context,
+	slot *orderSlot[T],
+	handed ordered[T],
+	output chan T,
+	state *channelState,
+	source *channelState,
+) bool {
+	for {
+		var event workerEvent[T]
+
+		select {
+		case event = <-slot.events:
+		case <-ctx.Done():
+			return false
+		}
+
+		if event.done {
+			settle(source, handed.next)
+
+			return true
+		}
+
+		if err := send(ctx, output, event.item, state); err != nil && !errors.Is(err, ErrChanFull) {
+			return false
+		}
+	}
+}
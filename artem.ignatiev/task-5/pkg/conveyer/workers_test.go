@@ -0,0 +1,225 @@
+package conveyer_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+const hashRounds = 2000
+
+func jitteryDecorator(item int) (int, error) {
+	time.Sleep(time.Duration((item*7)%5) * time.Millisecond)
+
+	return item * 10, nil
+}
+
+func burnCPU(item string) (string, error) {
+	sum := sha256.Sum256([]byte(item))
+
+	for range hashRounds {
+		sum = sha256.Sum256(sum[:])
+	}
+
+	return fmt.Sprintf("%x", sum[:4]), nil
+}
+
+func TestWorkers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ordered output", func(t *testing.T) {
+		t.Parallel()
+
+		const messages = 60
+
+		conv := conveyer.NewOf[int](4)
+		conv.RegisterDecorator(handlers.NewDecorator(jitteryDecorator), "input", "output",
+			conveyer.WithWorkers(4), conveyer.WithOrderedOutput())
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		cancel, done := startConveyer(t, conv)
+
+		go func() {
+			for idx := range messages {
+				_ = conv.Send("input", idx)
+			}
+		}()
+
+		for idx := range messages {
+			res, err := conv.Recv("output")
+			require.NoError(t, err)
+			require.Equal(t, idx*10, res)
+		}
+
+		cancel()
+		require.NoError(t, <-done)
+
+		stats := conv.Stats()
+		assert.Equal(t, uint64(messages), stats.Stages[0].Processed)
+		assert.Equal(t, uint64(messages), stats.Channels[0].Received)
+		assert.Equal(t, uint64(messages), stats.Channels[1].Sent)
+	})
+
+	t.Run("ordered output with skipped messages", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(2)
+		conv.RegisterDecorator(handlers.PrefixDecoratorFunc, "input", "output",
+			conveyer.WithWorkers(3), conveyer.WithOrderedOutput(),
+			conveyer.WithErrorPolicy(conveyer.SkipPolicy()))
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		cancel, done := startConveyer(t, conv)
+
+		go func() {
+			for _, item := range []string{"a", "no decorator", "b", "c", "no decorator", "d"} {
+				_ = conv.Send("input", item)
+			}
+		}()
+
+		for _, want := range []string{"a", "b", "c", "d"} {
+			res, err := conv.Recv("output")
+			require.NoError(t, err)
+			require.Equal(t, "decorated: "+want, res)
+		}
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	t.Run("ordered output rejects handlers bypassing Process", func(t *testing.T) {
+		t.Parallel()
+
+		bypassing := map[string]func(ctx context.Context, input chan string, output chan string) error{
+			"raw write": func(_ context.Context, input chan string, output chan string) error {
+				for item := range input {
+					output <- item
+				}
+
+				return nil
+			},
+			"emit without process": func(ctx context.Context, input chan string, output chan string) error {
+				for {
+					item, ok := conveyer.Next(ctx, input)
+					if !ok {
+						return nil
+					}
+
+					conveyer.Emit(ctx, output, item)
+				}
+			},
+		}
+
+		for name, handler := range bypassing {
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				conv := conveyer.New(4)
+				conv.RegisterDecorator(handler, "input", "output",
+					conveyer.WithWorkers(2), conveyer.WithOrderedOutput())
+				conv.DeclareInputs("input")
+				conv.DeclareOutputs("output")
+
+				_, done := startConveyer(t, conv)
+
+				go func() {
+					for _, item := range []string{"a", "b", "c", "d"} {
+						_ = conv.Send("input", item)
+					}
+				}()
+
+				require.ErrorIs(t, <-done, conveyer.ErrOrderedHandler)
+			})
+		}
+	})
+
+	t.Run("unordered workers share the input", func(t *testing.T) {
+		t.Parallel()
+
+		conv := conveyer.New(8)
+		conv.RegisterDecorator(handlers.NewDecorator(burnCPU), "input", "output", conveyer.WithWorkers(4))
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+
+		cancel, done := startConveyer(t, conv)
+
+		go func() {
+			for idx := range 20 {
+				_ = conv.Send("input", strconv.Itoa(idx))
+			}
+		}()
+
+		seen := make(map[string]struct{})
+
+		for range 20 {
+			res, err := conv.Recv("output")
+			require.NoError(t, err)
+
+			seen[res] = struct{}{}
+		}
+
+		cancel()
+		require.NoError(t, <-done)
+		assert.Len(t, seen, 20)
+	})
+}
+
+func benchmarkDecorator(b *testing.B, opts ...conveyer.StageOption) {
+	b.Helper()
+
+	conv := conveyer.New(64)
+	conv.RegisterDecorator(handlers.NewDecorator(burnCPU), "input", "output", opts...)
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	b.ResetTimer()
+
+	go func() {
+		for idx := range b.N {
+			_ = conv.Send("input", strconv.Itoa(idx))
+		}
+	}()
+
+	for range b.N {
+		if _, err := conv.Recv("output"); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+	cancel()
+
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkDecoratorSingleGoroutine(b *testing.B) {
+	benchmarkDecorator(b)
+}
+
+func BenchmarkDecoratorWorkers4(b *testing.B) {
+	benchmarkDecorator(b, conveyer.WithWorkers(4))
+}
+
+func BenchmarkDecoratorWorkers4Ordered(b *testing.B) {
+	benchmarkDecorator(b, conveyer.WithWorkers(4), conveyer.WithOrderedOutput())
+}
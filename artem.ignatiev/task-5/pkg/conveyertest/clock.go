@@ -0,0 +1,192 @@
+package conveyertest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// Epoch is where every virtual clock of a harness starts.
+var Epoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock is a virtual conveyer.Clock. Time only moves on Advance, which fires
+// the due timers and tickers in order.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	seq     uint64
+	changed chan struct{}
+}
+
+type waiter struct {
+	at     time.Time
+	seq    uint64
+	period time.Duration
+	ch     chan time.Time
+}
+
+var _ conveyer.Clock = (*Clock)(nil)
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start, changed: make(chan struct{})}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *Clock) NewTimer(d time.Duration) conveyer.Timer {
+	return &timer{clock: c, waiter: c.add(d, 0)}
+}
+
+// NewTicker panics on a non-positive period, like time.NewTicker.
+func (c *Clock) NewTicker(d time.Duration) conveyer.Ticker {
+	if d <= 0 {
+		panic("conveyertest: non-positive interval for NewTicker")
+	}
+
+	return &ticker{clock: c, waiter: c.add(d, d)}
+}
+
+func (c *Clock) add(d time.Duration, period time.Duration) *waiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	added := &waiter{at: c.now.Add(d), seq: c.seq, period: period, ch: make(chan time.Time, 1)}
+
+	if d <= 0 {
+		added.ch <- c.now
+
+		return added
+	}
+
+	c.waiters = append(c.waiters, added)
+	c.notifyLocked()
+
+	return added
+}
+
+func (c *Clock) remove(target *waiter) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for idx, pending := range c.waiters {
+		if pending == target {
+			c.waiters = append(c.waiters[:idx], c.waiters[idx+1:]...)
+			c.notifyLocked()
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Clock) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Pending reports how many timers and tickers wait for the clock.
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+// Advance moves the clock forward by d, firing every timer and ticker due on
+// the way at its own instant. A ticker whose last tick nobody read drops the
+// next one, like a time.Ticker.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.now.Add(d)
+
+	for {
+		sort.Slice(c.waiters, func(i, j int) bool {
+			if c.waiters[i].at.Equal(c.waiters[j].at) {
+				return c.waiters[i].seq < c.waiters[j].seq
+			}
+
+			return c.waiters[i].at.Before(c.waiters[j].at)
+		})
+
+		if len(c.waiters) == 0 || c.waiters[0].at.After(target) {
+			break
+		}
+
+		due := c.waiters[0]
+		c.now = due.at
+
+		select {
+		case due.ch <- due.at:
+		default:
+		}
+
+		if due.period > 0 {
+			due.at = due.at.Add(due.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+
+	c.now = target
+	c.notifyLocked()
+}
+
+// WaitTimers blocks until at least n timers and tickers are pending, so the
+// next Advance does not race a stage that is about to arm one.
+func (c *Clock) WaitTimers(ctx context.Context, n int) error {
+	for {
+		c.mu.Lock()
+		pending, changed := len(c.waiters), c.changed
+		c.mu.Unlock()
+
+		if pending >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("%d of %d timers pending: %w", pending, n, ctx.Err())
+		}
+	}
+}
+
+type timer struct {
+	clock  *Clock
+	waiter *waiter
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *timer) Stop() bool {
+	return t.clock.remove(t.waiter)
+}
+
+type ticker struct {
+	clock  *Clock
+	waiter *waiter
+}
+
+func (t *ticker) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *ticker) Stop() {
+	t.clock.remove(t.waiter)
+}
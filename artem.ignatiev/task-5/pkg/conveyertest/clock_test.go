@@ -0,0 +1,61 @@
+package conveyertest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyertest"
+)
+
+func TestClockFiresInOrder(t *testing.T) {
+	t.Parallel()
+
+	clock := conveyertest.NewClock(conveyertest.Epoch)
+
+	late := clock.NewTimer(3 * time.Second)
+	early := clock.NewTimer(time.Second)
+	stopped := clock.NewTimer(2 * time.Second)
+	ticker := clock.NewTicker(time.Second)
+
+	assert.True(t, stopped.Stop())
+	assert.Equal(t, 3, clock.Pending())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, conveyertest.Epoch.Add(time.Second), <-early.C())
+	assert.Equal(t, conveyertest.Epoch.Add(time.Second), <-ticker.C())
+	assert.Empty(t, late.C())
+
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, conveyertest.Epoch.Add(3*time.Second), <-late.C())
+	assert.Equal(t, conveyertest.Epoch.Add(2*time.Second), <-ticker.C(), "unread ticks are dropped")
+	assert.Equal(t, conveyertest.Epoch.Add(6*time.Second), clock.Now())
+	assert.False(t, late.Stop())
+
+	ticker.Stop()
+	assert.Zero(t, clock.Pending())
+}
+
+func TestClockWaitTimers(t *testing.T) {
+	t.Parallel()
+
+	clock := conveyertest.NewClock(conveyertest.Epoch)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		clock.NewTimer(time.Second)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, clock.WaitTimers(ctx, 1))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, clock.WaitTimers(ctx, 2), context.DeadlineExceeded)
+}
@@ -0,0 +1,323 @@
+// Package conveyertest runs a conveyer under test on a virtual clock, scripts
+// its inputs, records every output channel and checks that no goroutine
+// outlives the run.
+package conveyertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// waitTimeout bounds every wait of the harness so a stuck conveyer fails the
+// test instead of hanging it.
+const (
+	waitTimeout = 5 * time.Second
+	leakTimeout = time.Second
+)
+
+// Harness runs one conveyer for the lifetime of a test.
+type Harness[T any] struct {
+	t       testing.TB
+	conv    *conveyer.Conveyer[T]
+	clock   *Clock
+	label   string
+	cancel  context.CancelFunc
+	done    chan error
+	taps    sync.WaitGroup
+	mu      sync.Mutex
+	outputs map[string][]T
+	events  []Event[T]
+	changed chan struct{}
+	stopped bool
+	err     error
+}
+
+// Step is one scripted move: send Items to Send, wait for Timers pending timers
+// and then advance the clock by Advance. Zero fields are skipped.
+type Step[T any] struct {
+	Send    string
+	Items   []T
+	Timers  int
+	Advance time.Duration
+}
+
+// New puts conv on a virtual clock starting at Epoch, observes its channels,
+// runs it and taps every output channel. The harness stops with the test.
+func New[T any](t testing.TB, conv *conveyer.Conveyer[T]) *Harness[T] {
+	t.Helper()
+
+	clock := NewClock(Epoch)
+	conv.SetClock(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	harness := &Harness[T]{
+		t:       t,
+		conv:    conv,
+		clock:   clock,
+		label:   nextLabel(),
+		cancel:  cancel,
+		done:    make(chan error, 1),
+		outputs: make(map[string][]T),
+		changed: make(chan struct{}),
+	}
+
+	conv.SetObserver(harness.observe)
+
+	names := conv.Outputs()
+	for _, name := range names {
+		harness.outputs[name] = nil
+	}
+
+	harness.taps.Add(len(names))
+
+	goWithLabel(ctx, harness.label, func(ctx context.Context) {
+		for _, name := range names {
+			go harness.tap(name)
+		}
+
+		harness.done <- conv.Run(ctx)
+	})
+
+	t.Cleanup(func() {
+		if err := harness.Stop(); err != nil {
+			t.Errorf("conveyer run: %v", err)
+		}
+	})
+
+	return harness
+}
+
+func (h *Harness[T]) tap(name string) {
+	defer h.taps.Done()
+
+	for {
+		item, err := h.conv.Recv(name)
+		if err != nil {
+			return
+		}
+
+		h.mu.Lock()
+		h.outputs[name] = append(h.outputs[name], item)
+		h.recordLocked(Event[T]{Kind: EventOutput, Chan: name, Item: item})
+		h.notifyLocked()
+		h.mu.Unlock()
+	}
+}
+
+// observe records the traffic of the conveyer channels.
+func (h *Harness[T]) observe(op conveyer.ChannelOp, name string, item T) {
+	kind := EventWrite
+	if op == conveyer.OpRecv {
+		kind = EventRead
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.recordLocked(Event[T]{Kind: kind, Chan: name, Item: item})
+}
+
+func (h *Harness[T]) notifyLocked() {
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+func (h *Harness[T]) recordLocked(event Event[T]) {
+	event.At = h.clock.Now().Sub(Epoch)
+	h.events = append(h.events, event)
+}
+
+func (h *Harness[T]) Clock() *Clock {
+	return h.clock
+}
+
+// Send writes items to a channel of the conveyer and fails the test if it
+// does not accept them.
+func (h *Harness[T]) Send(name string, items ...T) {
+	h.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	for _, item := range items {
+		h.mu.Lock()
+		h.recordLocked(Event[T]{Kind: EventSend, Chan: name, Item: item})
+		h.mu.Unlock()
+
+		if err := h.conv.SendContext(ctx, name, item); err != nil {
+			h.t.Fatalf("send to %q: %v", name, err)
+		}
+	}
+}
+
+// Advance waits until the stages took every message sent so far and timers
+// timers are pending, then moves the virtual clock by d.
+func (h *Harness[T]) Advance(d time.Duration, timers int) {
+	h.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if err := h.settle(ctx); err != nil {
+		h.t.Fatalf("advance by %v: %v", d, err)
+	}
+
+	if err := h.clock.WaitTimers(ctx, timers); err != nil {
+		h.t.Fatalf("advance by %v: %v", d, err)
+	}
+
+	h.mu.Lock()
+	h.recordLocked(Event[T]{Kind: EventAdvance, Advance: d, Timers: timers})
+	h.mu.Unlock()
+
+	h.clock.Advance(d)
+}
+
+// settle waits until no channel holds a message, so a clock move does not race
+// the messages sent before it.
+func (h *Harness[T]) settle(ctx context.Context) error {
+	for {
+		idle := true
+
+		for _, channel := range h.conv.Stats().Channels {
+			if channel.Depth > 0 {
+				idle = false
+
+				break
+			}
+		}
+
+		if idle {
+			return nil
+		}
+
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			return fmt.Errorf("messages left in channels: %w", ctx.Err())
+		}
+	}
+}
+
+// Play runs the steps in order.
+func (h *Harness[T]) Play(steps ...Step[T]) {
+	h.t.Helper()
+
+	for _, step := range steps {
+		if step.Send != "" {
+			h.Send(step.Send, step.Items...)
+		}
+
+		if step.Advance > 0 || step.Timers > 0 {
+			h.Advance(step.Advance, step.Timers)
+		}
+	}
+}
+
+// WaitFor blocks until the output channel got at least n messages.
+func (h *Harness[T]) WaitFor(name string, n int) {
+	h.t.Helper()
+
+	timeout := time.NewTimer(waitTimeout)
+	defer timeout.Stop()
+
+	for {
+		h.mu.Lock()
+		got, changed := len(h.outputs[name]), h.changed
+		h.mu.Unlock()
+
+		if got >= n {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timeout.C:
+			h.t.Fatalf("output %q: got %d of %d messages", name, got, n)
+
+			return
+		}
+	}
+}
+
+// Outputs returns a copy of what every tapped channel received so far.
+func (h *Harness[T]) Outputs() map[string][]T {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	outputs := make(map[string][]T, len(h.outputs))
+
+	for name, items := range h.outputs {
+		outputs[name] = append([]T(nil), items...)
+	}
+
+	return outputs
+}
+
+// AssertOutputs checks every tapped channel against want; a channel missing
+// from want must have received nothing. Call it after WaitFor or Stop.
+func (h *Harness[T]) AssertOutputs(want map[string][]T) bool {
+	h.t.Helper()
+
+	expected := make(map[string][]T)
+
+	for name, items := range want {
+		if len(items) > 0 {
+			expected[name] = items
+		}
+	}
+
+	got := make(map[string][]T)
+
+	for name, items := range h.Outputs() {
+		if len(items) > 0 {
+			got[name] = items
+		}
+	}
+
+	return assert.Equal(h.t, expected, got)
+}
+
+// Stop cancels the run, waits for it and the taps to finish and fails the
+// test if any goroutine started by the conveyer is still alive. It returns
+// the error of the run; later calls return the same error.
+func (h *Harness[T]) Stop() error {
+	h.t.Helper()
+
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+
+		return h.err
+	}
+
+	h.stopped = true
+	h.mu.Unlock()
+
+	h.cancel()
+
+	select {
+	case err := <-h.done:
+		h.err = err
+	case <-time.After(waitTimeout):
+		h.t.Errorf("conveyer did not stop in %v", waitTimeout)
+
+		return errors.New("conveyer did not stop")
+	}
+
+	h.taps.Wait()
+
+	if stacks := leaked(h.label, leakTimeout); len(stacks) > 0 {
+		h.t.Errorf("%d goroutines leaked by the conveyer:\n\n%s", len(stacks), joinStacks(stacks))
+	}
+
+	return h.err
+}
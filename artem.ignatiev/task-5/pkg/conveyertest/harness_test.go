@@ -0,0 +1,126 @@
+package conveyertest_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/conveyertest"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func batching() *conveyer.Conveyer[string] {
+	conv := conveyer.New(4)
+	conv.RegisterDecorator(handlers.NewBatcher(3, time.Minute, func(batch []string) string {
+		return strings.Join(batch, "+")
+	}), "input", "batched")
+	conv.RegisterSeparator(handlers.SeparatorFunc, "batched", []string{"left", "right"})
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("left", "right")
+
+	return conv
+}
+
+func TestHarnessDrivesTime(t *testing.T) {
+	t.Parallel()
+
+	conv := batching()
+	harness := conveyertest.New(t, conv)
+
+	harness.Play(conveyertest.Step[string]{Send: "input", Items: []string{"a", "b", "c", "d", "e"}})
+	require.Eventually(t, func() bool {
+		return conv.Stats().Channels[0].Received == 5
+	}, time.Second, time.Millisecond)
+
+	harness.Play(conveyertest.Step[string]{Timers: 1, Advance: 30 * time.Second})
+	harness.WaitFor("left", 1)
+	assert.Empty(t, harness.Outputs()["right"])
+
+	harness.Play(conveyertest.Step[string]{Advance: 30 * time.Second})
+	harness.WaitFor("right", 1)
+	harness.AssertOutputs(map[string][]string{
+		"left":  {"a+b+c"},
+		"right": {"d+e"},
+	})
+
+	require.NoError(t, harness.Stop())
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	recorder := conveyertest.New(t, batching())
+
+	recorder.Send("input", "a", "b")
+	recorder.Advance(time.Minute, 1)
+	recorder.WaitFor("left", 1)
+	recorder.Send("input", "c")
+	recorder.Advance(time.Minute, 1)
+	recorder.WaitFor("right", 1)
+	require.NoError(t, recorder.Stop())
+
+	var saved bytes.Buffer
+	require.NoError(t, recorder.Recording().Save(&saved))
+
+	recording, err := conveyertest.LoadRecording[string](&saved)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"left": {"a+b"}, "right": {"c"}}, recording.Outputs())
+	assert.Equal(t, []string{"a+b", "c"}, recording.Written()["batched"], "stage writes are recorded")
+
+	replayer := conveyertest.New(t, batching())
+	assert.True(t, replayer.Replay(recording))
+
+	_, err = conveyertest.LoadRecording[string](strings.NewReader(`{"kind":"jump"}`))
+	require.ErrorIs(t, err, conveyertest.ErrBadRecording)
+}
+
+// fakeT collects the failures of a harness which is expected to fail.
+type fakeT struct {
+	testing.TB
+
+	mu     sync.Mutex
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Cleanup(func()) {}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestHarnessReportsLeaks(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	conv := conveyer.New(1)
+	conv.RegisterDecorator(func(ctx context.Context, input chan string, output chan string) error {
+		go func() { <-release }()
+
+		return handlers.PrefixDecoratorFunc(ctx, input, output)
+	}, "input", "output")
+	conv.DeclareInputs("input")
+	conv.DeclareOutputs("output")
+
+	fake := &fakeT{TB: t}
+	harness := conveyertest.New[string](fake, conv)
+
+	require.NoError(t, harness.Stop())
+	require.Len(t, fake.errors, 1)
+	assert.Contains(t, fake.errors[0], "1 goroutines leaked")
+	assert.Contains(t, fake.errors[0], "TestHarnessReportsLeaks")
+}
@@ -0,0 +1,62 @@
+package conveyertest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const labelKey = "conveyertest"
+
+var harnesses atomic.Uint64
+
+func nextLabel() string {
+	return fmt.Sprintf("harness-%d", harnesses.Add(1))
+}
+
+// goWithLabel starts fn in a goroutine tagged with label. Goroutines it starts
+// inherit the tag, which is how leaks are told apart from other tests.
+func goWithLabel(ctx context.Context, label string, fn func(ctx context.Context)) {
+	go pprof.Do(ctx, pprof.Labels(labelKey, label), fn)
+}
+
+// labelled returns the stacks of the live goroutines tagged with label.
+func labelled(label string) []string {
+	var profile bytes.Buffer
+
+	_ = pprof.Lookup("goroutine").WriteTo(&profile, 1)
+
+	tag := fmt.Sprintf("%q:%q", labelKey, label)
+	stacks := make([]string, 0)
+
+	for _, record := range strings.Split(profile.String(), "\n\n") {
+		if strings.Contains(record, "# labels:") && strings.Contains(record, tag) {
+			stacks = append(stacks, strings.TrimSpace(record))
+		}
+	}
+
+	return stacks
+}
+
+// leaked polls until no goroutine tagged with label is left or the timeout
+// passes, and returns what is still alive.
+func leaked(label string, timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		stacks := labelled(label)
+		if len(stacks) == 0 || time.Now().After(deadline) {
+			return stacks
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func joinStacks(stacks []string) string {
+	return strings.Join(stacks, "\n\n")
+}
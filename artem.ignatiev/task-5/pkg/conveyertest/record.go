@@ -0,0 +1,157 @@
+package conveyertest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrBadRecording = errors.New("bad recording")
+
+type EventKind string
+
+const (
+	EventSend    EventKind = "send"
+	EventAdvance EventKind = "advance"
+	EventOutput  EventKind = "output"
+	// EventWrite and EventRead are the traffic of the conveyer channels, seen
+	// by its observer.
+	EventWrite EventKind = "write"
+	EventRead  EventKind = "read"
+)
+
+// Event is one step of a recorded run. At is the virtual time since Epoch.
+type Event[T any] struct {
+	At      time.Duration `json:"at"`
+	Kind    EventKind     `json:"kind"`
+	Chan    string        `json:"chan,omitempty"`
+	Item    T             `json:"item,omitempty"`
+	Advance time.Duration `json:"advance,omitempty"`
+	Timers  int           `json:"timers,omitempty"`
+}
+
+// Recording is the sends, clock moves and outputs of a harness and the
+// messages written to and read from every channel of its conveyer, in the
+// order they happened.
+type Recording[T any] struct {
+	Events []Event[T]
+}
+
+// Recording returns what the harness did and saw so far.
+func (h *Harness[T]) Recording() Recording[T] {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return Recording[T]{Events: append([]Event[T](nil), h.events...)}
+}
+
+// Save writes the recording as JSON lines, one event per line.
+func (r Recording[T]) Save(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+
+	for _, event := range r.Events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("save recording: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// LoadRecording reads a recording written by Save.
+func LoadRecording[T any](r io.Reader) (Recording[T], error) {
+	var recording Recording[T]
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var event Event[T]
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return recording, fmt.Errorf("%w: line %d: %w", ErrBadRecording, line, err)
+		}
+
+		switch event.Kind {
+		case EventSend, EventAdvance, EventOutput, EventWrite, EventRead:
+		default:
+			return recording, fmt.Errorf("%w: line %d: unknown event %q", ErrBadRecording, line, event.Kind)
+		}
+
+		recording.Events = append(recording.Events, event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return recording, fmt.Errorf("load recording: %w", err)
+	}
+
+	return recording, nil
+}
+
+// Outputs groups the recorded outputs by channel.
+func (r Recording[T]) Outputs() map[string][]T {
+	outputs := make(map[string][]T)
+
+	for _, event := range r.Events {
+		if event.Kind == EventOutput {
+			outputs[event.Chan] = append(outputs[event.Chan], event.Item)
+		}
+	}
+
+	return outputs
+}
+
+// Written groups the messages written to the channels by channel.
+func (r Recording[T]) Written() map[string][]T {
+	written := make(map[string][]T)
+
+	for _, event := range r.Events {
+		if event.Kind == EventWrite {
+			written[event.Chan] = append(written[event.Chan], event.Item)
+		}
+	}
+
+	return written
+}
+
+// Replay repeats the sends and clock moves of a recording. Before each of
+// them it waits for the outputs recorded ahead of it, so the replay follows
+// the same order of events. It then asserts the outputs match.
+func (h *Harness[T]) Replay(recording Recording[T]) bool {
+	h.t.Helper()
+
+	seen := make(map[string]int)
+
+	for _, event := range recording.Events {
+		switch event.Kind {
+		case EventSend, EventAdvance:
+			for name, count := range seen {
+				h.WaitFor(name, count)
+			}
+		case EventOutput, EventWrite, EventRead:
+		}
+
+		switch event.Kind {
+		case EventSend:
+			h.Send(event.Chan, event.Item)
+		case EventAdvance:
+			h.Advance(event.Advance, event.Timers)
+		case EventOutput:
+			seen[event.Chan]++
+		case EventWrite, EventRead:
+		}
+	}
+
+	for name, count := range seen {
+		h.WaitFor(name, count)
+	}
+
+	return h.AssertOutputs(recording.Outputs())
+}
@@ -0,0 +1,186 @@
+package expr
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type callFunc func(args []any) (any, error)
+
+// builtin is a function of the language. params of typeAny take any value;
+// bind, when set, builds the call from the arguments at compile time.
+type builtin struct {
+	params []Type
+	result Type
+	call   callFunc
+	bind   func(args []node, p *parser) (callFunc, error)
+}
+
+var builtins = map[string]builtin{
+	"upper":      stringFunc(strings.ToUpper),
+	"lower":      stringFunc(strings.ToLower),
+	"trim":       stringFunc(strings.TrimSpace),
+	"len":        {params: []Type{String}, result: Int, call: length, bind: nil},
+	"contains":   stringTest(strings.Contains),
+	"startsWith": stringTest(strings.HasPrefix),
+	"endsWith":   stringTest(strings.HasSuffix),
+	"replace":    {params: []Type{String, String, String}, result: String, call: replace, bind: nil},
+	"substr":     {params: []Type{String, Int, Int}, result: String, call: substr, bind: nil},
+	"match":      {params: []Type{String, String}, result: Bool, call: nil, bind: bindMatch},
+	"hash":       {params: []Type{typeAny}, result: Int, call: hash, bind: nil},
+	"str":        {params: []Type{typeAny}, result: String, call: str, bind: nil},
+	"int":        {params: []Type{typeAny}, result: Int, call: toInt, bind: nil},
+	"float":      {params: []Type{typeAny}, result: Float, call: toFloatFunc, bind: nil},
+}
+
+func (b builtin) compile(ident token, args []node, p *parser) (node, error) {
+	if len(args) != len(b.params) {
+		return node{}, p.typeError(ident.pos, "%s takes %d arguments, got %d", ident.text, len(b.params), len(args))
+	}
+
+	for idx, arg := range args {
+		if b.params[idx] != typeAny && arg.typ != b.params[idx] {
+			return node{}, p.typeError(arg.pos, "argument %d of %s is %s, want %s",
+				idx+1, ident.text, arg.typ, b.params[idx])
+		}
+	}
+
+	call := b.call
+
+	if b.bind != nil {
+		var err error
+		if call, err = b.bind(args, p); err != nil {
+			return node{}, err
+		}
+	}
+
+	return newNode(b.result, ident.pos, func(e *env) (any, error) {
+		values := make([]any, len(args))
+
+		for idx, arg := range args {
+			value, err := arg.eval(e)
+			if err != nil {
+				return nil, err
+			}
+
+			values[idx] = value
+		}
+
+		value, err := call(values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ident.text, err)
+		}
+
+		return value, e.check()
+	}), nil
+}
+
+func stringFunc(fn func(text string) string) builtin {
+	return builtin{
+		params: []Type{String},
+		result: String,
+		call:   func(args []any) (any, error) { return fn(asString(args[0])), nil },
+		bind:   nil,
+	}
+}
+
+func stringTest(fn func(text string, part string) bool) builtin {
+	return builtin{
+		params: []Type{String, String},
+		result: Bool,
+		call:   func(args []any) (any, error) { return fn(asString(args[0]), asString(args[1])), nil },
+		bind:   nil,
+	}
+}
+
+func length(args []any) (any, error) {
+	return int64(utf8.RuneCountInString(asString(args[0]))), nil
+}
+
+func replace(args []any) (any, error) {
+	return strings.ReplaceAll(asString(args[0]), asString(args[1]), asString(args[2])), nil
+}
+
+// substr takes the runes from start up to end, clamped to the string.
+func substr(args []any) (any, error) {
+	runes := []rune(asString(args[0]))
+	start := min(max(asInt(args[1]), 0), int64(len(runes)))
+	end := min(max(asInt(args[2]), start), int64(len(runes)))
+
+	return string(runes[start:end]), nil
+}
+
+// bindMatch compiles the pattern once, so it has to be a literal.
+func bindMatch(args []node, p *parser) (callFunc, error) {
+	pattern, ok := args[1].literal.(string)
+	if !ok {
+		return nil, p.fail(ErrBadArgument, args[1].pos, "pattern of match must be a string literal")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, p.fail(ErrBadArgument, args[1].pos, "%v", err)
+	}
+
+	return func(args []any) (any, error) {
+		return re.MatchString(asString(args[0])), nil
+	}, nil
+}
+
+// hash agrees with the hash routing strategy: FNV-1a of the formatted value.
+func hash(args []any) (any, error) {
+	sum := fnv.New32a()
+	_, _ = sum.Write([]byte(fmt.Sprint(args[0])))
+
+	return int64(sum.Sum32()), nil
+}
+
+func str(args []any) (any, error) {
+	return fmt.Sprint(args[0]), nil
+}
+
+func toInt(args []any) (any, error) {
+	switch value := args[0].(type) {
+	case string:
+		number, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not an int", ErrBadArgument, value)
+		}
+
+		return number, nil
+	case float64:
+		return int64(value), nil
+	case bool:
+		if value {
+			return int64(1), nil
+		}
+
+		return int64(0), nil
+	default:
+		return value, nil
+	}
+}
+
+func toFloatFunc(args []any) (any, error) {
+	switch value := args[0].(type) {
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not a float", ErrBadArgument, value)
+		}
+
+		return number, nil
+	case bool:
+		if value {
+			return 1.0, nil
+		}
+
+		return 0.0, nil
+	default:
+		return toFloat(value), nil
+	}
+}
@@ -0,0 +1,191 @@
+// Package expr is a small expression language for message handlers. An
+// expression sees the message as msg and yields one value, for example
+// upper(msg), len(msg) > 5 or hash(msg) % 3. Expressions are type checked when
+// they are compiled and evaluated without reflection or cgo.
+package expr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrSyntax      = errors.New("syntax error")
+	ErrType        = errors.New("type error")
+	ErrUnknownName = errors.New("unknown name")
+	ErrTimeout     = errors.New("expression timed out")
+	ErrDivByZero   = errors.New("integer division by zero")
+	ErrBadArgument = errors.New("bad argument")
+)
+
+// DefaultTimeout bounds one evaluation unless WithTimeout says otherwise.
+const DefaultTimeout = 10 * time.Millisecond
+
+// Type is the static type of an expression.
+type Type int
+
+const (
+	typeAny Type = iota
+	String
+	Int
+	Float
+	Bool
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case Bool:
+		return "bool"
+	default:
+		return "any"
+	}
+}
+
+func (t Type) numeric() bool {
+	return t == Int || t == Float
+}
+
+type options struct {
+	timeout time.Duration
+	msg     Type
+	result  Type
+}
+
+type Option func(opts *options)
+
+// WithTimeout bounds one evaluation; zero or less disables the bound.
+func WithTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.timeout = timeout
+	}
+}
+
+// WithMsg sets the type of msg, a string by default.
+func WithMsg(msg Type) Option {
+	return func(opts *options) {
+		opts.msg = msg
+	}
+}
+
+// Expect makes Compile fail unless the expression yields result.
+func Expect(result Type) Option {
+	return func(opts *options) {
+		opts.result = result
+	}
+}
+
+// Program is a compiled expression, safe for concurrent use.
+type Program struct {
+	src     string
+	root    node
+	msg     Type
+	timeout time.Duration
+}
+
+// Compile parses and type checks src. Errors name the column they were found at.
+func Compile(src string, opts ...Option) (*Program, error) {
+	settings := options{timeout: DefaultTimeout, msg: String, result: typeAny}
+
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	root, err := parse(src, settings.msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.result != typeAny && root.typ != settings.result {
+		return nil, fmt.Errorf("%w in %q: expression gives %s, want %s", ErrType, src, root.typ, settings.result)
+	}
+
+	return &Program{src: src, root: root, msg: settings.msg, timeout: settings.timeout}, nil
+}
+
+func (p *Program) String() string {
+	return p.src
+}
+
+// Type is the type of the values Eval returns: string, int64, float64 or bool.
+func (p *Program) Type() Type {
+	return p.root.typ
+}
+
+// Eval runs the program for one message. It stops with ErrTimeout once the
+// timeout passes and with the context error when ctx ends; both are checked
+// between operations.
+func (p *Program) Eval(ctx context.Context, msg any) (any, error) {
+	if typeOf(msg) != p.msg {
+		return nil, fmt.Errorf("%w: msg is %T, want %s", ErrType, msg, p.msg)
+	}
+
+	run := env{ctx: ctx, msg: msg, deadline: time.Time{}, steps: 0}
+	if p.timeout > 0 {
+		run.deadline = time.Now().Add(p.timeout)
+	}
+
+	if err := run.check(); err != nil {
+		return nil, err
+	}
+
+	value, err := p.root.eval(&run)
+	if err != nil {
+		return nil, fmt.Errorf("eval %q: %w", p.src, err)
+	}
+
+	return value, nil
+}
+
+func typeOf(value any) Type {
+	switch value.(type) {
+	case string:
+		return String
+	case int64:
+		return Int
+	case float64:
+		return Float
+	case bool:
+		return Bool
+	default:
+		return typeAny
+	}
+}
+
+// checkEvery is how many operations run between deadline checks.
+const checkEvery = 16
+
+type env struct {
+	ctx      context.Context
+	msg      any
+	deadline time.Time
+	steps    int
+}
+
+func (e *env) tick() error {
+	e.steps++
+	if e.steps%checkEvery != 0 {
+		return nil
+	}
+
+	return e.check()
+}
+
+func (e *env) check() error {
+	if err := e.ctx.Err(); err != nil {
+		return fmt.Errorf("eval: %w", err)
+	}
+
+	if !e.deadline.IsZero() && time.Now().After(e.deadline) {
+		return ErrTimeout
+	}
+
+	return nil
+}
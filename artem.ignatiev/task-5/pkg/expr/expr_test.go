@@ -0,0 +1,142 @@
+package expr_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/expr"
+)
+
+func eval(t *testing.T, src string, msg any, opts ...expr.Option) any {
+	t.Helper()
+
+	program, err := expr.Compile(src, opts...)
+	require.NoError(t, err)
+
+	value, err := program.Eval(context.Background(), msg)
+	require.NoError(t, err)
+
+	return value
+}
+
+func TestEval(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want any
+	}{
+		{`upper(msg)`, "HELLO, WORLD"},
+		{`len(msg) > 5`, true},
+		{`hash(msg) % 3`, int64(2)},
+		{`"<" + trim(" " + msg + " ") + ">"`, "<hello, world>"},
+		{`1 + 2 * 3 - 4 / 2`, int64(5)},
+		{`7 % 4 + 0.5`, 3.5},
+		{`-(2 + 3) * 2`, int64(-10)},
+		{`contains(msg, "world") && !startsWith(msg, "world")`, true},
+		{`endsWith(msg, "x") || len(msg) == 12`, true},
+		{`len(msg) >= 12 ? substr(msg, 0, 5) : msg`, "hello"},
+		{`true ? 1 : 2.5`, 1.0},
+		{`replace(msg, "l", "L")`, "heLLo, worLd"},
+		{`match(msg, "^h.*d$")`, true},
+		{`int("42") + int(2.9) + int(true)`, int64(45)},
+		{`float("1.5") + 1`, 2.5},
+		{`str(len(msg)) + "!"`, "12!"},
+		{`"a" < "b" && 2 == 2.0 && 1 != 2`, true},
+		{"`raw \\n` + \"\\t\"", "raw \\n\t"},
+		{`substr("héllo", 1, 100)`, "éllo"},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, eval(t, tc.src, "hello, world"), tc.src)
+	}
+
+	assert.Equal(t, int64(14), eval(t, `msg * 2`, int64(7), expr.WithMsg(expr.Int)))
+}
+
+func TestCompileErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src     string
+		kind    error
+		message string
+	}{
+		{`len(msg) >`, expr.ErrSyntax, `column 11 of "len(msg) >": expected an operand, found end of expression`},
+		{`upper(msg`, expr.ErrSyntax, `expected "," or ")", found end of expression`},
+		{`msg msg`, expr.ErrSyntax, `column 5 of "msg msg": expected an operator, found "msg"`},
+		{`"open`, expr.ErrSyntax, "unterminated string"},
+		{`msg # 1`, expr.ErrSyntax, `unexpected character '#'`},
+		{`99999999999999999999`, expr.ErrSyntax, "out of range"},
+		{`shout(msg)`, expr.ErrUnknownName, `column 1 of "shout(msg)": no function "shout"`},
+		{`message`, expr.ErrUnknownName, `"message" is not msg, true or false`},
+		{`msg + 1`, expr.ErrType, `column 5 of "msg + 1": operator + needs numbers, got string and int`},
+		{`len(msg, 2)`, expr.ErrType, "len takes 1 arguments, got 2"},
+		{`upper(1)`, expr.ErrType, "argument 1 of upper is int, want string"},
+		{`len(msg) ? 1 : 2`, expr.ErrType, "condition of ?: is int, want bool"},
+		{`true ? "a" : 1`, expr.ErrType, "branches of ?: are string and int"},
+		{`1.5 % 2`, expr.ErrType, "operator % needs ints"},
+		{`!msg`, expr.ErrType, "operator ! needs bool, got string"},
+		{`msg < 1`, expr.ErrType, "cannot order string and int"},
+		{`match(msg, msg)`, expr.ErrBadArgument, "pattern of match must be a string literal"},
+		{`match(msg, "(")`, expr.ErrBadArgument, "missing closing )"},
+	}
+
+	for _, tc := range cases {
+		_, err := expr.Compile(tc.src)
+		require.ErrorIs(t, err, tc.kind, tc.src)
+		assert.Contains(t, err.Error(), tc.message, tc.src)
+	}
+
+	_, err := expr.Compile(`len(msg)`, expr.Expect(expr.Bool))
+	require.ErrorIs(t, err, expr.ErrType)
+	assert.EqualError(t, err, `type error in "len(msg)": expression gives int, want bool`)
+}
+
+func TestEvalErrors(t *testing.T) {
+	t.Parallel()
+
+	program, err := expr.Compile(`10 / (len(msg) - 3)`)
+	require.NoError(t, err)
+	assert.Equal(t, expr.Int, program.Type())
+
+	_, err = program.Eval(context.Background(), "abc")
+	require.ErrorIs(t, err, expr.ErrDivByZero)
+
+	_, err = program.Eval(context.Background(), 3)
+	require.ErrorIs(t, err, expr.ErrType, "msg of the wrong type")
+
+	program, err = expr.Compile(`int(msg)`)
+	require.NoError(t, err)
+
+	_, err = program.Eval(context.Background(), "x")
+	require.ErrorIs(t, err, expr.ErrBadArgument)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = program.Eval(ctx, "1")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestEvalTimeout(t *testing.T) {
+	t.Parallel()
+
+	program, err := expr.Compile(`len(upper(lower(upper(msg))))`, expr.WithTimeout(time.Nanosecond))
+	require.NoError(t, err)
+
+	_, err = program.Eval(context.Background(), strings.Repeat("a", 1<<20))
+	require.ErrorIs(t, err, expr.ErrTimeout)
+
+	program, err = expr.Compile(`len(upper(msg))`, expr.WithTimeout(0))
+	require.NoError(t, err)
+
+	value, err := program.Eval(context.Background(), strings.Repeat("a", 1<<20))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1<<20), value)
+}
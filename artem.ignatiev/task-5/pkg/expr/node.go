@@ -0,0 +1,305 @@
+package expr
+
+import (
+	"cmp"
+	"strings"
+)
+
+type evalFunc func(e *env) (any, error)
+
+// node is a type checked expression. literal holds the value of constants.
+type node struct {
+	typ     Type
+	pos     int
+	eval    evalFunc
+	literal any
+}
+
+func newNode(typ Type, pos int, eval evalFunc) node {
+	return node{
+		typ: typ,
+		pos: pos,
+		eval: func(e *env) (any, error) {
+			if err := e.tick(); err != nil {
+				return nil, err
+			}
+
+			return eval(e)
+		},
+		literal: nil,
+	}
+}
+
+func constant(pos int, value any) node {
+	return node{
+		typ:     typeOf(value),
+		pos:     pos,
+		eval:    func(*env) (any, error) { return value, nil },
+		literal: value,
+	}
+}
+
+func evalBoth(e *env, left node, right node) (any, any, error) {
+	a, err := left.eval(e)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := right.eval(e)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return a, b, nil
+}
+
+// The accessors below read values whose type the checker already proved.
+
+func asString(value any) string {
+	text, _ := value.(string)
+
+	return text
+}
+
+func asInt(value any) int64 {
+	number, _ := value.(int64)
+
+	return number
+}
+
+func asBool(value any) bool {
+	flag, _ := value.(bool)
+
+	return flag
+}
+
+func toFloat(value any) float64 {
+	if number, ok := value.(int64); ok {
+		return float64(number)
+	}
+
+	number, _ := value.(float64)
+
+	return number
+}
+
+func numericType(left Type, right Type) Type {
+	if left == Int && right == Int {
+		return Int
+	}
+
+	return Float
+}
+
+func unaryOp(op token, operand node, p *parser) (node, error) {
+	if op.text == "!" {
+		if operand.typ != Bool {
+			return node{}, p.typeError(op.pos, "operator ! needs bool, got %s", operand.typ)
+		}
+
+		return newNode(Bool, op.pos, func(e *env) (any, error) {
+			value, err := operand.eval(e)
+			if err != nil {
+				return nil, err
+			}
+
+			return !asBool(value), nil
+		}), nil
+	}
+
+	if !operand.typ.numeric() {
+		return node{}, p.typeError(op.pos, "operator - needs a number, got %s", operand.typ)
+	}
+
+	return newNode(operand.typ, op.pos, func(e *env) (any, error) {
+		value, err := operand.eval(e)
+		if err != nil {
+			return nil, err
+		}
+
+		if number, ok := value.(int64); ok {
+			return -number, nil
+		}
+
+		return -toFloat(value), nil
+	}), nil
+}
+
+func binaryOp(op token, left node, right node, p *parser) (node, error) {
+	switch op.text {
+	case "||", "&&":
+		return logical(op, left, right, p)
+	case "==", "!=":
+		if left.typ != right.typ && !(left.typ.numeric() && right.typ.numeric()) {
+			return node{}, p.typeError(op.pos, "cannot compare %s and %s", left.typ, right.typ)
+		}
+
+		return comparison(op, left, right), nil
+	case "<", "<=", ">", ">=":
+		if !(left.typ.numeric() && right.typ.numeric()) && !(left.typ == String && right.typ == String) {
+			return node{}, p.typeError(op.pos, "cannot order %s and %s", left.typ, right.typ)
+		}
+
+		return comparison(op, left, right), nil
+	case "+":
+		if left.typ == String && right.typ == String {
+			return newNode(String, op.pos, func(e *env) (any, error) {
+				a, b, err := evalBoth(e, left, right)
+				if err != nil {
+					return nil, err
+				}
+
+				return asString(a) + asString(b), nil
+			}), nil
+		}
+	case "%":
+		if left.typ != Int || right.typ != Int {
+			return node{}, p.typeError(op.pos, "operator %% needs ints, got %s and %s", left.typ, right.typ)
+		}
+	}
+
+	if !left.typ.numeric() || !right.typ.numeric() {
+		return node{}, p.typeError(op.pos, "operator %s needs numbers, got %s and %s", op.text, left.typ, right.typ)
+	}
+
+	typ := numericType(left.typ, right.typ)
+
+	return newNode(typ, op.pos, func(e *env) (any, error) {
+		a, b, err := evalBoth(e, left, right)
+		if err != nil {
+			return nil, err
+		}
+
+		if typ == Int {
+			return intArithmetic(op.text, asInt(a), asInt(b))
+		}
+
+		return floatArithmetic(op.text, toFloat(a), toFloat(b)), nil
+	}), nil
+}
+
+func intArithmetic(op string, a int64, b int64) (any, error) {
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+
+	if b == 0 {
+		return nil, ErrDivByZero
+	}
+
+	if op == "/" {
+		return a / b, nil
+	}
+
+	return a % b, nil
+}
+
+func floatArithmetic(op string, a float64, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	default:
+		return a / b
+	}
+}
+
+func logical(op token, left node, right node, p *parser) (node, error) {
+	if left.typ != Bool || right.typ != Bool {
+		return node{}, p.typeError(op.pos, "operator %s needs bools, got %s and %s", op.text, left.typ, right.typ)
+	}
+
+	short := op.text == "||"
+
+	return newNode(Bool, op.pos, func(e *env) (any, error) {
+		value, err := left.eval(e)
+		if err != nil || asBool(value) == short {
+			return value, err
+		}
+
+		return right.eval(e)
+	}), nil
+}
+
+func comparison(op token, left node, right node) node {
+	mixed := left.typ != right.typ
+
+	return newNode(Bool, op.pos, func(e *env) (any, error) {
+		a, b, err := evalBoth(e, left, right)
+		if err != nil {
+			return nil, err
+		}
+
+		var order int
+
+		switch {
+		case mixed:
+			order = cmp.Compare(toFloat(a), toFloat(b))
+		case left.typ == Bool:
+			order = 1
+			if a == b {
+				order = 0
+			}
+		case left.typ == String:
+			order = strings.Compare(asString(a), asString(b))
+		case left.typ == Int:
+			order = cmp.Compare(asInt(a), asInt(b))
+		default:
+			order = cmp.Compare(toFloat(a), toFloat(b))
+		}
+
+		switch op.text {
+		case "==":
+			return order == 0, nil
+		case "!=":
+			return order != 0, nil
+		case "<":
+			return order < 0, nil
+		case "<=":
+			return order <= 0, nil
+		case ">":
+			return order > 0, nil
+		default:
+			return order >= 0, nil
+		}
+	})
+}
+
+func conditional(pos int, cond node, then node, otherwise node, p *parser) (node, error) {
+	typ := then.typ
+
+	switch {
+	case then.typ == otherwise.typ:
+	case then.typ.numeric() && otherwise.typ.numeric():
+		typ = Float
+	default:
+		return node{}, p.typeError(pos, "branches of ?: are %s and %s", then.typ, otherwise.typ)
+	}
+
+	return newNode(typ, pos, func(e *env) (any, error) {
+		value, err := cond.eval(e)
+		if err != nil {
+			return nil, err
+		}
+
+		branch := otherwise
+		if asBool(value) {
+			branch = then
+		}
+
+		result, err := branch.eval(e)
+		if err != nil || typ != Float {
+			return result, err
+		}
+
+		return toFloat(result), nil
+	}), nil
+}
@@ -0,0 +1,372 @@
+package expr
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEnd {
+		return "end of expression"
+	}
+
+	return strconv.Quote(t.text)
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "(", ")", ",", "?", ":"}
+
+type lexer struct {
+	src    string
+	offset int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.offset < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.offset])) {
+		l.offset++
+	}
+
+	start := l.offset
+	if start == len(l.src) {
+		return token{kind: tokenEnd, text: "", pos: start + 1}, nil
+	}
+
+	char := l.src[start]
+
+	switch {
+	case isLetter(char):
+		for l.offset < len(l.src) && (isLetter(l.src[l.offset]) || isDigit(l.src[l.offset])) {
+			l.offset++
+		}
+
+		return token{kind: tokenIdent, text: l.src[start:l.offset], pos: start + 1}, nil
+	case isDigit(char):
+		return l.number(), nil
+	case char == '"' || char == '`':
+		return l.string()
+	}
+
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[start:], op) {
+			l.offset += len(op)
+
+			return token{kind: tokenOp, text: op, pos: start + 1}, nil
+		}
+	}
+
+	return token{}, fmt.Errorf("%w at column %d of %q: unexpected character %q", ErrSyntax, start+1, l.src, char)
+}
+
+func (l *lexer) number() token {
+	start, kind := l.offset, tokenInt
+
+	l.digits()
+
+	if l.offset+1 < len(l.src) && l.src[l.offset] == '.' && isDigit(l.src[l.offset+1]) {
+		kind = tokenFloat
+		l.offset++
+		l.digits()
+	}
+
+	return token{kind: kind, text: l.src[start:l.offset], pos: start + 1}
+}
+
+func (l *lexer) digits() {
+	for l.offset < len(l.src) && isDigit(l.src[l.offset]) {
+		l.offset++
+	}
+}
+
+func (l *lexer) string() (token, error) {
+	start, quote := l.offset, l.src[l.offset]
+
+	for l.offset++; l.offset < len(l.src); l.offset++ {
+		switch l.src[l.offset] {
+		case '\\':
+			if quote == '"' {
+				l.offset++
+			}
+		case quote:
+			l.offset++
+
+			text, err := strconv.Unquote(l.src[start:l.offset])
+			if err != nil {
+				return token{}, fmt.Errorf("%w at column %d of %q: bad string literal", ErrSyntax, start+1, l.src)
+			}
+
+			return token{kind: tokenString, text: text, pos: start + 1}, nil
+		}
+	}
+
+	return token{}, fmt.Errorf("%w at column %d of %q: unterminated string", ErrSyntax, start+1, l.src)
+}
+
+func isLetter(char byte) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+// parser compiles while it parses: every rule returns a typed node.
+type parser struct {
+	lexer lexer
+	token token
+	msg   Type
+}
+
+func parse(src string, msg Type) (node, error) {
+	p := &parser{lexer: lexer{src: src, offset: 0}, token: token{}, msg: msg}
+	if err := p.advance(); err != nil {
+		return node{}, err
+	}
+
+	root, err := p.ternary()
+	if err != nil {
+		return node{}, err
+	}
+
+	if p.token.kind != tokenEnd {
+		return node{}, p.unexpected("an operator")
+	}
+
+	return root, nil
+}
+
+func (p *parser) advance() error {
+	next, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+
+	p.token = next
+
+	return nil
+}
+
+func (p *parser) is(op string) bool {
+	return p.token.kind == tokenOp && p.token.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if !p.is(op) {
+		return p.unexpected(strconv.Quote(op))
+	}
+
+	return p.advance()
+}
+
+func (p *parser) unexpected(want string) error {
+	return p.fail(ErrSyntax, p.token.pos, "expected %s, found %s", want, p.token)
+}
+
+func (p *parser) typeError(pos int, format string, args ...any) error {
+	return p.fail(ErrType, pos, format, args...)
+}
+
+func (p *parser) fail(kind error, pos int, format string, args ...any) error {
+	return fmt.Errorf("%w at column %d of %q: %s", kind, pos, p.lexer.src, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) ternary() (node, error) {
+	cond, err := p.binary(0)
+	if err != nil || !p.is("?") {
+		return cond, err
+	}
+
+	pos := p.token.pos
+	if err := p.advance(); err != nil {
+		return node{}, err
+	}
+
+	then, err := p.ternary()
+	if err != nil {
+		return node{}, err
+	}
+
+	if err := p.expect(":"); err != nil {
+		return node{}, err
+	}
+
+	otherwise, err := p.ternary()
+	if err != nil {
+		return node{}, err
+	}
+
+	if cond.typ != Bool {
+		return node{}, p.typeError(pos, "condition of ?: is %s, want bool", cond.typ)
+	}
+
+	return conditional(pos, cond, then, otherwise, p)
+}
+
+// levels lists the binary operators from the loosest to the tightest binding.
+var levels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(levels) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return node{}, err
+	}
+
+	for p.token.kind == tokenOp && slices.Contains(levels[level], p.token.text) {
+		op := p.token
+		if err := p.advance(); err != nil {
+			return node{}, err
+		}
+
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return node{}, err
+		}
+
+		left, err = binaryOp(op, left, right, p)
+		if err != nil {
+			return node{}, err
+		}
+	}
+
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if !p.is("!") && !p.is("-") {
+		return p.primary()
+	}
+
+	op := p.token
+	if err := p.advance(); err != nil {
+		return node{}, err
+	}
+
+	operand, err := p.unary()
+	if err != nil {
+		return node{}, err
+	}
+
+	return unaryOp(op, operand, p)
+}
+
+func (p *parser) primary() (node, error) {
+	current := p.token
+
+	switch current.kind {
+	case tokenInt:
+		value, err := strconv.ParseInt(current.text, 10, 64)
+		if err != nil {
+			return node{}, p.fail(ErrSyntax, current.pos, "integer %s out of range", current.text)
+		}
+
+		return constant(current.pos, value), p.advance()
+	case tokenFloat:
+		value, _ := strconv.ParseFloat(current.text, 64)
+
+		return constant(current.pos, value), p.advance()
+	case tokenString:
+		return constant(current.pos, current.text), p.advance()
+	case tokenIdent:
+		if err := p.advance(); err != nil {
+			return node{}, err
+		}
+
+		if p.is("(") {
+			return p.call(current)
+		}
+
+		return p.name(current)
+	case tokenOp:
+		if current.text == "(" {
+			if err := p.advance(); err != nil {
+				return node{}, err
+			}
+
+			inner, err := p.ternary()
+			if err != nil {
+				return node{}, err
+			}
+
+			return inner, p.expect(")")
+		}
+	case tokenEnd:
+	}
+
+	return node{}, p.unexpected("an operand")
+}
+
+func (p *parser) name(ident token) (node, error) {
+	switch ident.text {
+	case "msg":
+		return newNode(p.msg, ident.pos, func(e *env) (any, error) { return e.msg, nil }), nil
+	case "true", "false":
+		return constant(ident.pos, ident.text == "true"), nil
+	default:
+		return node{}, p.fail(ErrUnknownName, ident.pos, "%q is not msg, true or false", ident.text)
+	}
+}
+
+func (p *parser) call(ident token) (node, error) {
+	fn, ok := builtins[ident.text]
+	if !ok {
+		return node{}, p.fail(ErrUnknownName, ident.pos, "no function %q", ident.text)
+	}
+
+	if err := p.advance(); err != nil {
+		return node{}, err
+	}
+
+	var args []node
+
+	for !p.is(")") {
+		if len(args) > 0 {
+			if !p.is(",") {
+				return node{}, p.unexpected(`"," or ")"`)
+			}
+
+			if err := p.advance(); err != nil {
+				return node{}, err
+			}
+		}
+
+		arg, err := p.ternary()
+		if err != nil {
+			return node{}, err
+		}
+
+		args = append(args, arg)
+	}
+
+	if err := p.advance(); err != nil {
+		return node{}, err
+	}
+
+	return fn.compile(ident, args, p)
+}
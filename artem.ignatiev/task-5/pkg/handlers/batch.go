@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// NewBatcher builds a decorator stage which merges up to size messages into
+// one. With maxWait set, a batch is also flushed that long after its first
+// message; size 0 then batches by time only. What is left is flushed when the
+// input ends. Each batch goes through Process, so the stage counts batches
+// rather than messages, and the messages of a batch only count as handled once
+// it is emitted. Ordered workers reject it, as it takes messages ahead.
+func NewBatcher[T any](
+	size int,
+	maxWait time.Duration,
+	merge func(batch []T) T,
+) func(ctx context.Context, input chan T, output chan T) error {
+	return func(ctx context.Context, input chan T, output chan T) error {
+		conveyer.Hold[T](ctx)
+
+		var (
+			batch []T
+			timer conveyer.Timer
+		)
+
+		flush := func(ctx context.Context) error {
+			if timer != nil {
+				timer.Stop()
+				timer = nil
+			}
+
+			if len(batch) == 0 {
+				return nil
+			}
+
+			merged := merge(batch)
+			batch = nil
+
+			return emitHeld(ctx, output, merged)
+		}
+
+		for {
+			var due <-chan time.Time
+			if timer != nil {
+				due = timer.C()
+			}
+
+			item, ok, at := nextBefore(ctx, input, due)
+			if ok {
+				batch = append(batch, item)
+
+				if len(batch) == 1 && maxWait > 0 {
+					timer = conveyer.ClockOf(ctx).NewTimer(maxWait)
+				}
+			}
+
+			if !ok && at.IsZero() {
+				return flush(ctx)
+			}
+
+			if !at.IsZero() || (size > 0 && len(batch) >= size) {
+				if err := flush(ctx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// NewTumblingWindow builds a decorator stage which emits the aggregate of the
+// messages received in each consecutive, non-overlapping period of size.
+// Empty windows emit nothing. size must be positive. Like a batch, each window
+// goes through Process once.
+func NewTumblingWindow[T any](
+	size time.Duration,
+	aggregate func(window []T) T,
+) (func(ctx context.Context, input chan T, output chan T) error, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: window size %v", ErrInvalidArgument, size)
+	}
+
+	return func(ctx context.Context, input chan T, output chan T) error {
+		var window []T
+
+		emit := func(ctx context.Context) error {
+			if len(window) == 0 {
+				return nil
+			}
+
+			aggregated := aggregate(window)
+			window = nil
+
+			return emitHeld(ctx, output, aggregated)
+		}
+
+		return runWindow(ctx, input, size, func(ctx context.Context, item T) {
+			window = append(window, item)
+		}, func(ctx context.Context, _ time.Time) error {
+			return emit(ctx)
+		}, emit)
+	}, nil
+}
+
+// NewSlidingWindow builds a decorator stage which emits, every step, the
+// aggregate of the messages received during the last size. Empty windows emit
+// nothing. size and step must be positive. Each emitted window goes through
+// Process; a message counts as handled once a window holding it is emitted.
+func NewSlidingWindow[T any](
+	size time.Duration,
+	step time.Duration,
+	aggregate func(window []T) T,
+) (func(ctx context.Context, input chan T, output chan T) error, error) {
+	if size <= 0 || step <= 0 {
+		return nil, fmt.Errorf("%w: window size %v, step %v", ErrInvalidArgument, size, step)
+	}
+
+	type entry struct {
+		at   time.Time
+		item T
+	}
+
+	return func(ctx context.Context, input chan T, output chan T) error {
+		var entries []entry
+
+		emit := func(ctx context.Context) error {
+			if len(entries) == 0 {
+				// The messages which left the window are handled.
+				conveyer.Release[T](ctx)
+
+				return nil
+			}
+
+			window := make([]T, len(entries))
+			for idx, current := range entries {
+				window[idx] = current.item
+			}
+
+			return emitHeld(ctx, output, aggregate(window))
+		}
+
+		return runWindow(ctx, input, step, func(ctx context.Context, item T) {
+			entries = append(entries, entry{at: conveyer.ClockOf(ctx).Now(), item: item})
+		}, func(ctx context.Context, now time.Time) error {
+			cutoff := now.Add(-size)
+
+			for len(entries) > 0 && !entries[0].at.After(cutoff) {
+				entries = entries[1:]
+			}
+
+			return emit(ctx)
+		}, emit)
+	}, nil
+}
+
+// runWindow adds messages as they come, calls tick every interval and finish
+// once the input ends.
+func runWindow[T any](
+	ctx context.Context,
+	input chan T,
+	interval time.Duration,
+	add func(ctx context.Context, item T),
+	tick func(ctx context.Context, now time.Time) error,
+	finish func(ctx context.Context) error,
+) error {
+	conveyer.Hold[T](ctx)
+
+	ticker := conveyer.ClockOf(ctx).NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		item, ok, now := nextBefore(ctx, input, ticker.C())
+		if ok {
+			add(ctx, item)
+		}
+
+		if !ok && now.IsZero() {
+			return finish(ctx)
+		}
+
+		if !now.IsZero() {
+			if err := tick(ctx, now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// nextBefore receives the next message of the stage input unless due fires
+// first, in which case it returns the time due fired at.
+func nextBefore[T any](ctx context.Context, input chan T, due <-chan time.Time) (T, bool, time.Time) {
+	if due == nil {
+		item, ok := conveyer.Next(ctx, input)
+
+		return item, ok, time.Time{}
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	fired := make(chan time.Time, 1)
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		select {
+		case at := <-due:
+			fired <- at
+
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	item, ok := conveyer.Next(waitCtx, input)
+
+	cancel()
+	<-exited
+
+	select {
+	case at := <-fired:
+		return item, ok, at
+	default:
+		return item, ok, time.Time{}
+	}
+}
+
+// emitHeld emits a result made of the messages the stage holds, which then
+// count as handled.
+func emitHeld[T any](ctx context.Context, output chan T, result T) error {
+	err := conveyer.Process(ctx, result, func(ctx context.Context, result T) error {
+		conveyer.Emit(ctx, output, result)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	conveyer.Release[T](ctx)
+
+	return nil
+}
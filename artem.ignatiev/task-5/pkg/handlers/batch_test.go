@@ -0,0 +1,246 @@
+package handlers_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func sum(items []int) int {
+	total := 0
+	for _, item := range items {
+		total += item
+	}
+
+	return total
+}
+
+// startHandler runs a stage until the test ends and returns its channels.
+func startHandler[T any](t *testing.T, stage stageFunc[T]) (chan T, chan T) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	input, output := make(chan T), make(chan T, 16)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- stage(ctx, input, output)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	return input, output
+}
+
+func receiveWithin[T any](t *testing.T, output chan T, timeout time.Duration) T {
+	t.Helper()
+
+	select {
+	case item := <-output:
+		return item
+	case <-time.After(timeout):
+		require.FailNow(t, "no output in time")
+
+		var zero T
+
+		return zero
+	}
+}
+
+func TestFixedSizeBatch(t *testing.T) {
+	t.Parallel()
+
+	batcher := handlers.NewBatcher(3, 0, sum)
+
+	assert.Equal(t, []int{6, 15, 7}, runHandler(t, batcher, numbers(7)))
+}
+
+func TestTimedBatch(t *testing.T) {
+	t.Parallel()
+
+	input, output := startHandler(t, handlers.NewBatcher(0, 20*time.Millisecond, sum))
+
+	input <- 1
+	input <- 2
+
+	assert.Equal(t, 3, receiveWithin(t, output, time.Second))
+
+	input <- 10
+
+	assert.Equal(t, 10, receiveWithin(t, output, time.Second))
+}
+
+func TestBatchSizeBeforeDeadline(t *testing.T) {
+	t.Parallel()
+
+	input, output := startHandler(t, handlers.NewBatcher(2, time.Hour, sum))
+
+	input <- 1
+	input <- 2
+	input <- 3
+
+	assert.Equal(t, 3, receiveWithin(t, output, time.Second))
+
+	select {
+	case item := <-output:
+		t.Fatalf("unexpected batch %d", item)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestTumblingWindow(t *testing.T) {
+	t.Parallel()
+
+	window, err := handlers.NewTumblingWindow(30*time.Millisecond, sum)
+	require.NoError(t, err)
+
+	input, output := startHandler(t, window)
+
+	input <- 1
+	input <- 2
+	input <- 3
+
+	// The messages may straddle a window boundary, but each is counted once.
+	total := 0
+	for total < 6 {
+		total += receiveWithin(t, output, time.Second)
+	}
+
+	require.Equal(t, 6, total)
+
+	input <- 4
+
+	assert.Equal(t, 4, receiveWithin(t, output, time.Second), "windows do not overlap")
+}
+
+func TestSlidingWindow(t *testing.T) {
+	t.Parallel()
+
+	const step = 10 * time.Millisecond
+
+	window, err := handlers.NewSlidingWindow(5*step, step, sum)
+	require.NoError(t, err)
+
+	input, output := startHandler(t, window)
+
+	input <- 5
+
+	// The message stays in several consecutive windows, then slides out.
+	seen := 0
+
+	for seen < 3 {
+		assert.Equal(t, 5, receiveWithin(t, output, time.Second))
+
+		seen++
+	}
+
+	input <- 1
+
+	for {
+		window := receiveWithin(t, output, time.Second)
+		if window == 1 {
+			break
+		}
+
+		require.Contains(t, []int{5, 6}, window)
+	}
+}
+
+func TestWindowFlushOnClose(t *testing.T) {
+	t.Parallel()
+
+	tumbling, err := handlers.NewTumblingWindow(time.Hour, sum)
+	require.NoError(t, err)
+
+	sliding, err := handlers.NewSlidingWindow(time.Hour, time.Hour, sum)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{10}, runHandler(t, tumbling, numbers(4)))
+	assert.Equal(t, []int{10}, runHandler(t, sliding, numbers(4)))
+}
+
+func TestWindowRejectsDurations(t *testing.T) {
+	t.Parallel()
+
+	_, err := handlers.NewTumblingWindow(0, sum)
+	require.ErrorIs(t, err, handlers.ErrInvalidArgument)
+
+	_, err = handlers.NewSlidingWindow(time.Second, -time.Second, sum)
+	require.ErrorIs(t, err, handlers.ErrInvalidArgument)
+
+	_, err = handlers.NewSlidingWindow(0, time.Second, sum)
+	require.ErrorIs(t, err, handlers.ErrInvalidArgument)
+}
+
+func TestDurableBatchReplaysUnflushedMessages(t *testing.T) {
+	t.Parallel()
+
+	inputDir := t.TempDir()
+
+	newConveyer := func() *conveyer.Conveyer[string] {
+		conv := conveyer.New(4)
+		conv.RegisterDecorator(handlers.NewBatcher(3, time.Hour, func(batch []string) string {
+			return strings.Join(batch, "+")
+		}), "input", "output")
+		conv.DeclareInputs("input")
+		conv.DeclareOutputs("output")
+		require.NoError(t, conv.MakeDurable("input", inputDir, conveyer.StringCodec{}))
+
+		return conv
+	}
+
+	run := func(conv *conveyer.Conveyer[string]) <-chan error {
+		done := make(chan error, 1)
+
+		go func() {
+			done <- conv.Run(context.Background())
+		}()
+
+		require.Eventually(t, func() bool {
+			return conv.State() == conveyer.StateRunning
+		}, time.Second, time.Millisecond)
+
+		return done
+	}
+
+	conv := newConveyer()
+	require.NoError(t, conv.Send("input", "a"))
+	require.NoError(t, conv.Send("input", "b"))
+
+	done := run(conv)
+
+	require.Eventually(t, func() bool {
+		return conv.Stats().Channels[0].Received == 2
+	}, time.Second, time.Millisecond)
+
+	// The batch is not full when the conveyer stops.
+	require.NoError(t, conv.Stop())
+	require.NoError(t, <-done)
+	require.NoError(t, conv.Close())
+
+	restarted := newConveyer()
+	require.NoError(t, restarted.Send("input", "c"))
+
+	done = run(restarted)
+
+	res, err := restarted.Recv("output")
+	require.NoError(t, err)
+	assert.Equal(t, "a+b+c", res)
+	require.Eventually(t, func() bool {
+		return restarted.Stats().Stages[0].Processed == 1
+	}, time.Second, time.Millisecond, "the stage counts batches")
+
+	require.NoError(t, restarted.Stop())
+	require.NoError(t, <-done)
+	require.NoError(t, restarted.Close())
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// OnPayload lifts a payload transform to envelopes, keeping ID, headers and visited stages.
+func OnPayload[P any](
+	transform func(payload P) (P, error),
+) func(envelope conveyer.Envelope[P]) (conveyer.Envelope[P], error) {
+	return func(envelope conveyer.Envelope[P]) (conveyer.Envelope[P], error) {
+		payload, err := transform(envelope.Payload)
+		if err != nil {
+			return envelope, err
+		}
+
+		return envelope.WithPayload(payload), nil
+	}
+}
+
+// PayloadMatch lifts a payload predicate to envelopes.
+func PayloadMatch[P any](match func(payload P) bool) func(envelope conveyer.Envelope[P]) bool {
+	return func(envelope conveyer.Envelope[P]) bool {
+		return match(envelope.Payload)
+	}
+}
+
+func EnvelopePrefixDecoratorFunc(
+	ctx context.Context,
+	inputChannel chan conveyer.Envelope[string],
+	outputChannel chan conveyer.Envelope[string],
+) error {
+	return NewDecorator(OnPayload(decoratePrefix))(ctx, inputChannel, outputChannel)
+}
+
+func EnvelopeSeparatorFunc(
+	ctx context.Context,
+	inputChannel chan conveyer.Envelope[string],
+	outputsChannels []chan conveyer.Envelope[string],
+) error {
+	return Separator(ctx, inputChannel, outputsChannels)
+}
+
+func EnvelopeMultiplexerFunc(
+	ctx context.Context,
+	inputsChannels []chan conveyer.Envelope[string],
+	outputChannel chan conveyer.Envelope[string],
+) error {
+	return NewMultiplexer(PayloadMatch(skipNoMultiplexer))(ctx, inputsChannels, outputChannel)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kryjkaqq/task-5/pkg/expr"
+)
+
+// ExprDecorator builds a decorator stage which replaces every message by the
+// value of an expression over msg. Messages must be strings, ints, float64s or
+// bools, and the expression must yield the same type.
+func ExprDecorator[T any](src string, opts ...expr.Option) (func(ctx context.Context, input chan T, output chan T) error, error) {
+	msg, native := exprType[T]()
+	if !native {
+		var zero T
+
+		return nil, fmt.Errorf("%w: expression decorators do not support %T messages", expr.ErrType, zero)
+	}
+
+	program, err := expr.Compile(src, append(opts, expr.WithMsg(msg), expr.Expect(msg))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDecorator(func(ctx context.Context, item T) (T, error) {
+		value, err := program.Eval(ctx, exprValue(item))
+		if err != nil {
+			var zero T
+
+			return zero, err
+		}
+
+		return fromExpr[T](value), nil
+	}), nil
+}
+
+// ExprFilter builds a decorator stage which passes the messages for which a
+// bool expression holds. Messages other than strings and numbers are seen as
+// msg formatted with fmt.Sprint.
+func ExprFilter[T any](src string, opts ...expr.Option) (func(ctx context.Context, input chan T, output chan T) error, error) {
+	msg, _ := exprType[T]()
+
+	program, err := expr.Compile(src, append(opts, expr.WithMsg(msg), expr.Expect(expr.Bool))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPassStage(func(ctx context.Context, item T) (bool, error) {
+		value, err := program.Eval(ctx, exprValue(item))
+		if err != nil {
+			return false, err
+		}
+
+		keep, _ := value.(bool)
+
+		return keep, nil
+	}), nil
+}
+
+// ExprRouter builds a separator stage which sends every message to the output
+// whose index an int expression yields, e.g. hash(msg) % 3. An index out of
+// range is handled by the stage error policy, like ErrNoRoute of NewRouter.
+func ExprRouter[T any](src string, opts ...expr.Option) (func(ctx context.Context, input chan T, outputs []chan T) error, error) {
+	msg, _ := exprType[T]()
+
+	program, err := expr.Compile(src, append(opts, expr.WithMsg(msg), expr.Expect(expr.Int))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRouter(func(ctx context.Context, item T, _ []chan T) ([]int, error) {
+		value, err := program.Eval(ctx, exprValue(item))
+		if err != nil {
+			return nil, err
+		}
+
+		index, _ := value.(int64)
+
+		return []int{int(index)}, nil
+	}), nil
+}
+
+// exprType is the expression type of T; other types are formatted as strings.
+func exprType[T any]() (expr.Type, bool) {
+	var zero T
+
+	switch any(zero).(type) {
+	case string:
+		return expr.String, true
+	case int, int64:
+		return expr.Int, true
+	case float64:
+		return expr.Float, true
+	case bool:
+		return expr.Bool, true
+	default:
+		return expr.String, false
+	}
+}
+
+func exprValue[T any](item T) any {
+	switch value := any(item).(type) {
+	case string, int64, float64, bool:
+		return value
+	case int:
+		return int64(value)
+	default:
+		return fmt.Sprint(item)
+	}
+}
+
+func fromExpr[T any](value any) T {
+	var item T
+
+	switch target := any(&item).(type) {
+	case *int:
+		number, _ := value.(int64)
+		*target = int(number)
+	default:
+		item, _ = value.(T)
+	}
+
+	return item
+}
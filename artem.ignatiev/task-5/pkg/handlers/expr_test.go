@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/expr"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func TestExprDecoratorAndFilter(t *testing.T) {
+	t.Parallel()
+
+	shout, err := handlers.ExprDecorator[string](`upper(msg) + "!"`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A!", "BC!"}, runHandler(t, shout, []string{"a", "bc"}))
+
+	double, err := handlers.ExprDecorator[int](`msg * 2`)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 4, 6}, runHandler(t, double, numbers(3)))
+
+	long, err := handlers.ExprFilter[string](`len(msg) > 5`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"longer"}, runHandler(t, long, []string{"short", "longer"}))
+
+	even, err := handlers.ExprFilter[int](`msg % 2 == 0`)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 4}, runHandler(t, even, numbers(5)))
+
+	_, err = handlers.ExprDecorator[string](`len(msg)`)
+	require.ErrorIs(t, err, expr.ErrType, "a decorator must keep the message type")
+
+	_, err = handlers.ExprDecorator[[]byte](`msg`)
+	require.ErrorIs(t, err, expr.ErrType)
+
+	_, err = handlers.ExprFilter[string](`upper(msg`)
+	require.ErrorIs(t, err, expr.ErrSyntax)
+}
+
+func TestExprRouter(t *testing.T) {
+	t.Parallel()
+
+	items := make([]string, 0, 30)
+	for idx := range 30 {
+		items = append(items, fmt.Sprintf("user%d", idx%5))
+	}
+
+	router, err := handlers.ExprRouter[string](`hash(msg) % 3`)
+	require.NoError(t, err)
+
+	input := make(chan string, len(items))
+	outputs := []chan string{make(chan string, len(items)), make(chan string, len(items)), make(chan string, len(items))}
+
+	for _, item := range items {
+		input <- item
+	}
+
+	close(input)
+	require.NoError(t, router(context.Background(), input, outputs))
+
+	hashed := runRouter(t, handlers.HashBy(func(item string) string { return item }), 3, items)
+
+	for idx, output := range outputs {
+		close(output)
+
+		var routed []string
+		for item := range output {
+			routed = append(routed, item)
+		}
+
+		assert.Equal(t, hashed[idx], routed, "hash(msg) agrees with the hash strategy")
+	}
+
+	outOfRange, err := handlers.ExprRouter[string](`len(msg)`)
+	require.NoError(t, err)
+
+	input = make(chan string, 1)
+	input <- "abc"
+	close(input)
+
+	require.ErrorIs(t, outOfRange(context.Background(), input, outputs[:1]), handlers.ErrNoRoute)
+}
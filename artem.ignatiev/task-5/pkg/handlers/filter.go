@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// Contains matches strings holding substr.
+func Contains(substr string) func(item string) bool {
+	return func(item string) bool {
+		return strings.Contains(item, substr)
+	}
+}
+
+// AddPrefix prepends prefix once and refuses items matched by reject with ErrCantDecorate.
+func AddPrefix(prefix string, reject func(item string) bool) func(item string) (string, error) {
+	return func(item string) (string, error) {
+		if reject != nil && reject(item) {
+			return "", ErrCantDecorate
+		}
+
+		if !strings.HasPrefix(item, prefix) {
+			item = prefix + item
+		}
+
+		return item, nil
+	}
+}
+
+// NewFilter builds a decorator stage which passes only the messages matched by keep.
+func NewFilter[T any](keep func(item T) bool) func(ctx context.Context, input chan T, output chan T) error {
+	return newPassStage(func(_ context.Context, item T) (bool, error) {
+		return keep(item), nil
+	})
+}
+
+// NewMap builds a decorator stage which applies transform to every message.
+func NewMap[T any](transform func(item T) T) func(ctx context.Context, input chan T, output chan T) error {
+	return NewDecorator(func(item T) (T, error) {
+		return transform(item), nil
+	})
+}
+
+// NewSampler builds a decorator stage which passes every message with
+// probability rate. Runs with the same seed make the same choices. rate must
+// be in (0, 1].
+func NewSampler[T any](
+	rate float64,
+	seed uint64,
+) (func(ctx context.Context, input chan T, output chan T) error, error) {
+	if !(rate > 0 && rate <= 1) {
+		return nil, fmt.Errorf("%w: sample rate %v", ErrInvalidArgument, rate)
+	}
+
+	var mu sync.Mutex
+
+	random := rand.New(rand.NewPCG(seed, seed))
+
+	return newPassStage(func(context.Context, T) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return random.Float64() < rate, nil
+	}), nil
+}
+
+// newPassStage runs a decorator which emits a message unchanged when pass accepts it.
+func newPassStage[T any](
+	pass func(ctx context.Context, item T) (bool, error),
+) func(ctx context.Context, input chan T, output chan T) error {
+	return func(ctx context.Context, input chan T, output chan T) error {
+		for {
+			item, ok := conveyer.Next(ctx, input)
+			if !ok {
+				return nil
+			}
+
+			err := conveyer.Process(ctx, item, func(ctx context.Context, item T) error {
+				keep, err := pass(ctx, item)
+				if err != nil {
+					return err
+				}
+
+				if keep {
+					conveyer.Emit(ctx, output, item)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+type stageFunc[T any] func(ctx context.Context, input chan T, output chan T) error
+
+// runHandler feeds items to a stage, closes its input and collects everything it emits.
+func runHandler[T any](t *testing.T, stage stageFunc[T], items []T) []T {
+	t.Helper()
+
+	input := make(chan T, len(items))
+	output := make(chan T, len(items)+1)
+
+	for _, item := range items {
+		input <- item
+	}
+
+	close(input)
+
+	require.NoError(t, stage(context.Background(), input, output))
+	close(output)
+
+	results := make([]T, 0, len(output))
+	for item := range output {
+		results = append(results, item)
+	}
+
+	return results
+}
+
+func numbers(count int) []int {
+	items := make([]int, count)
+	for idx := range items {
+		items[idx] = idx + 1
+	}
+
+	return items
+}
+
+func TestFilterAndMap(t *testing.T) {
+	t.Parallel()
+
+	even := handlers.NewFilter(func(item int) bool { return item%2 == 0 })
+	assert.Equal(t, []int{2, 4, 6}, runHandler(t, even, numbers(6)))
+
+	square := handlers.NewMap(func(item int) int { return item * item })
+	assert.Equal(t, []int{1, 4, 9}, runHandler(t, square, numbers(3)))
+
+	shout := handlers.NewMap(strings.ToUpper)
+	assert.Equal(t, []string{"A", "B"}, runHandler(t, shout, []string{"a", "b"}))
+}
+
+func TestAddPrefix(t *testing.T) {
+	t.Parallel()
+
+	decorate := handlers.AddPrefix("> ", handlers.Contains("skip"))
+
+	res, err := decorate("hi")
+	require.NoError(t, err)
+	assert.Equal(t, "> hi", res)
+
+	res, err = decorate(res)
+	require.NoError(t, err)
+	assert.Equal(t, "> hi", res, "the prefix is added once")
+
+	_, err = decorate("please skip")
+	require.ErrorIs(t, err, handlers.ErrCantDecorate)
+}
+
+func TestSampler(t *testing.T) {
+	t.Parallel()
+
+	items := numbers(1000)
+
+	all, err := handlers.NewSampler[int](1, 1)
+	require.NoError(t, err)
+	assert.Len(t, runHandler(t, all, items), len(items))
+
+	first, err := handlers.NewSampler[int](0.5, 42)
+	require.NoError(t, err)
+
+	second, err := handlers.NewSampler[int](0.5, 42)
+	require.NoError(t, err)
+
+	sampled := runHandler(t, first, items)
+
+	assert.Equal(t, sampled, runHandler(t, second, items), "the same seed samples the same messages")
+	assert.InDelta(t, 500, len(sampled), 60)
+}
+
+func TestSamplerRejectsRate(t *testing.T) {
+	t.Parallel()
+
+	for _, rate := range []float64{0, -0.5, 1.5, math.NaN()} {
+		_, err := handlers.NewSampler[int](rate, 1)
+		require.ErrorIs(t, err, handlers.ErrInvalidArgument, "rate %v", rate)
+	}
+}
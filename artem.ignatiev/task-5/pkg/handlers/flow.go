@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// NewDedupe builds a decorator stage which drops a message when another one
+// with the same key passed less than ttl ago. Workers of the stage share the
+// seen keys. ttl must be positive.
+func NewDedupe[T any, K comparable](
+	key func(item T) K,
+	ttl time.Duration,
+) (func(ctx context.Context, input chan T, output chan T) error, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("%w: dedupe ttl %v", ErrInvalidArgument, ttl)
+	}
+
+	var (
+		mu        sync.Mutex
+		seen      = make(map[K]time.Time)
+		nextPurge time.Time
+	)
+
+	return newPassStage(func(ctx context.Context, item T) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := conveyer.ClockOf(ctx).Now()
+
+		if now.After(nextPurge) {
+			for seenKey, expires := range seen {
+				if !now.Before(expires) {
+					delete(seen, seenKey)
+				}
+			}
+
+			nextPurge = now.Add(ttl)
+		}
+
+		itemKey := key(item)
+		if expires, ok := seen[itemKey]; ok && now.Before(expires) {
+			return false, nil
+		}
+
+		seen[itemKey] = now.Add(ttl)
+
+		return true, nil
+	}), nil
+}
+
+// NewThrottle builds a decorator stage which passes at most rate messages per
+// second on average, with bursts of up to burst messages. Workers of the stage
+// share the bucket. rate must be positive.
+func NewThrottle[T any](
+	rate float64,
+	burst int,
+) (func(ctx context.Context, input chan T, output chan T) error, error) {
+	if rate <= 0 || math.IsNaN(rate) || math.IsInf(rate, 1) {
+		return nil, fmt.Errorf("%w: throttle rate %v", ErrInvalidArgument, rate)
+	}
+
+	bucket := newTokenBucket(rate, burst)
+
+	return func(ctx context.Context, input chan T, output chan T) error {
+		for {
+			item, ok := conveyer.Next(ctx, input)
+			if !ok {
+				return nil
+			}
+
+			err := conveyer.Process(ctx, item, func(ctx context.Context, item T) error {
+				// A message still waiting for a token goes back when the stage stops.
+				if !bucket.wait(ctx) {
+					return ctx.Err()
+				}
+
+				conveyer.Emit(ctx, output, item)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}, nil
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		mu:     sync.Mutex{},
+		rate:   rate,
+		burst:  float64(max(burst, 1)),
+		tokens: float64(max(burst, 1)),
+		last:   time.Time{},
+	}
+}
+
+// wait takes a token, sleeping until one is available. It reports false if
+// ctx ends first.
+func (b *tokenBucket) wait(ctx context.Context) bool {
+	clock := conveyer.ClockOf(ctx)
+
+	for {
+		delay := b.take(clock.Now())
+		if delay == 0 {
+			return true
+		}
+
+		timer := clock.NewTimer(delay)
+
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+
+			return false
+		}
+	}
+}
+
+// take consumes a token or returns how long until the next one. The bucket
+// starts full at the first call.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+func TestDedupe(t *testing.T) {
+	t.Parallel()
+
+	const ttl = 50 * time.Millisecond
+
+	dedupe, err := handlers.NewDedupe(func(item string) string { return item }, ttl)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "b", "c"}, runHandler(t, dedupe, []string{"a", "b", "a", "c", "b"}))
+	assert.Empty(t, runHandler(t, dedupe, []string{"a"}), "keys are remembered across runs")
+
+	time.Sleep(ttl + 10*time.Millisecond)
+
+	assert.Equal(t, []string{"a"}, runHandler(t, dedupe, []string{"a", "a"}), "keys expire after ttl")
+}
+
+func TestDedupeByKey(t *testing.T) {
+	t.Parallel()
+
+	byTens, err := handlers.NewDedupe(func(item int) int { return item / 10 }, time.Minute)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{1, 12, 35}, runHandler(t, byTens, []int{1, 5, 12, 19, 35, 4}))
+}
+
+func TestDedupeRejectsTTL(t *testing.T) {
+	t.Parallel()
+
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		_, err := handlers.NewDedupe(func(item int) int { return item }, ttl)
+		require.ErrorIs(t, err, handlers.ErrInvalidArgument, "ttl %v", ttl)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+
+	const (
+		rate  = 100
+		burst = 2
+		total = 6
+	)
+
+	throttle, err := handlers.NewThrottle[int](rate, burst)
+	require.NoError(t, err)
+
+	started := time.Now()
+	results := runHandler(t, throttle, numbers(total))
+	elapsed := time.Since(started)
+
+	assert.Equal(t, numbers(total), results)
+
+	// The burst passes at once, the rest waits for one token every 10ms.
+	assert.GreaterOrEqual(t, elapsed, 35*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+}
+
+func TestThrottleRejectsRate(t *testing.T) {
+	t.Parallel()
+
+	for _, rate := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		_, err := handlers.NewThrottle[int](rate, 1)
+		require.ErrorIs(t, err, handlers.ErrInvalidArgument, "rate %v", rate)
+	}
+}
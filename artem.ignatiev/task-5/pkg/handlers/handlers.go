@@ -3,118 +3,152 @@ package handlers
 import (
 	"context"
 	"errors"
-	"strings"
 	"sync"
-)
-
-var ErrCantDecorate = errors.New("can't be decorated")
 
-func PrefixDecoratorFunc(
-	ctx context.Context,
-	inputChannel chan string,
-	outputChannel chan string,
-) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-
-		case item, ok := <-inputChannel:
-			if !ok {
-				return nil
-			}
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
 
-			if strings.Contains(item, "no decorator") {
-				return ErrCantDecorate
-			}
+var (
+	ErrCantDecorate    = errors.New("can't be decorated")
+	ErrInvalidArgument = errors.New("invalid handler argument")
+)
 
-			prefix := "decorated: "
-			if !strings.HasPrefix(item, prefix) {
-				item = prefix + item
-			}
+const (
+	decoratedPrefix = "decorated: "
+	noDecorator     = "no decorator"
+	noMultiplexer   = "no multiplexer"
+)
 
-			select {
-			case outputChannel <- item:
-			case <-ctx.Done():
-				return nil
-			}
-		}
-	}
+// NewDecorator builds a decorator stage which applies decorate to every message of the input channel.
+func NewDecorator[T any](
+	decorate func(item T) (T, error),
+) func(ctx context.Context, inputChannel chan T, outputChannel chan T) error {
+	return newDecorator(func(_ context.Context, item T) (T, error) {
+		return decorate(item)
+	})
 }
 
-func SeparatorFunc(
-	ctx context.Context,
-	inputChannel chan string,
-	outputsChannels []chan string,
-) error {
-	if len(outputsChannels) == 0 {
-		return nil
-	}
-
-	var index int
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-
-		case item, ok := <-inputChannel:
+// newDecorator is NewDecorator for decorate functions which need the message context.
+func newDecorator[T any](
+	decorate func(ctx context.Context, item T) (T, error),
+) func(ctx context.Context, inputChannel chan T, outputChannel chan T) error {
+	return func(ctx context.Context, inputChannel chan T, outputChannel chan T) error {
+		for {
+			item, ok := conveyer.Next(ctx, inputChannel)
 			if !ok {
 				return nil
 			}
 
-			targetChannel := outputsChannels[index%len(outputsChannels)]
-			index++
+			err := conveyer.Process(ctx, item, func(ctx context.Context, item T) error {
+				item, err := decorate(ctx, item)
+				if err != nil {
+					return err
+				}
+
+				conveyer.Emit(ctx, outputChannel, item)
 
-			select {
-			case targetChannel <- item:
-			case <-ctx.Done():
 				return nil
+			})
+			if err != nil {
+				return err
 			}
 		}
 	}
 }
 
-func MultiplexerFunc(
+// roundRobinCursor is the stage cursor holding the next output of Separator.
+const roundRobinCursor = "round-robin"
+
+// Separator spreads the input channel over the outputs in round-robin order.
+// In a conveyer it goes on where the stage left off, also after a restart or
+// a checkpoint.
+func Separator[T any](
 	ctx context.Context,
-	inputsChannels []chan string,
-	outputChannel chan string,
+	inputChannel chan T,
+	outputsChannels []chan T,
 ) error {
-	var waitGroup sync.WaitGroup
-
-	readFunc := func(channel chan string) {
-		defer waitGroup.Done()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
+	return NewRouter(roundRobinFrom[T](conveyer.Cursor(ctx, roundRobinCursor)))(ctx, inputChannel, outputsChannels)
+}
 
-			case item, ok := <-channel:
+// NewMultiplexer builds a multiplexer stage which merges the inputs and drops messages matched by skip.
+func NewMultiplexer[T any](
+	skip func(item T) bool,
+) func(ctx context.Context, inputsChannels []chan T, outputChannel chan T) error {
+	return func(ctx context.Context, inputsChannels []chan T, outputChannel chan T) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var (
+			waitGroup sync.WaitGroup
+			errOnce   sync.Once
+			firstErr  error
+		)
+
+		readFunc := func(channel chan T) {
+			defer waitGroup.Done()
+
+			for {
+				item, ok := conveyer.Next(ctx, channel)
 				if !ok {
 					return
 				}
 
-				if strings.Contains(item, "no multiplexer") {
-					continue
-				}
+				err := conveyer.Process(ctx, item, func(ctx context.Context, item T) error {
+					if skip == nil || !skip(item) {
+						conveyer.Emit(ctx, outputChannel, item)
+					}
+
+					return nil
+				})
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+
+						cancel()
+					})
 
-				select {
-				case outputChannel <- item:
-				case <-ctx.Done():
 					return
 				}
 			}
 		}
-	}
 
-	for _, channel := range inputsChannels {
-		waitGroup.Add(1)
+		for _, channel := range inputsChannels {
+			waitGroup.Add(1)
+
+			go readFunc(channel)
+		}
+
+		waitGroup.Wait()
 
-		go readFunc(channel)
+		return firstErr
 	}
+}
+
+func PrefixDecoratorFunc(
+	ctx context.Context,
+	inputChannel chan string,
+	outputChannel chan string,
+) error {
+	return NewDecorator(decoratePrefix)(ctx, inputChannel, outputChannel)
+}
 
-	waitGroup.Wait()
+func SeparatorFunc(
+	ctx context.Context,
+	inputChannel chan string,
+	outputsChannels []chan string,
+) error {
+	return Separator(ctx, inputChannel, outputsChannels)
+}
 
-	return nil
+func MultiplexerFunc(
+	ctx context.Context,
+	inputsChannels []chan string,
+	outputChannel chan string,
+) error {
+	return NewMultiplexer(skipNoMultiplexer)(ctx, inputsChannels, outputChannel)
 }
+
+var (
+	decoratePrefix    = AddPrefix(decoratedPrefix, Contains(noDecorator))
+	skipNoMultiplexer = Contains(noMultiplexer)
+)
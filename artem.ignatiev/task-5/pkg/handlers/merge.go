@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+// NewPriorityMerge builds a multiplexer stage which always forwards from the
+// lowest-index input that has a message ready. Lower inputs may starve higher ones.
+func NewPriorityMerge[T any]() func(ctx context.Context, inputs []chan T, output chan T) error {
+	return func(ctx context.Context, inputs []chan T, output chan T) error {
+		open := append([]chan T(nil), inputs...)
+
+		for {
+			item, found := nextByPriority(ctx, open)
+			if !found {
+				index, next, ok := conveyer.NextAny(ctx, open)
+				if index < 0 {
+					return nil
+				}
+
+				if !ok {
+					open[index] = nil
+
+					continue
+				}
+
+				item = next
+			}
+
+			if err := forward(ctx, item, output); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func nextByPriority[T any](ctx context.Context, open []chan T) (T, bool) {
+	var zero T
+
+	for idx, input := range open {
+		if input == nil {
+			continue
+		}
+
+		item, ok, stillOpen := conveyer.TryNext(ctx, input)
+		if ok {
+			return item, true
+		}
+
+		if !stillOpen {
+			open[idx] = nil
+		}
+	}
+
+	return zero, false
+}
+
+// NewFairMerge builds a multiplexer stage which shares the output between busy
+// inputs in proportion to their weights (weighted fair queuing with unit-size
+// messages). An input without a weight counts as weight 1; an idle input does
+// not save up a share for later.
+func NewFairMerge[T any](weights ...int) func(ctx context.Context, inputs []chan T, output chan T) error {
+	return func(ctx context.Context, inputs []chan T, output chan T) error {
+		sources := newMergeSources(inputs)
+		finish := make([]float64, len(inputs))
+		virtual := 0.0
+
+		cost := func(idx int) float64 {
+			if idx < len(weights) && weights[idx] > 0 {
+				return 1 / float64(weights[idx])
+			}
+
+			return 1
+		}
+
+		for {
+			sources.fill(ctx)
+
+			best := -1
+
+			for idx, source := range sources {
+				if !source.full {
+					continue
+				}
+
+				// A message gets its finish tag once, when it reaches the head of its input.
+				if !source.tagged {
+					source.tag = max(finish[idx], virtual) + cost(idx)
+					source.tagged = true
+					finish[idx] = source.tag
+				}
+
+				if best < 0 || source.tag < sources[best].tag {
+					best = idx
+				}
+			}
+
+			if best < 0 {
+				if !sources.wait(ctx) {
+					return nil
+				}
+
+				continue
+			}
+
+			virtual = max(virtual, sources[best].tag-cost(best))
+			sources[best].tagged = false
+
+			if err := forward(ctx, sources.take(best), output); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// NewOrderedMerge builds a multiplexer stage which merges inputs that are each
+// sorted by less into one sorted output, for example by a sequence number or
+// timestamp in the payload. It waits until every open input has a message.
+func NewOrderedMerge[T any](less func(a, b T) bool) func(ctx context.Context, inputs []chan T, output chan T) error {
+	return func(ctx context.Context, inputs []chan T, output chan T) error {
+		sources := newMergeSources(inputs)
+
+		for {
+			for idx, source := range sources {
+				if source.full || source.closed {
+					continue
+				}
+
+				item, ok := conveyer.Next(ctx, source.input)
+				if !ok {
+					source.closed = true
+
+					continue
+				}
+
+				sources[idx].item, sources[idx].full = item, true
+			}
+
+			best := -1
+
+			for idx, source := range sources {
+				if source.full && (best < 0 || less(source.item, sources[best].item)) {
+					best = idx
+				}
+			}
+
+			if best < 0 {
+				return nil
+			}
+
+			if err := forward(ctx, sources.take(best), output); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type mergeSource[T any] struct {
+	input  chan T
+	item   T
+	full   bool
+	closed bool
+	tag    float64
+	tagged bool
+}
+
+type mergeSources[T any] []*mergeSource[T]
+
+func newMergeSources[T any](inputs []chan T) mergeSources[T] {
+	sources := make(mergeSources[T], len(inputs))
+	for idx, input := range inputs {
+		sources[idx] = &mergeSource[T]{input: input}
+	}
+
+	return sources
+}
+
+// fill takes a ready message into every empty source without blocking.
+func (s mergeSources[T]) fill(ctx context.Context) {
+	for _, source := range s {
+		if source.full || source.closed {
+			continue
+		}
+
+		item, ok, open := conveyer.TryNext(ctx, source.input)
+		source.item, source.full, source.closed = item, ok, !open
+	}
+}
+
+// wait blocks until an open source gets a message. It reports false when
+// there is nothing left to wait for.
+func (s mergeSources[T]) wait(ctx context.Context) bool {
+	inputs := make([]chan T, len(s))
+
+	for idx, source := range s {
+		if !source.closed {
+			inputs[idx] = source.input
+		}
+	}
+
+	for {
+		index, item, ok := conveyer.NextAny(ctx, inputs)
+		if index < 0 {
+			return false
+		}
+
+		if ok {
+			s[index].item, s[index].full = item, true
+
+			return true
+		}
+
+		s[index].closed = true
+		inputs[index] = nil
+	}
+}
+
+func (s mergeSources[T]) take(index int) T {
+	var zero T
+
+	item := s[index].item
+	s[index].item, s[index].full = zero, false
+
+	return item
+}
+
+func forward[T any](ctx context.Context, item T, output chan T) error {
+	return conveyer.Process(ctx, item, func(ctx context.Context, item T) error {
+		conveyer.Emit(ctx, output, item)
+
+		return nil
+	})
+}
@@ -0,0 +1,218 @@
+package handlers_test
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+type mergeFunc[T any] func(ctx context.Context, inputs []chan T, output chan T) error
+
+// runMerge runs a merge over inputs which are already full and closed.
+func runMerge[T any](t *testing.T, merge mergeFunc[T], inputs [][]T) []T {
+	t.Helper()
+
+	channels := make([]chan T, len(inputs))
+	total := 0
+
+	for idx, items := range inputs {
+		channels[idx] = make(chan T, len(items))
+
+		for _, item := range items {
+			channels[idx] <- item
+		}
+
+		close(channels[idx])
+
+		total += len(items)
+	}
+
+	output := make(chan T, total)
+	require.NoError(t, merge(context.Background(), channels, output))
+	close(output)
+
+	results := make([]T, 0, total)
+	for item := range output {
+		results = append(results, item)
+	}
+
+	return results
+}
+
+func series(from, count int) []int {
+	items := make([]int, count)
+	for idx := range items {
+		items[idx] = from + idx
+	}
+
+	return items
+}
+
+func TestPriorityMerge(t *testing.T) {
+	t.Parallel()
+
+	high, low := series(0, 50), series(1000, 50)
+	results := runMerge(t, handlers.NewPriorityMerge[int](), [][]int{high, low})
+
+	// With both inputs saturated the high priority one is always served first.
+	assert.Equal(t, append(high, low...), results)
+}
+
+func TestPriorityMergeServesLowWhenHighIsIdle(t *testing.T) {
+	t.Parallel()
+
+	high, low := make(chan int), make(chan int, 1)
+	output := make(chan int, 4)
+	done := make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		done <- handlers.NewPriorityMerge[int]()(ctx, []chan int{high, low}, output)
+	}()
+
+	low <- 1
+	assert.Equal(t, 1, <-output)
+
+	high <- 2
+	assert.Equal(t, 2, <-output)
+
+	close(high)
+	close(low)
+	require.NoError(t, <-done)
+}
+
+func TestFairMerge(t *testing.T) {
+	t.Parallel()
+
+	hot, cold := series(0, 300), series(1000, 300)
+	results := runMerge(t, handlers.NewFairMerge[int](3, 1), [][]int{hot, cold})
+
+	require.Len(t, results, 600)
+
+	// While both inputs are busy every round of four serves three hot and one
+	// cold message, so the hot input cannot starve the cold one.
+	for round := 0; round < 100; round++ {
+		fromHot := 0
+
+		for _, item := range results[round*4 : round*4+4] {
+			if item < 1000 {
+				fromHot++
+			}
+		}
+
+		assert.Equal(t, 3, fromHot, "round %d", round)
+	}
+
+	assert.True(t, slices.IsSorted(results[400:]), "the cold input is drained in order after the hot one ends")
+}
+
+func TestFairMergeEqualWeights(t *testing.T) {
+	t.Parallel()
+
+	results := runMerge(t, handlers.NewFairMerge[int](), [][]int{series(0, 3), series(10, 3), series(20, 3)})
+
+	assert.Equal(t, []int{0, 10, 20, 1, 11, 21, 2, 12, 22}, results)
+}
+
+type event struct {
+	Seq    int
+	Source int
+}
+
+func TestOrderedMerge(t *testing.T) {
+	t.Parallel()
+
+	const (
+		sources = 3
+		total   = 300
+	)
+
+	inputs := make([]chan event, sources)
+	for idx := range inputs {
+		inputs[idx] = make(chan event)
+	}
+
+	var wg sync.WaitGroup
+
+	for source, input := range inputs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer close(input)
+
+			random := rand.New(rand.NewPCG(uint64(source), 1))
+
+			for seq := source; seq < total; seq += sources {
+				time.Sleep(time.Duration(random.IntN(200)) * time.Microsecond)
+
+				input <- event{Seq: seq, Source: source}
+			}
+		}()
+	}
+
+	output := make(chan event, total)
+	merge := handlers.NewOrderedMerge(func(a, b event) bool { return a.Seq < b.Seq })
+
+	require.NoError(t, merge(context.Background(), inputs, output))
+	wg.Wait()
+	close(output)
+
+	seqs := make([]int, 0, total)
+	for item := range output {
+		seqs = append(seqs, item.Seq)
+	}
+
+	assert.Equal(t, series(0, total), seqs)
+}
+
+func TestMergeInConveyer(t *testing.T) {
+	t.Parallel()
+
+	conv := conveyer.NewOf[int](8)
+	conv.RegisterMultiplexer(handlers.NewPriorityMerge[int](), []string{"urgent", "normal"}, "output")
+	conv.DeclareInputs("urgent", "normal")
+	conv.DeclareOutputs("output")
+
+	for _, item := range series(100, 4) {
+		require.NoError(t, conv.Send("normal", item))
+	}
+
+	for _, item := range series(0, 4) {
+		require.NoError(t, conv.Send("urgent", item))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	results := make([]int, 0, 8)
+
+	for range 8 {
+		item, err := conv.Recv("output")
+		require.NoError(t, err)
+
+		results = append(results, item)
+	}
+
+	assert.Equal(t, append(series(0, 4), series(100, 4)...), results)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, uint64(8), conv.Stats().Stages[0].Processed)
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+)
+
+var ErrNoRoute = errors.New("no output for message")
+
+// Strategy picks the outputs of a separator a message is sent to.
+type Strategy[T any] func(item T, outputs []chan T) ([]int, error)
+
+// Rule sends messages matched by Match to the output with index Output.
+type Rule[T any] struct {
+	Match  func(item T) bool
+	Output int
+}
+
+// NewRouter builds a separator stage which routes every message with strategy.
+// A routing error is handled by the stage error policy.
+func NewRouter[T any](strategy Strategy[T]) func(ctx context.Context, input chan T, outputs []chan T) error {
+	return newRouter(func(_ context.Context, item T, outputs []chan T) ([]int, error) {
+		return strategy(item, outputs)
+	})
+}
+
+// newRouter is NewRouter for strategies which need the message context.
+func newRouter[T any](
+	strategy func(ctx context.Context, item T, outputs []chan T) ([]int, error),
+) func(ctx context.Context, input chan T, outputs []chan T) error {
+	return func(ctx context.Context, input chan T, outputs []chan T) error {
+		if len(outputs) == 0 {
+			return nil
+		}
+
+		for {
+			item, ok := conveyer.Next(ctx, input)
+			if !ok {
+				return nil
+			}
+
+			err := conveyer.Process(ctx, item, func(ctx context.Context, item T) error {
+				targets, err := strategy(ctx, item, outputs)
+				if err != nil {
+					return err
+				}
+
+				for _, target := range targets {
+					if target < 0 || target >= len(outputs) {
+						return fmt.Errorf("%w: output %d of %d", ErrNoRoute, target, len(outputs))
+					}
+				}
+
+				for _, target := range targets {
+					if !conveyer.Emit(ctx, outputs[target], item) {
+						return nil
+					}
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RoundRobin cycles through the outputs.
+func RoundRobin[T any]() Strategy[T] {
+	return roundRobinFrom[T](new(atomic.Uint64))
+}
+
+func roundRobinFrom[T any](next *atomic.Uint64) Strategy[T] {
+	return func(_ T, outputs []chan T) ([]int, error) {
+		return []int{int((next.Add(1) - 1) % uint64(len(outputs)))}, nil
+	}
+}
+
+// HashBy sends messages with the same key to the same output.
+func HashBy[T any](key func(item T) string) Strategy[T] {
+	return func(item T, outputs []chan T) ([]int, error) {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(key(item)))
+
+		return []int{int(hash.Sum32() % uint32(len(outputs)))}, nil
+	}
+}
+
+// Weighted spreads messages in proportion to the weights of the outputs, using
+// smooth weighted round-robin so heavy outputs do not get long runs. Outputs
+// without a weight get none.
+func Weighted[T any](weights ...int) Strategy[T] {
+	var (
+		mu      sync.Mutex
+		current = make([]int, len(weights))
+	)
+
+	return func(_ T, outputs []chan T) ([]int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		best, total := -1, 0
+
+		for idx := range min(len(weights), len(outputs)) {
+			if weights[idx] <= 0 {
+				continue
+			}
+
+			current[idx] += weights[idx]
+			total += weights[idx]
+
+			if best < 0 || current[idx] > current[best] {
+				best = idx
+			}
+		}
+
+		if best < 0 {
+			return nil, fmt.Errorf("%w: no output has a weight", ErrNoRoute)
+		}
+
+		current[best] -= total
+
+		return []int{best}, nil
+	}
+}
+
+// LeastLoaded sends each message to the output with the fewest queued
+// messages, preferring lower indexes on ties.
+func LeastLoaded[T any]() Strategy[T] {
+	return func(_ T, outputs []chan T) ([]int, error) {
+		best := 0
+
+		for idx := 1; idx < len(outputs); idx++ {
+			if len(outputs[idx]) < len(outputs[best]) {
+				best = idx
+			}
+		}
+
+		return []int{best}, nil
+	}
+}
+
+// Rules sends a message to the output of the first matching rule, or to
+// fallback. A negative fallback makes unmatched messages fail with ErrNoRoute.
+func Rules[T any](fallback int, rules ...Rule[T]) Strategy[T] {
+	return func(item T, _ []chan T) ([]int, error) {
+		for _, rule := range rules {
+			if rule.Match(item) {
+				return []int{rule.Output}, nil
+			}
+		}
+
+		if fallback < 0 {
+			return nil, fmt.Errorf("%w: no rule matched", ErrNoRoute)
+		}
+
+		return []int{fallback}, nil
+	}
+}
+
+// Broadcast sends every message to all outputs.
+func Broadcast[T any]() Strategy[T] {
+	return func(_ T, outputs []chan T) ([]int, error) {
+		targets := make([]int, len(outputs))
+		for idx := range targets {
+			targets[idx] = idx
+		}
+
+		return targets, nil
+	}
+}
@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+// runRouter routes items over count outputs and returns what each one got.
+func runRouter[T any](t *testing.T, strategy handlers.Strategy[T], count int, items []T) [][]T {
+	t.Helper()
+
+	input := make(chan T, len(items))
+	outputs := make([]chan T, count)
+
+	for idx := range outputs {
+		outputs[idx] = make(chan T, len(items)*count)
+	}
+
+	for _, item := range items {
+		input <- item
+	}
+
+	close(input)
+
+	require.NoError(t, handlers.NewRouter(strategy)(context.Background(), input, outputs))
+
+	results := make([][]T, count)
+
+	for idx, output := range outputs {
+		close(output)
+
+		for item := range output {
+			results[idx] = append(results[idx], item)
+		}
+	}
+
+	return results
+}
+
+func TestRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, [][]int{{1, 4}, {2, 5}, {3}}, runRouter(t, handlers.RoundRobin[int](), 3, numbers(5)))
+}
+
+func TestHashBy(t *testing.T) {
+	t.Parallel()
+
+	items := make([]string, 0, 60)
+	for idx := range 60 {
+		items = append(items, fmt.Sprintf("user%d:event%d", idx%6, idx))
+	}
+
+	userOf := func(item string) string { return strings.Split(item, ":")[0] }
+	results := runRouter(t, handlers.HashBy(userOf), 3, items)
+
+	owner := make(map[string]int)
+
+	for idx, output := range results {
+		for _, item := range output {
+			if prev, ok := owner[userOf(item)]; ok {
+				assert.Equal(t, prev, idx, "key %s reached two outputs", userOf(item))
+			}
+
+			owner[userOf(item)] = idx
+		}
+	}
+
+	assert.Len(t, owner, 6)
+	assert.Equal(t, results, runRouter(t, handlers.HashBy(userOf), 3, items), "routing is stable across runs")
+}
+
+func TestWeighted(t *testing.T) {
+	t.Parallel()
+
+	results := runRouter(t, handlers.Weighted[int](3, 1, 0), 3, numbers(8))
+
+	assert.Equal(t, [][]int{{1, 2, 4, 5, 6, 8}, {3, 7}, nil}, results)
+
+	input := make(chan int, 1)
+	input <- 1
+	close(input)
+
+	err := handlers.NewRouter(handlers.Weighted[int]())(context.Background(), input, []chan int{make(chan int, 1)})
+	require.ErrorIs(t, err, handlers.ErrNoRoute)
+}
+
+func TestLeastLoaded(t *testing.T) {
+	t.Parallel()
+
+	outputs := []chan int{make(chan int, 8), make(chan int, 8), make(chan int, 8)}
+	outputs[0] <- 0
+	outputs[0] <- 0
+	outputs[2] <- 0
+
+	route := handlers.LeastLoaded[int]()
+
+	for _, want := range []int{1, 1, 2} {
+		targets, err := route(0, outputs)
+		require.NoError(t, err)
+		require.Equal(t, []int{want}, targets)
+
+		outputs[want] <- 0
+	}
+
+	<-outputs[0]
+	<-outputs[0]
+
+	targets, err := route(0, outputs)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0}, targets)
+}
+
+func TestRules(t *testing.T) {
+	t.Parallel()
+
+	rules := []handlers.Rule[string]{
+		{Match: handlers.Contains("error"), Output: 0},
+		{Match: handlers.Contains("warn"), Output: 1},
+	}
+	items := []string{"error: disk", "info: ok", "warn: cpu", "error: net"}
+
+	results := runRouter(t, handlers.Rules(2, rules...), 3, items)
+	assert.Equal(t, [][]string{{"error: disk", "error: net"}, {"warn: cpu"}, {"info: ok"}}, results)
+
+	input := make(chan string, 1)
+	input <- "info"
+	close(input)
+
+	err := handlers.NewRouter(handlers.Rules(-1, rules...))(context.Background(), input, make([]chan string, 2))
+	require.ErrorIs(t, err, handlers.ErrNoRoute)
+}
+
+func TestBroadcast(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, [][]int{{1, 2}, {1, 2}, {1, 2}}, runRouter(t, handlers.Broadcast[int](), 3, numbers(2)))
+}
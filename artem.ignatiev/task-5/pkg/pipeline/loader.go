@@ -0,0 +1,455 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/expr"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+var (
+	ErrUnknownStageType = errors.New("unknown stage type")
+	ErrStageChannels    = errors.New("wrong number of stage channels")
+	ErrInvalidSize      = errors.New("channel size must not be negative")
+	ErrUnknownAction    = errors.New("unknown error action")
+	ErrUnknownOverflow  = errors.New("unknown overflow policy")
+	ErrRemoteAddress    = errors.New("remote channel needs exactly one of listen and dial")
+	ErrUnknownStrategy  = errors.New("unknown routing or merge strategy")
+	ErrRouteOutput      = errors.New("route names a channel which is not a stage output")
+	ErrExprStage        = errors.New("expressions only fit decorators and separators")
+	ErrInvalidWorkers   = errors.New("workers must not be negative")
+	ErrHandlerConflict  = errors.New("a stage takes either a handler or a built-in")
+)
+
+const defaultNetwork = "tcp"
+
+var overflowPolicies = map[string]conveyer.OverflowPolicy{
+	"block":       conveyer.OverflowBlock,
+	"fail":        conveyer.OverflowFail,
+	"drop-oldest": conveyer.OverflowDropOldest,
+	"drop-newest": conveyer.OverflowDropNewest,
+}
+
+type ErrorPolicy struct {
+	Action     string        `yaml:"action"`
+	Retries    int           `yaml:"retries"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max-backoff"`
+	DeadLetter string        `yaml:"dead-letter"`
+}
+
+// RouteRule sends messages containing a substring to an output channel.
+type RouteRule struct {
+	Contains string `yaml:"contains"`
+	Output   string `yaml:"output"`
+}
+
+// Route selects a built-in routing strategy for a separator instead of a handler.
+// Hashing and rules look at the message formatted with fmt.Sprint.
+type Route struct {
+	Strategy string      `yaml:"strategy"`
+	Weights  []int       `yaml:"weights"`
+	Rules    []RouteRule `yaml:"rules"`
+	Fallback string      `yaml:"fallback"`
+}
+
+// Merge selects a built-in merge strategy for a multiplexer instead of a handler.
+type Merge struct {
+	Strategy string `yaml:"strategy"`
+	Weights  []int  `yaml:"weights"`
+}
+
+// Stage describes one stage. Instead of a handler, a decorator may give an
+// expression over msg which maps (expr) or filters (filter) the messages, and a
+// separator an int expression which picks the output (expr); see package expr.
+type Stage struct {
+	Type        conveyer.StageKind `yaml:"type"`
+	Handler     string             `yaml:"handler"`
+	Expr        string             `yaml:"expr"`
+	Filter      string             `yaml:"filter"`
+	ExprTimeout time.Duration      `yaml:"expr-timeout"`
+	Route       *Route             `yaml:"route"`
+	Merge       *Merge             `yaml:"merge"`
+	Inputs      []string           `yaml:"inputs"`
+	Outputs     []string           `yaml:"outputs"`
+	OnError     *ErrorPolicy       `yaml:"on-error"`
+	Workers     int                `yaml:"workers"`
+	Ordered     bool               `yaml:"ordered"`
+}
+
+// Remote bridges a channel to another process: a listening side feeds the
+// channel, a dialing side drains it.
+type Remote struct {
+	Network string `yaml:"network"`
+	Listen  string `yaml:"listen"`
+	Dial    string `yaml:"dial"`
+}
+
+// Definition is the YAML description of a conveyer pipeline.
+type Definition struct {
+	ChanSize   int                      `yaml:"chan-size"`
+	Inputs     []string                 `yaml:"inputs"`
+	Outputs    []string                 `yaml:"outputs"`
+	Overflow   map[string]string        `yaml:"overflow"`
+	AckTimeout map[string]time.Duration `yaml:"ack-timeout"`
+	Remote     map[string]Remote        `yaml:"remote"`
+	Stages     []Stage                  `yaml:"stages"`
+}
+
+func LoadFile(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read pipeline file: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes a YAML definition. Unknown keys are errors, so a misspelled
+// field is not silently ignored.
+func Parse(data []byte) (*Definition, error) {
+	var def Definition
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&def); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse YAML: %w", err)
+	}
+
+	if def.ChanSize < 0 {
+		return nil, fmt.Errorf("pipeline validation: %w", ErrInvalidSize)
+	}
+
+	return &def, nil
+}
+
+// Build creates a string conveyer from the definition. Listeners of remote
+// channels stay open for the life of the process, unless Build fails.
+func Build(def *Definition, registry *Registry[string]) (*conveyer.Conveyer[string], error) {
+	conv := conveyer.New(def.ChanSize)
+
+	if err := Wire(conv, def, registry); err != nil {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, len(def.Remote))
+
+	for name, remote := range def.Remote {
+		listener, err := wireRemote(conv, name, remote)
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+
+			return nil, fmt.Errorf("remote channel %q: %w", name, err)
+		}
+
+		if listener != nil {
+			listeners = append(listeners, listener)
+		}
+	}
+
+	return conv, nil
+}
+
+// wireRemote declares a remote channel and returns the listener it opened, if
+// any.
+func wireRemote(conv *conveyer.Conveyer[string], name string, remote Remote) (net.Listener, error) {
+	network := remote.Network
+	if network == "" {
+		network = defaultNetwork
+	}
+
+	switch {
+	case remote.Listen != "" && remote.Dial == "":
+		listener, err := net.Listen(network, remote.Listen)
+		if err != nil {
+			return nil, fmt.Errorf("listen: %w", err)
+		}
+
+		conv.DeclareRemoteInput(name, listener, conveyer.StringCodec{})
+
+		return listener, nil
+	case remote.Dial != "" && remote.Listen == "":
+		conv.DeclareRemoteOutput(name, network, remote.Dial, conveyer.StringCodec{})
+
+		return nil, nil
+	default:
+		return nil, ErrRemoteAddress
+	}
+}
+
+// Wire registers the stages of the definition on an existing conveyer.
+func Wire[T any](conv *conveyer.Conveyer[T], def *Definition, registry *Registry[T]) error {
+	for idx, stage := range def.Stages {
+		if err := wireStage(conv, stage, registry); err != nil {
+			return fmt.Errorf("stage %d (%s %s): %w", idx, stage.Type, stage.describe(), err)
+		}
+	}
+
+	for name, value := range def.Overflow {
+		policy, ok := overflowPolicies[value]
+		if !ok {
+			return fmt.Errorf("channel %q: %w: %q", name, ErrUnknownOverflow, value)
+		}
+
+		conv.SetOverflow(name, policy)
+	}
+
+	for name, visibility := range def.AckTimeout {
+		if err := conv.SetAckTimeout(name, visibility); err != nil {
+			return fmt.Errorf("channel %q: %w", name, err)
+		}
+	}
+
+	if len(def.Inputs) > 0 {
+		conv.DeclareInputs(def.Inputs...)
+	}
+
+	if len(def.Outputs) > 0 {
+		conv.DeclareOutputs(def.Outputs...)
+	}
+
+	return nil
+}
+
+func (p *ErrorPolicy) options() ([]conveyer.StageOption, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	policy := conveyer.ErrorPolicy{
+		Action:     conveyer.ActionFail,
+		Retries:    p.Retries,
+		Backoff:    p.Backoff,
+		MaxBackoff: p.MaxBackoff,
+		DeadLetter: p.DeadLetter,
+	}
+
+	switch p.Action {
+	case "", "fail":
+	case "skip":
+		policy.Action = conveyer.ActionSkip
+	case "dead-letter":
+		if p.DeadLetter == "" {
+			return nil, fmt.Errorf("%w: dead-letter needs a channel name", ErrUnknownAction)
+		}
+
+		policy.Action = conveyer.ActionDeadLetter
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAction, p.Action)
+	}
+
+	return []conveyer.StageOption{conveyer.WithErrorPolicy(policy)}, nil
+}
+
+// describe names a stage in errors by its handler, or else by the built-in it
+// uses.
+func (s Stage) describe() string {
+	switch {
+	case s.Handler != "":
+		return fmt.Sprintf("%q", s.Handler)
+	case s.Expr != "":
+		return "expr"
+	case s.Filter != "":
+		return "filter"
+	case s.Route != nil:
+		return fmt.Sprintf("route %q", s.Route.Strategy)
+	case s.Merge != nil:
+		return fmt.Sprintf("merge %q", s.Merge.Strategy)
+	default:
+		return "without handler"
+	}
+}
+
+func (s Stage) options() ([]conveyer.StageOption, error) {
+	if s.Workers < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidWorkers, s.Workers)
+	}
+
+	opts, err := s.OnError.options()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Workers > 1 {
+		opts = append(opts, conveyer.WithWorkers(s.Workers))
+	}
+
+	if s.Ordered {
+		opts = append(opts, conveyer.WithOrderedOutput())
+	}
+
+	return opts, nil
+}
+
+func wireStage[T any](conv *conveyer.Conveyer[T], stage Stage, registry *Registry[T]) error {
+	builtin := stage.Expr != "" || stage.Filter != "" || stage.Route != nil || stage.Merge != nil
+	if stage.Handler != "" && builtin {
+		return fmt.Errorf("%w: %q", ErrHandlerConflict, stage.Handler)
+	}
+
+	opts, err := stage.options()
+	if err != nil {
+		return err
+	}
+
+	switch stage.Type {
+	case conveyer.KindDecorator:
+		if len(stage.Inputs) != 1 || len(stage.Outputs) != 1 {
+			return fmt.Errorf("%w: decorator needs one input and one output", ErrStageChannels)
+		}
+
+		fn, err := decoratorFor(stage, registry)
+		if err != nil {
+			return err
+		}
+
+		conv.RegisterDecorator(fn, stage.Inputs[0], stage.Outputs[0], opts...)
+	case conveyer.KindMultiplexer:
+		if stage.Expr != "" || stage.Filter != "" {
+			return ErrExprStage
+		}
+
+		if len(stage.Inputs) == 0 || len(stage.Outputs) != 1 {
+			return fmt.Errorf("%w: multiplexer needs inputs and one output", ErrStageChannels)
+		}
+
+		fn, err := multiplexerFor(stage, registry)
+		if err != nil {
+			return err
+		}
+
+		conv.RegisterMultiplexer(fn, stage.Inputs, stage.Outputs[0], opts...)
+	case conveyer.KindSeparator:
+		if len(stage.Inputs) != 1 || len(stage.Outputs) == 0 {
+			return fmt.Errorf("%w: separator needs one input and outputs", ErrStageChannels)
+		}
+
+		fn, err := separatorFor(stage, registry)
+		if err != nil {
+			return err
+		}
+
+		conv.RegisterSeparator(fn, stage.Inputs[0], stage.Outputs, opts...)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownStageType, stage.Type)
+	}
+
+	return nil
+}
+
+func decoratorFor[T any](stage Stage, registry *Registry[T]) (DecoratorFunc[T], error) {
+	switch {
+	case stage.Expr != "" && stage.Filter != "":
+		return nil, fmt.Errorf("%w: a decorator takes either expr or filter", ErrExprStage)
+	case stage.Expr != "":
+		return handlers.ExprDecorator[T](stage.Expr, stage.exprOptions()...)
+	case stage.Filter != "":
+		return handlers.ExprFilter[T](stage.Filter, stage.exprOptions()...)
+	default:
+		return registry.Decorator(stage.Handler)
+	}
+}
+
+func (s Stage) exprOptions() []expr.Option {
+	if s.ExprTimeout == 0 {
+		return nil
+	}
+
+	return []expr.Option{expr.WithTimeout(s.ExprTimeout)}
+}
+
+func multiplexerFor[T any](stage Stage, registry *Registry[T]) (MultiplexerFunc[T], error) {
+	if stage.Merge == nil {
+		return registry.Multiplexer(stage.Handler)
+	}
+
+	switch stage.Merge.Strategy {
+	case "priority":
+		return handlers.NewPriorityMerge[T](), nil
+	case "fair":
+		return handlers.NewFairMerge[T](stage.Merge.Weights...), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStrategy, stage.Merge.Strategy)
+	}
+}
+
+func separatorFor[T any](stage Stage, registry *Registry[T]) (SeparatorFunc[T], error) {
+	switch {
+	case stage.Filter != "":
+		return nil, fmt.Errorf("%w: a separator takes expr, not filter", ErrExprStage)
+	case stage.Expr != "" && stage.Route != nil:
+		return nil, fmt.Errorf("%w: a separator takes either expr or route", ErrExprStage)
+	case stage.Expr != "":
+		return handlers.ExprRouter[T](stage.Expr, stage.exprOptions()...)
+	}
+
+	if stage.Route == nil {
+		return registry.Separator(stage.Handler)
+	}
+
+	if stage.Route.Strategy == "" || stage.Route.Strategy == "round-robin" {
+		return handlers.Separator[T], nil
+	}
+
+	strategy, err := strategyFor[T](stage.Route, stage.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return handlers.NewRouter(strategy), nil
+}
+
+func strategyFor[T any](route *Route, outputs []string) (handlers.Strategy[T], error) {
+	switch route.Strategy {
+	case "hash":
+		return handlers.HashBy(func(item T) string { return fmt.Sprint(item) }), nil
+	case "weighted":
+		return handlers.Weighted[T](route.Weights...), nil
+	case "least-loaded":
+		return handlers.LeastLoaded[T](), nil
+	case "broadcast":
+		return handlers.Broadcast[T](), nil
+	case "rules":
+		fallback := -1
+
+		if route.Fallback != "" {
+			fallback = slices.Index(outputs, route.Fallback)
+			if fallback < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrRouteOutput, route.Fallback)
+			}
+		}
+
+		rules := make([]handlers.Rule[T], 0, len(route.Rules))
+
+		for _, rule := range route.Rules {
+			output := slices.Index(outputs, rule.Output)
+			if output < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrRouteOutput, rule.Output)
+			}
+
+			substr := rule.Contains
+			rules = append(rules, handlers.Rule[T]{
+				Match:  func(item T) bool { return strings.Contains(fmt.Sprint(item), substr) },
+				Output: output,
+			})
+		}
+
+		return handlers.Rules(fallback, rules...), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStrategy, route.Strategy)
+	}
+}
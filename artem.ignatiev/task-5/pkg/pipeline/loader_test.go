@@ -0,0 +1,428 @@
+package pipeline_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/expr"
+	"github.com/kryjkaqq/task-5/pkg/pipeline"
+)
+
+const demoPipeline = `
+chan-size: 2
+inputs: [input]
+outputs: [final_output]
+stages:
+  - type: decorator
+    handler: PrefixDecoratorFunc
+    inputs: [input]
+    outputs: [decorated]
+  - type: separator
+    handler: SeparatorFunc
+    inputs: [decorated]
+    outputs: [part1, part2]
+  - type: multiplexer
+    handler: MultiplexerFunc
+    inputs: [part1, part2]
+    outputs: [final_output]
+`
+
+func TestLoadAndRun(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(demoPipeline), 0o600))
+
+	def, err := pipeline.LoadFile(path)
+	require.NoError(t, err)
+	require.Len(t, def.Stages, 3)
+
+	conv, err := pipeline.Build(def, pipeline.NewRegistry())
+	require.NoError(t, err)
+	require.NoError(t, conv.Validate())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	require.NoError(t, conv.Send("input", "hello"))
+
+	res, err := conv.Recv("final_output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: hello", res)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestBuildErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		yaml string
+		err  error
+		at   string
+	}{
+		{
+			name: "unknown handler",
+			yaml: "stages:\n  - {type: decorator, handler: Nope, inputs: [a], outputs: [b]}\n",
+			err:  pipeline.ErrUnknownHandler,
+		},
+		{
+			name: "unknown stage type",
+			yaml: "stages:\n  - {type: filter, handler: PrefixDecoratorFunc, inputs: [a], outputs: [b]}\n",
+			err:  pipeline.ErrUnknownStageType,
+		},
+		{
+			name: "unknown strategy",
+			yaml: "stages:\n  - {type: separator, route: {strategy: random}, inputs: [a], outputs: [b]}\n",
+			err:  pipeline.ErrUnknownStrategy,
+			at:   `stage 0 (separator route "random")`,
+		},
+		{
+			name: "unknown merge strategy",
+			yaml: "stages:\n  - {type: multiplexer, merge: {strategy: zip}, inputs: [a, b], outputs: [c]}\n",
+			err:  pipeline.ErrUnknownStrategy,
+			at:   `stage 0 (multiplexer merge "zip")`,
+		},
+		{
+			name: "route to unknown output",
+			yaml: "stages:\n  - {type: separator, route: {strategy: rules, fallback: c}, inputs: [a], outputs: [b]}\n",
+			err:  pipeline.ErrRouteOutput,
+		},
+		{
+			name: "expression does not compile",
+			yaml: "stages:\n  - {type: decorator, expr: 'upper(msg', inputs: [a], outputs: [b]}\n",
+			err:  expr.ErrSyntax,
+			at:   "stage 0 (decorator expr)",
+		},
+		{
+			name: "expression on a multiplexer",
+			yaml: "stages:\n  - {type: multiplexer, expr: msg, inputs: [a, b], outputs: [c]}\n",
+			err:  pipeline.ErrExprStage,
+		},
+		{
+			name: "wrong channels",
+			yaml: "stages:\n  - {type: decorator, handler: PrefixDecoratorFunc, inputs: [a, c], outputs: [b]}\n",
+			err:  pipeline.ErrStageChannels,
+			at:   `stage 0 (decorator "PrefixDecoratorFunc")`,
+		},
+		{
+			name: "negative workers",
+			yaml: "stages:\n  - {type: decorator, handler: PrefixDecoratorFunc, inputs: [a], outputs: [b]}\n" +
+				"  - {type: decorator, filter: 'len(msg) > 1', workers: -2, inputs: [b], outputs: [c]}\n",
+			err: pipeline.ErrInvalidWorkers,
+			at:  "stage 1 (decorator filter)",
+		},
+		{
+			name: "handler with merge",
+			yaml: "stages:\n  - {type: multiplexer, handler: MultiplexerFunc, merge: {strategy: fair}, " +
+				"inputs: [a, b], outputs: [c]}\n",
+			err: pipeline.ErrHandlerConflict,
+			at:  `stage 0 (multiplexer "MultiplexerFunc")`,
+		},
+		{
+			name: "handler with route",
+			yaml: "stages:\n  - {type: separator, handler: SeparatorFunc, route: {strategy: hash}, " +
+				"inputs: [a], outputs: [b, c]}\n",
+			err: pipeline.ErrHandlerConflict,
+			at:  `stage 0 (separator "SeparatorFunc")`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			def, err := pipeline.Parse([]byte(test.yaml))
+			require.NoError(t, err)
+
+			_, err = pipeline.Build(def, pipeline.NewRegistry())
+			require.ErrorIs(t, err, test.err)
+
+			if test.at != "" {
+				assert.ErrorContains(t, err, test.at)
+			}
+		})
+	}
+
+	def, err := pipeline.Parse([]byte(
+		"stages:\n  - {type: decorator, handler: PrefixDecoratorFunc, inputs: [a], outputs: [b], " +
+			"on-error: {action: retry}}\n"))
+	require.NoError(t, err)
+
+	_, err = pipeline.Build(def, pipeline.NewRegistry())
+	require.ErrorIs(t, err, pipeline.ErrUnknownAction)
+
+	def, err = pipeline.Parse([]byte("overflow: {input: sometimes}\n"))
+	require.NoError(t, err)
+
+	_, err = pipeline.Build(def, pipeline.NewRegistry())
+	require.ErrorIs(t, err, pipeline.ErrUnknownOverflow)
+
+	def, err = pipeline.Parse([]byte("ack-timeout: {output: 0s}\n"))
+	require.NoError(t, err)
+
+	_, err = pipeline.Build(def, pipeline.NewRegistry())
+	require.ErrorIs(t, err, conveyer.ErrInvalidVisibility)
+
+	def, err = pipeline.Parse([]byte("remote: {input: {listen: ':0', dial: ':1'}}\n"))
+	require.NoError(t, err)
+
+	_, err = pipeline.Build(def, pipeline.NewRegistry())
+	require.ErrorIs(t, err, pipeline.ErrRemoteAddress)
+
+	_, err = pipeline.Parse([]byte("chan-size: -1\n"))
+	require.ErrorIs(t, err, pipeline.ErrInvalidSize)
+
+	_, err = pipeline.Parse([]byte("stages:\n  - {type: decorator, hadler: PrefixDecoratorFunc}\n"))
+	require.ErrorContains(t, err, "field hadler not found")
+
+	def, err = pipeline.Parse(nil)
+	require.NoError(t, err)
+	assert.Empty(t, def.Stages)
+}
+
+func TestBuildClosesListenersOnError(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "pipe")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "link.sock")
+
+	def, err := pipeline.Parse([]byte(`
+remote:
+  first: {network: unix, listen: ` + socket + `}
+  second: {network: unix, listen: ` + socket + `}
+`))
+	require.NoError(t, err)
+
+	_, err = pipeline.Build(def, pipeline.NewRegistry())
+	require.ErrorContains(t, err, "listen")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err, "the listener opened before the error is closed")
+	require.NoError(t, listener.Close())
+}
+
+func TestRemoteFromYAML(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "pipe")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "link.sock")
+
+	front, err := pipeline.Parse([]byte(`
+inputs: [input]
+remote:
+  link: {network: unix, dial: ` + socket + `}
+stages:
+  - {type: decorator, handler: PrefixDecoratorFunc, inputs: [input], outputs: [link]}
+`))
+	require.NoError(t, err)
+
+	back, err := pipeline.Parse([]byte(`
+outputs: [link]
+remote:
+  link: {network: unix, listen: ` + socket + `}
+`))
+	require.NoError(t, err)
+
+	backConv, err := pipeline.Build(back, pipeline.NewRegistry())
+	require.NoError(t, err)
+
+	frontConv, err := pipeline.Build(front, pipeline.NewRegistry())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = backConv.Run(ctx) }()
+	go func() { _ = frontConv.Run(ctx) }()
+
+	require.NoError(t, frontConv.Send("input", "hello"))
+
+	res, err := backConv.Recv("link")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: hello", res)
+}
+
+func TestRouteFromYAML(t *testing.T) {
+	t.Parallel()
+
+	def, err := pipeline.Parse([]byte(`
+chan-size: 2
+inputs: [input]
+outputs: [alerts, rest]
+stages:
+  - type: separator
+    inputs: [input]
+    outputs: [alerts, rest]
+    route:
+      strategy: rules
+      rules: [{contains: "error", output: alerts}]
+      fallback: rest
+`))
+	require.NoError(t, err)
+
+	conv, err := pipeline.Build(def, pipeline.NewRegistry())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = conv.Run(ctx) }()
+
+	require.NoError(t, conv.Send("input", "all good"))
+	require.NoError(t, conv.Send("input", "error: disk"))
+
+	res, err := conv.Recv("alerts")
+	require.NoError(t, err)
+	assert.Equal(t, "error: disk", res)
+
+	res, err = conv.Recv("rest")
+	require.NoError(t, err)
+	assert.Equal(t, "all good", res)
+}
+
+func TestExprFromYAML(t *testing.T) {
+	t.Parallel()
+
+	def, err := pipeline.Parse([]byte(`
+chan-size: 4
+inputs: [input]
+outputs: [short, long]
+stages:
+  - type: decorator
+    filter: 'trim(msg) != ""'
+    inputs: [input]
+    outputs: [filled]
+  - type: decorator
+    expr: upper(trim(msg))
+    expr-timeout: 50ms
+    inputs: [filled]
+    outputs: [shouted]
+  - type: separator
+    expr: 'len(msg) > 5 ? 1 : 0'
+    inputs: [shouted]
+    outputs: [short, long]
+`))
+	require.NoError(t, err)
+
+	conv, err := pipeline.Build(def, pipeline.NewRegistry())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = conv.Run(ctx) }()
+
+	for _, item := range []string{" hi ", "  ", "welcome"} {
+		require.NoError(t, conv.Send("input", item))
+	}
+
+	res, err := conv.Recv("short")
+	require.NoError(t, err)
+	assert.Equal(t, "HI", res)
+
+	res, err = conv.Recv("long")
+	require.NoError(t, err)
+	assert.Equal(t, "WELCOME", res)
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	t.Parallel()
+
+	registry := pipeline.NewRegistry()
+
+	fn, err := registry.Decorator("PrefixDecoratorFunc")
+	require.NoError(t, err)
+	require.ErrorIs(t, registry.RegisterDecorator("PrefixDecoratorFunc", fn), pipeline.ErrDuplicateHandler)
+	require.NoError(t, registry.RegisterDecorator("Prefix", fn))
+}
+
+func TestDeadLetterFromYAML(t *testing.T) {
+	t.Parallel()
+
+	def, err := pipeline.Parse([]byte(`
+inputs: [input]
+outputs: [output]
+stages:
+  - type: decorator
+    handler: PrefixDecoratorFunc
+    inputs: [input]
+    outputs: [output]
+    on-error:
+      action: dead-letter
+      retries: 1
+      backoff: 1ms
+      dead-letter: failed
+`))
+	require.NoError(t, err)
+	require.Equal(t, time.Millisecond, def.Stages[0].OnError.Backoff)
+
+	conv, err := pipeline.Build(def, pipeline.NewRegistry())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conv.Run(ctx)
+	}()
+
+	require.NoError(t, conv.Send("input", "no decorator"))
+
+	letter, err := conv.RecvDeadLetter("failed")
+	require.NoError(t, err)
+	assert.Equal(t, "no decorator", letter.Item)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestAckTimeoutFromYAML(t *testing.T) {
+	t.Parallel()
+
+	def, err := pipeline.Parse([]byte(`
+inputs: [input]
+outputs: [output]
+ack-timeout: {output: 30s}
+stages:
+  - {type: decorator, handler: PrefixDecoratorFunc, inputs: [input], outputs: [output]}
+`))
+	require.NoError(t, err)
+
+	conv, err := pipeline.Build(def, pipeline.NewRegistry())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = conv.Run(ctx) }()
+
+	require.NoError(t, conv.Send("input", "hello"))
+
+	delivery, err := conv.RecvDelivery("output")
+	require.NoError(t, err)
+	assert.Equal(t, "decorated: hello", delivery.Item)
+	require.NoError(t, delivery.Ack())
+}
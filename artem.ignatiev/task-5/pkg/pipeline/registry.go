@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/kryjkaqq/task-5/pkg/conveyer"
+	"github.com/kryjkaqq/task-5/pkg/handlers"
+)
+
+var (
+	ErrUnknownHandler   = errors.New("unknown handler")
+	ErrDuplicateHandler = errors.New("handler already registered")
+)
+
+type (
+	DecoratorFunc[T any]   func(ctx context.Context, input chan T, output chan T) error
+	MultiplexerFunc[T any] func(ctx context.Context, inputs []chan T, output chan T) error
+	SeparatorFunc[T any]   func(ctx context.Context, input chan T, outputs []chan T) error
+)
+
+// Registry maps handler names used in pipeline files to stage functions.
+type Registry[T any] struct {
+	decorators   map[string]DecoratorFunc[T]
+	multiplexers map[string]MultiplexerFunc[T]
+	separators   map[string]SeparatorFunc[T]
+}
+
+// NewRegistryOf creates an empty registry for payloads of type T.
+func NewRegistryOf[T any]() *Registry[T] {
+	return &Registry[T]{
+		decorators:   make(map[string]DecoratorFunc[T]),
+		multiplexers: make(map[string]MultiplexerFunc[T]),
+		separators:   make(map[string]SeparatorFunc[T]),
+	}
+}
+
+// NewRegistry creates a string registry with the handlers from pkg/handlers.
+func NewRegistry() *Registry[string] {
+	registry := NewRegistryOf[string]()
+
+	registry.decorators["PrefixDecoratorFunc"] = handlers.PrefixDecoratorFunc
+	registry.separators["SeparatorFunc"] = handlers.SeparatorFunc
+	registry.multiplexers["MultiplexerFunc"] = handlers.MultiplexerFunc
+
+	return registry
+}
+
+// NewEnvelopeRegistry is NewRegistry for pipelines carrying envelopes of strings.
+func NewEnvelopeRegistry() *Registry[conveyer.Envelope[string]] {
+	registry := NewRegistryOf[conveyer.Envelope[string]]()
+
+	registry.decorators["PrefixDecoratorFunc"] = handlers.EnvelopePrefixDecoratorFunc
+	registry.separators["SeparatorFunc"] = handlers.EnvelopeSeparatorFunc
+	registry.multiplexers["MultiplexerFunc"] = handlers.EnvelopeMultiplexerFunc
+
+	return registry
+}
+
+func (r *Registry[T]) RegisterDecorator(name string, fn DecoratorFunc[T]) error {
+	return register(r.decorators, name, fn)
+}
+
+func (r *Registry[T]) RegisterMultiplexer(name string, fn MultiplexerFunc[T]) error {
+	return register(r.multiplexers, name, fn)
+}
+
+func (r *Registry[T]) RegisterSeparator(name string, fn SeparatorFunc[T]) error {
+	return register(r.separators, name, fn)
+}
+
+func (r *Registry[T]) Decorator(name string) (DecoratorFunc[T], error) {
+	return lookup(r.decorators, name)
+}
+
+func (r *Registry[T]) Multiplexer(name string) (MultiplexerFunc[T], error) {
+	return lookup(r.multiplexers, name)
+}
+
+func (r *Registry[T]) Separator(name string) (SeparatorFunc[T], error) {
+	return lookup(r.separators, name)
+}
+
+func register[F any](handlers map[string]F, name string, fn F) error {
+	if _, ok := handlers[name]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateHandler, name)
+	}
+
+	handlers[name] = fn
+
+	return nil
+}
+
+func lookup[F any](handlers map[string]F, name string) (F, error) {
+	fn, ok := handlers[name]
+	if !ok {
+		known := make([]string, 0, len(handlers))
+		for registered := range handlers {
+			known = append(known, registered)
+		}
+
+		sort.Strings(known)
+
+		return fn, fmt.Errorf("%w: %q (known: %v)", ErrUnknownHandler, name, known)
+	}
+
+	return fn, nil
+}
@@ -0,0 +1,548 @@
+package segmentlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrClosed       = errors.New("log is closed")
+	ErrOutOfRange   = errors.New("offset out of range")
+	ErrRecordTooBig = errors.New("record exceeds segment size")
+	ErrCorrupt      = errors.New("log is corrupt")
+)
+
+const (
+	DefaultSegmentSize = 4 << 20
+
+	headerSize    = 8
+	segmentSuffix = ".seg"
+	offsetFile    = "offset"
+	filePerm      = 0o600
+	dirPerm       = 0o750
+)
+
+// SyncPolicy decides when written data is flushed to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncOnCommit flushes the records appended so far and the offset on every
+	// Commit, the default. A power failure may lose records appended since.
+	SyncOnCommit SyncPolicy = iota
+	// SyncAlways also flushes every record before Append returns.
+	SyncAlways
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+type segment struct {
+	base  uint64
+	count uint64
+	size  int64
+	path  string
+}
+
+// Log is an append-only record log split into segment files, with a single
+// consumer offset. Records below the offset are consumed; segments holding
+// only consumed records are removed.
+type Log struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+	segments    []*segment
+	active      *os.File
+	offsetFile  *os.File
+	committed   uint64
+	closed      bool
+	appended    chan struct{}
+	sync        SyncPolicy
+}
+
+// Open opens or creates the log in dir, dropping a torn record left by a crash
+// at its end. A log missing records elsewhere fails with ErrCorrupt.
+func Open(dir string, segmentSize int64) (*Log, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+
+	log := &Log{
+		mu:          sync.Mutex{},
+		dir:         dir,
+		segmentSize: segmentSize,
+		appended:    make(chan struct{}),
+		sync:        SyncOnCommit,
+	}
+
+	if err := log.load(); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+func (l *Log) load() error {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("read log dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		l.segments = append(l.segments, &segment{base: base, path: filepath.Join(l.dir, name)})
+	}
+
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i].base < l.segments[j].base })
+
+	for idx, seg := range l.segments {
+		if err := scanSegment(seg, idx == len(l.segments)-1); err != nil {
+			return err
+		}
+
+		if idx > 0 {
+			prev := l.segments[idx-1]
+			if prev.base+prev.count != seg.base {
+				return fmt.Errorf("%w: records %d to %d are missing", ErrCorrupt, prev.base+prev.count, seg.base)
+			}
+		}
+	}
+
+	l.offsetFile, err = os.OpenFile(filepath.Join(l.dir, offsetFile), os.O_RDWR|os.O_CREATE, filePerm)
+	if err != nil {
+		return fmt.Errorf("open offset file: %w", err)
+	}
+
+	buf := make([]byte, 8)
+	if n, _ := l.offsetFile.ReadAt(buf, 0); n == len(buf) {
+		l.committed = binary.BigEndian.Uint64(buf)
+	}
+
+	if len(l.segments) == 0 {
+		return l.roll(l.committed)
+	}
+
+	last := l.segments[len(l.segments)-1]
+
+	l.active, err = os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, filePerm)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+
+	l.committed = min(max(l.committed, l.segments[0].base), l.endLocked())
+
+	return nil
+}
+
+// scanSegment counts the valid records of a segment and cuts off a torn tail
+// of the last one. Cutting an earlier segment would leave a gap in the offsets
+// of the records after it, so a torn one is reported as corrupt.
+func scanSegment(seg *segment, last bool) error {
+	file, err := os.OpenFile(seg.path, os.O_RDWR, filePerm)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat segment: %w", err)
+	}
+
+	var offset int64
+
+	for {
+		_, size, err := readRecord(file, offset, info.Size())
+		if err != nil {
+			break
+		}
+
+		offset += size
+		seg.count++
+	}
+
+	if offset < info.Size() && !last {
+		return fmt.Errorf("%w: segment %s is torn at byte %d", ErrCorrupt, filepath.Base(seg.path), offset)
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return fmt.Errorf("truncate segment: %w", err)
+	}
+
+	seg.size = offset
+
+	return nil
+}
+
+// readRecord reads the record at offset of a file holding end bytes. A length
+// header pointing past end is a torn or corrupt record, so nothing is
+// allocated for it.
+func readRecord(reader io.ReaderAt, offset int64, end int64) ([]byte, int64, error) {
+	header := make([]byte, headerSize)
+	if _, err := reader.ReadAt(header, offset); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if int64(length) > end-offset-headerSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, length)
+
+	if _, err := reader.ReadAt(data, offset+headerSize); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	return data, headerSize + int64(length), nil
+}
+
+func (l *Log) roll(base uint64) error {
+	if l.active != nil {
+		if err := l.syncFile(l.active, SyncOnCommit); err != nil {
+			return err
+		}
+
+		if err := l.active.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+	}
+
+	seg := &segment{base: base, path: filepath.Join(l.dir, fmt.Sprintf("%020d%s", base, segmentSuffix))}
+
+	file, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, filePerm)
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+
+	l.active = file
+	l.segments = append(l.segments, seg)
+
+	return l.syncDir()
+}
+
+// SetSync changes the sync policy of the log.
+func (l *Log) SetSync(policy SyncPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sync = policy
+}
+
+// Sync flushes the appended records and the offset to stable storage.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	return errors.Join(l.active.Sync(), l.offsetFile.Sync())
+}
+
+// syncFile flushes file unless the policy of the log is weaker than needed.
+func (l *Log) syncFile(file *os.File, needed SyncPolicy) error {
+	if l.sync == SyncNever || (needed == SyncAlways && l.sync != SyncAlways) {
+		return nil
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", filepath.Base(file.Name()), err)
+	}
+
+	return nil
+}
+
+// syncDir makes a created segment file survive a crash.
+func (l *Log) syncDir() error {
+	if l.sync == SyncNever {
+		return nil
+	}
+
+	dir, err := os.Open(l.dir)
+	if err != nil {
+		return fmt.Errorf("open log dir: %w", err)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("sync log dir: %w", err)
+	}
+
+	return nil
+}
+
+func (l *Log) endLocked() uint64 {
+	last := l.segments[len(l.segments)-1]
+
+	return last.base + last.count
+}
+
+// Append writes a record and returns its offset.
+func (l *Log) Append(data []byte) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0, ErrClosed
+	}
+
+	size := headerSize + int64(len(data))
+	if size > l.segmentSize {
+		return 0, ErrRecordTooBig
+	}
+
+	last := l.segments[len(l.segments)-1]
+	if last.size+size > l.segmentSize {
+		if err := l.roll(l.endLocked()); err != nil {
+			return 0, err
+		}
+
+		last = l.segments[len(l.segments)-1]
+	}
+
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:headerSize], crc32.ChecksumIEEE(data))
+	copy(record[headerSize:], data)
+
+	if _, err := l.active.Write(record); err != nil {
+		return 0, errors.Join(fmt.Errorf("write record: %w", err), l.truncateLocked(last))
+	}
+
+	if err := l.syncFile(l.active, SyncAlways); err != nil {
+		return 0, errors.Join(err, l.truncateLocked(last))
+	}
+
+	offset := last.base + last.count
+	last.count++
+	last.size += size
+
+	close(l.appended)
+	l.appended = make(chan struct{})
+
+	return offset, nil
+}
+
+// truncateLocked cuts a record which was not appended in full off the active
+// segment, so the next one does not land behind it.
+func (l *Log) truncateLocked(last *segment) error {
+	if err := l.active.Truncate(last.size); err != nil {
+		return fmt.Errorf("truncate segment: %w", err)
+	}
+
+	return nil
+}
+
+// Reader reads records sequentially, starting at a given offset.
+type Reader struct {
+	log      *Log
+	offset   uint64
+	segment  *segment
+	file     *os.File
+	position int64
+	end      int64
+}
+
+func (l *Log) NewReader(offset uint64) *Reader {
+	return &Reader{log: l, offset: offset}
+}
+
+// Offset is the offset of the record the next call to Next returns.
+func (r *Reader) Offset() uint64 {
+	return r.offset
+}
+
+// Next returns the next record or io.EOF when the reader caught up with the log.
+func (r *Reader) Next() ([]byte, error) {
+	if err := r.seek(); err != nil {
+		return nil, err
+	}
+
+	data, size, err := readRecord(r.file, r.position, r.end)
+	if err != nil {
+		return nil, fmt.Errorf("read record %d: %w", r.offset, err)
+	}
+
+	r.position += size
+	r.offset++
+
+	return data, nil
+}
+
+func (r *Reader) seek() error {
+	r.log.mu.Lock()
+	defer r.log.mu.Unlock()
+
+	if r.log.closed {
+		return ErrClosed
+	}
+
+	if r.offset >= r.log.endLocked() {
+		return io.EOF
+	}
+
+	if r.segment != nil && r.offset < r.segment.base+r.segment.count {
+		r.end = r.segment.size
+
+		return nil
+	}
+
+	idx := sort.Search(len(r.log.segments), func(i int) bool {
+		return r.log.segments[i].base+r.log.segments[i].count > r.offset
+	})
+	if idx == len(r.log.segments) || r.offset < r.log.segments[idx].base {
+		return ErrOutOfRange
+	}
+
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	seg := r.log.segments[idx]
+
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+
+	var position int64
+
+	for skip := seg.base; skip < r.offset; skip++ {
+		_, size, err := readRecord(file, position, seg.size)
+		if err != nil {
+			file.Close()
+
+			return fmt.Errorf("skip record %d: %w", skip, err)
+		}
+
+		position += size
+	}
+
+	r.segment, r.file, r.position, r.end = seg, file, position, seg.size
+
+	return nil
+}
+
+func (r *Reader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file, r.segment = nil, nil
+
+	if err != nil {
+		return fmt.Errorf("close segment: %w", err)
+	}
+
+	return nil
+}
+
+// Wait returns a channel closed by the next Append.
+func (l *Log) Wait() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.appended
+}
+
+// End is the offset the next record will get.
+func (l *Log) End() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.endLocked()
+}
+
+// Committed is the consumer offset: the first record not yet consumed.
+func (l *Log) Committed() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.committed
+}
+
+// Commit advances the consumer offset by count records. Unless the policy is
+// SyncNever, the records appended so far reach stable storage before the
+// offset does.
+func (l *Log) Commit(count uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	if err := l.syncFile(l.active, SyncOnCommit); err != nil {
+		return err
+	}
+
+	l.committed = min(l.committed+count, l.endLocked())
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, l.committed)
+
+	if _, err := l.offsetFile.WriteAt(buf, 0); err != nil {
+		return fmt.Errorf("write offset: %w", err)
+	}
+
+	if err := l.syncFile(l.offsetFile, SyncOnCommit); err != nil {
+		return err
+	}
+
+	return l.compactLocked()
+}
+
+func (l *Log) compactLocked() error {
+	for len(l.segments) > 1 && l.segments[0].base+l.segments[0].count <= l.committed {
+		if err := os.Remove(l.segments[0].path); err != nil {
+			return fmt.Errorf("remove segment: %w", err)
+		}
+
+		l.segments = l.segments[1:]
+	}
+
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	l.closed = true
+
+	return errors.Join(
+		l.syncFile(l.active, SyncOnCommit), l.syncFile(l.offsetFile, SyncOnCommit),
+		l.active.Close(), l.offsetFile.Close(),
+	)
+}
@@ -0,0 +1,228 @@
+package segmentlog_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/segmentlog"
+)
+
+func readAll(t *testing.T, log *segmentlog.Log, offset uint64) []string {
+	t.Helper()
+
+	reader := log.NewReader(offset)
+	defer reader.Close()
+
+	var records []string
+
+	for {
+		data, err := reader.Next()
+		if err == io.EOF {
+			return records
+		}
+
+		require.NoError(t, err)
+
+		records = append(records, string(data))
+	}
+}
+
+func TestAppendAndRead(t *testing.T) {
+	t.Parallel()
+
+	log, err := segmentlog.Open(t.TempDir(), 64)
+	require.NoError(t, err)
+
+	defer log.Close()
+
+	for i := range 10 {
+		offset, err := log.Append([]byte(fmt.Sprintf("record %d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i), offset)
+	}
+
+	records := readAll(t, log, 0)
+	require.Len(t, records, 10)
+	assert.Equal(t, "record 0", records[0])
+	assert.Equal(t, "record 9", records[9])
+
+	assert.Equal(t, []string{"record 7", "record 8", "record 9"}, readAll(t, log, 7))
+	assert.Equal(t, uint64(10), log.End())
+
+	_, err = log.Append(make([]byte, 128))
+	require.ErrorIs(t, err, segmentlog.ErrRecordTooBig)
+}
+
+func TestCommitSurvivesReopen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	log, err := segmentlog.Open(dir, 64)
+	require.NoError(t, err)
+
+	for i := range 10 {
+		_, err := log.Append([]byte(fmt.Sprintf("record %d", i)))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, log.Commit(6))
+	require.NoError(t, log.Close())
+
+	_, err = log.Append([]byte("late"))
+	require.ErrorIs(t, err, segmentlog.ErrClosed)
+
+	log, err = segmentlog.Open(dir, 64)
+	require.NoError(t, err)
+
+	defer log.Close()
+
+	assert.Equal(t, uint64(6), log.Committed())
+	assert.Equal(t, uint64(10), log.End())
+	assert.Equal(t, []string{"record 6", "record 7", "record 8", "record 9"}, readAll(t, log, log.Committed()))
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	assert.Less(t, len(segments), 5, "consumed segments should be compacted")
+}
+
+func TestTornWriteIsDropped(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	log, err := segmentlog.Open(dir, segmentlog.DefaultSegmentSize)
+	require.NoError(t, err)
+
+	for _, record := range []string{"one", "two", "three"} {
+		_, err := log.Append([]byte(record))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, log.Close())
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	info, err := os.Stat(segments[0])
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(segments[0], info.Size()-2))
+
+	log, err = segmentlog.Open(dir, segmentlog.DefaultSegmentSize)
+	require.NoError(t, err)
+
+	defer log.Close()
+
+	assert.Equal(t, []string{"one", "two"}, readAll(t, log, 0))
+
+	_, err = log.Append([]byte("four"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two", "four"}, readAll(t, log, 0))
+}
+
+func TestCorruptLengthIsDropped(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	log, err := segmentlog.Open(dir, segmentlog.DefaultSegmentSize)
+	require.NoError(t, err)
+
+	for _, record := range []string{"one", "two"} {
+		_, err := log.Append([]byte(record))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, log.Close())
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	file, err := os.OpenFile(segments[0], os.O_WRONLY, 0)
+	require.NoError(t, err)
+
+	// The length header of "two" now claims almost 4 GiB.
+	_, err = file.WriteAt([]byte{0xff, 0xff, 0xff, 0xf0}, 8+3)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	log, err = segmentlog.Open(dir, segmentlog.DefaultSegmentSize)
+	require.NoError(t, err)
+
+	defer log.Close()
+
+	assert.Equal(t, []string{"one"}, readAll(t, log, 0))
+}
+
+func TestTornEarlierSegmentIsCorrupt(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	// Every segment holds a single record.
+	log, err := segmentlog.Open(dir, 12)
+	require.NoError(t, err)
+
+	for _, record := range []string{"one", "two", "six"} {
+		_, err := log.Append([]byte(record))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, log.Close())
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+	require.NoError(t, os.Truncate(segments[1], 9))
+
+	_, err = segmentlog.Open(dir, 12)
+	require.ErrorIs(t, err, segmentlog.ErrCorrupt)
+
+	info, err := os.Stat(segments[1])
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), info.Size(), "a corrupt log is left as it is")
+
+	require.NoError(t, os.Remove(segments[1]))
+
+	_, err = segmentlog.Open(dir, 12)
+	require.ErrorIs(t, err, segmentlog.ErrCorrupt, "a missing segment leaves a gap too")
+}
+
+func TestSyncPolicies(t *testing.T) {
+	t.Parallel()
+
+	policies := []segmentlog.SyncPolicy{segmentlog.SyncOnCommit, segmentlog.SyncAlways, segmentlog.SyncNever}
+
+	for _, policy := range policies {
+		dir := t.TempDir()
+
+		log, err := segmentlog.Open(dir, 64)
+		require.NoError(t, err)
+
+		log.SetSync(policy)
+
+		for _, record := range []string{"one", "two", "three", "four", "five"} {
+			_, err := log.Append([]byte(record))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, log.Commit(2))
+		require.NoError(t, log.Sync())
+		require.NoError(t, log.Close())
+		require.ErrorIs(t, log.Sync(), segmentlog.ErrClosed)
+
+		log, err = segmentlog.Open(dir, 64)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"three", "four", "five"}, readAll(t, log, log.Committed()))
+		require.NoError(t, log.Close())
+	}
+}
@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFrameTooBig  = errors.New("frame exceeds size limit")
+	ErrBadCredit    = errors.New("malformed credit frame")
+	ErrUnknownFrame = errors.New("unknown frame type")
+	errShortPayload = errors.New("short frame payload")
+)
+
+type FrameType byte
+
+const (
+	// FrameHello opens a link and names the channel it carries.
+	FrameHello FrameType = iota + 1
+	// FrameData carries one encoded message.
+	FrameData
+	// FrameCredit allows the sender to push that many more messages.
+	FrameCredit
+	// FrameCancel reports that the peer was cancelled.
+	FrameCancel
+	// FrameFail reports that the peer stopped with an error.
+	FrameFail
+	// FrameEnd reports that the sender has no more messages.
+	FrameEnd
+)
+
+const (
+	MaxFrameSize = 16 << 20
+	// Linger bounds how long a hung up link waits for the peer to close its side.
+	Linger = time.Second
+
+	headerSize = 5
+	creditSize = 4
+)
+
+type Frame struct {
+	Type    FrameType
+	Payload []byte
+}
+
+func CreditFrame(credit uint32) Frame {
+	payload := make([]byte, creditSize)
+	binary.BigEndian.PutUint32(payload, credit)
+
+	return Frame{Type: FrameCredit, Payload: payload}
+}
+
+func (f Frame) Credit() (uint32, error) {
+	if f.Type != FrameCredit || len(f.Payload) != creditSize {
+		return 0, ErrBadCredit
+	}
+
+	return binary.BigEndian.Uint32(f.Payload), nil
+}
+
+// Conn reads and writes frames: a type byte, a big-endian uint32 payload
+// length and the payload. Writes are safe for concurrent use.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+	hangup sync.Once
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		mu:     sync.Mutex{},
+		hangup: sync.Once{},
+	}
+}
+
+func (c *Conn) Write(frame Frame) error {
+	if len(frame.Payload) > MaxFrameSize {
+		return ErrFrameTooBig
+	}
+
+	buf := make([]byte, headerSize+len(frame.Payload))
+	buf[0] = byte(frame.Type)
+	binary.BigEndian.PutUint32(buf[1:headerSize], uint32(len(frame.Payload)))
+	copy(buf[headerSize:], frame.Payload)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.conn.Write(buf); err != nil {
+		return fmt.Errorf("write frame: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Conn) Read() (Frame, error) {
+	var header [headerSize]byte
+
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return Frame{}, fmt.Errorf("read frame header: %w", err)
+	}
+
+	frameType := FrameType(header[0])
+	if frameType < FrameHello || frameType > FrameEnd {
+		return Frame{}, fmt.Errorf("%w: %d", ErrUnknownFrame, frameType)
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxFrameSize {
+		return Frame{}, ErrFrameTooBig
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return Frame{}, fmt.Errorf("read frame payload: %w", err)
+	}
+
+	return Frame{Type: frameType, Payload: payload}, nil
+}
+
+// Hangup sends a last frame and stops writing, so the peer reads everything up
+// to it instead of a reset. Later calls do nothing.
+func (c *Conn) Hangup(frame Frame) {
+	c.hangup.Do(func() {
+		_ = c.Write(frame)
+
+		if half, ok := c.conn.(interface{ CloseWrite() error }); ok {
+			_ = half.CloseWrite()
+		}
+
+		_ = c.conn.SetReadDeadline(time.Now().Add(Linger))
+	})
+}
+
+// Drain discards frames until the peer closes the link or Linger runs out
+// after Hangup. It must not run concurrently with Read.
+func (c *Conn) Drain() {
+	_, _ = io.Copy(io.Discard, c.reader)
+}
+
+func (c *Conn) Close() error {
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("close link: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package transport_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kryjkaqq/task-5/pkg/transport"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	left, right := net.Pipe()
+	writer, reader := transport.NewConn(left), transport.NewConn(right)
+
+	defer writer.Close()
+	defer reader.Close()
+
+	frames := []transport.Frame{
+		{Type: transport.FrameHello, Payload: []byte("chan")},
+		{Type: transport.FrameData, Payload: []byte{}},
+		transport.CreditFrame(7),
+		{Type: transport.FrameFail, Payload: []byte("boom")},
+		{Type: transport.FrameEnd, Payload: []byte{}},
+	}
+
+	go func() {
+		for _, frame := range frames {
+			assert.NoError(t, writer.Write(frame))
+		}
+	}()
+
+	for _, want := range frames {
+		got, err := reader.Read()
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	credit, err := frames[2].Credit()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(7), credit)
+
+	_, err = frames[0].Credit()
+	require.ErrorIs(t, err, transport.ErrBadCredit)
+}
+
+func TestRejectsBadFrames(t *testing.T) {
+	t.Parallel()
+
+	left, right := net.Pipe()
+	conn := transport.NewConn(right)
+
+	defer left.Close()
+	defer conn.Close()
+
+	err := conn.Write(transport.Frame{Type: transport.FrameData, Payload: make([]byte, transport.MaxFrameSize+1)})
+	require.ErrorIs(t, err, transport.ErrFrameTooBig)
+
+	go func() {
+		_, _ = left.Write([]byte{0x7f, 0, 0, 0, 0})
+		_, _ = left.Write([]byte{byte(transport.FrameData), 0xff, 0xff, 0xff, 0xff})
+	}()
+
+	_, err = conn.Read()
+	require.ErrorIs(t, err, transport.ErrUnknownFrame)
+
+	_, err = conn.Read()
+	require.ErrorIs(t, err, transport.ErrFrameTooBig)
+}